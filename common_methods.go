@@ -29,3 +29,11 @@ func (m *MTProto) setClientDHParams(nonce, serverNonce *tl.Int128, encryptedData
 func (m *MTProto) ping(pingID int64) (*objects.Pong, error) {
 	return objects.Ping(m, pingID)
 }
+
+func (m *MTProto) destroySession(sessionID int64) (objects.DestroySessionRes, error) {
+	return objects.DestroySession(m, sessionID)
+}
+
+func (m *MTProto) destroyAuthKey() (objects.DestroyAuthKeyRes, error) {
+	return objects.DestroyAuthKey(m)
+}
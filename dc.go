@@ -0,0 +1,162 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package mtproto
+
+import (
+	"sort"
+	"sync"
+)
+
+// DCOption is a single address of datacenter. Flags are the same as in dcOption of telegram api, except
+// this_port_only: client never tries other ports than the one in Addr, so this flag doesn't change anything.
+// https://core.telegram.org/constructor/dcOption
+type DCOption struct {
+	ID int
+	// Addr is host:port of datacenter
+	Addr string
+
+	IPv6 bool
+	// MediaOnly addresses must be used only for downloading files
+	MediaOnly bool
+	// TCPOOnly addresses accept only obfuscated tcp connections
+	TCPOOnly bool
+	// CDN addresses are used only for downloading files from cdn
+	CDN bool
+	// Static addresses should be used, when connection is made through proxy
+	Static bool
+	// Secret is used only for connecting to MTProxy, in other cases it's empty
+	Secret []byte
+}
+
+// DCQuery describes which addresses of datacenter are needed.
+type DCQuery struct {
+	// Media is set for downloading files: media-only addresses go first.
+	Media bool
+	// CDN is set for downloading files from cdn: only cdn addresses are returned.
+	CDN bool
+	// Proxied is set when connection is made through proxy: static addresses go first.
+	Proxied bool
+}
+
+// DCDirectory holds all known addresses of all datacenters. Usually it's filled from config of server
+// (help.getConfig), but it has a default list of well-known addresses, so it's possible to connect even to
+// other dc, until config is received. DCDirectory is safe for concurrent use.
+type DCDirectory struct {
+	mutex       sync.RWMutex
+	options     map[int][]DCOption
+	preferIPv6  bool
+	disableIPv6 bool
+}
+
+// NewDCDirectory creates directory with specified addresses. if options are empty, default list of
+// addresses is used.
+func NewDCDirectory(options []DCOption) *DCDirectory {
+	d := &DCDirectory{}
+	if len(options) == 0 {
+		options = defaultDCList()
+	}
+	d.Set(options)
+
+	return d
+}
+
+// SetPreferIPv6 puts ipv6 addresses before ipv4 ones. ipv6 addresses are used in any case, if ipv4 ones are
+// unreachable.
+func (d *DCDirectory) SetPreferIPv6(prefer bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.preferIPv6 = prefer
+}
+
+// SetDisableIPv6 skips all ipv6 addresses, e.g. if host doesn't have ipv6 connectivity.
+func (d *DCDirectory) SetDisableIPv6(disable bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.disableIPv6 = disable
+}
+
+// Set replaces all known addresses. Usually it's called with dc_options of config.
+func (d *DCDirectory) Set(options []DCOption) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.options = make(map[int][]DCOption)
+	d.add(options)
+}
+
+// Update replaces addresses only of dcs, which are mentioned in options. It's useful for updateDcOptions,
+// which contains only changed dcs.
+func (d *DCDirectory) Update(options []DCOption) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.options == nil {
+		d.options = make(map[int][]DCOption)
+	}
+	for _, o := range options {
+		delete(d.options, o.ID)
+	}
+	d.add(options)
+}
+
+func (d *DCDirectory) add(options []DCOption) {
+	for _, o := range options {
+		d.options[o.ID] = append(d.options[o.ID], o)
+	}
+}
+
+// Options returns all known addresses of dc, in the same order as they were added.
+func (d *DCDirectory) Options(dc int) []DCOption {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return append([]DCOption(nil), d.options[dc]...)
+}
+
+// Addresses returns addresses of dc, which satisfy query, from the most preferable to the least one. If
+// first address is unreachable, next one should be tried, and so on. TCPOOnly addresses are never
+// returned: they accept only connections, obfuscated with their own Secret, but client obfuscates
+// connection only when it connects through MTProxy, and then directory isn't used.
+func (d *DCDirectory) Addresses(dc int, q DCQuery) []string {
+	d.mutex.RLock()
+	options := make([]DCOption, 0, len(d.options[dc]))
+	for _, o := range d.options[dc] {
+		if o.CDN != q.CDN || o.TCPOOnly || (o.MediaOnly && !q.Media) || (o.IPv6 && d.disableIPv6) {
+			continue
+		}
+		options = append(options, o)
+	}
+	preferIPv6 := d.preferIPv6
+	d.mutex.RUnlock()
+
+	// sorting by preference, but keeping order of server for same ones
+	sort.SliceStable(options, func(i, j int) bool {
+		a, b := options[i], options[j]
+		switch {
+		case a.MediaOnly != b.MediaOnly:
+			return a.MediaOnly
+		case q.Proxied && a.Static != b.Static:
+			return a.Static
+		case a.IPv6 != b.IPv6:
+			return a.IPv6 == preferIPv6
+		default:
+			return false
+		}
+	})
+
+	addrs := make([]string, 0, len(options))
+	seen := make(map[string]bool, len(options))
+	for _, o := range options {
+		if !seen[o.Addr] {
+			seen[o.Addr] = true
+			addrs = append(addrs, o.Addr)
+		}
+	}
+
+	return addrs
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package mtproto_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xelaj/mtproto"
+)
+
+func TestDCDirectory_Addresses(t *testing.T) {
+	options := []mtproto.DCOption{
+		{ID: 2, Addr: "[2001:67c:4e8:f002::a]:443", IPv6: true},
+		{ID: 2, Addr: "149.154.167.50:443"},
+		{ID: 2, Addr: "149.154.167.51:443", Static: true},
+		{ID: 2, Addr: "149.154.167.151:443", MediaOnly: true},
+		{ID: 2, Addr: "149.154.167.52:443", TCPOOnly: true},
+		{ID: 2, Addr: "91.108.56.100:443", CDN: true},
+		{ID: 2, Addr: "149.154.167.50:443"}, // duplicates are skipped
+		{ID: 4, Addr: "149.154.167.91:443"},
+	}
+
+	for _, tt := range []struct {
+		name        string
+		preferIPv6  bool
+		disableIPv6 bool
+		query       mtproto.DCQuery
+		want        []string
+	}{
+		{
+			name: "default",
+			want: []string{"149.154.167.50:443", "149.154.167.51:443", "[2001:67c:4e8:f002::a]:443"},
+		},
+		{
+			name:       "prefer ipv6",
+			preferIPv6: true,
+			want:       []string{"[2001:67c:4e8:f002::a]:443", "149.154.167.50:443", "149.154.167.51:443"},
+		},
+		{
+			name:        "disable ipv6",
+			disableIPv6: true,
+			want:        []string{"149.154.167.50:443", "149.154.167.51:443"},
+		},
+		{
+			name:  "media",
+			query: mtproto.DCQuery{Media: true},
+			want: []string{
+				"149.154.167.151:443", "149.154.167.50:443", "149.154.167.51:443", "[2001:67c:4e8:f002::a]:443",
+			},
+		},
+		{
+			name:  "proxied",
+			query: mtproto.DCQuery{Proxied: true},
+			want:  []string{"149.154.167.51:443", "149.154.167.50:443", "[2001:67c:4e8:f002::a]:443"},
+		},
+		{
+			name:  "cdn",
+			query: mtproto.DCQuery{CDN: true},
+			want:  []string{"91.108.56.100:443"},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			d := mtproto.NewDCDirectory(options)
+			d.SetPreferIPv6(tt.preferIPv6)
+			d.SetDisableIPv6(tt.disableIPv6)
+
+			assert.Equal(t, tt.want, d.Addresses(2, tt.query))
+		})
+	}
+}
+
+func TestDCDirectory_Update(t *testing.T) {
+	d := mtproto.NewDCDirectory(nil)
+	assert.Equal(t, []string{"149.154.167.50:443"}, d.Addresses(2, mtproto.DCQuery{}))
+
+	d.Update([]mtproto.DCOption{
+		{ID: 2, Addr: "149.154.167.40:443"},
+		{ID: 2, Addr: "149.154.167.41:443"},
+	})
+	assert.Equal(t, []string{"149.154.167.40:443", "149.154.167.41:443"}, d.Addresses(2, mtproto.DCQuery{}))
+	assert.Equal(t, []string{"149.154.175.58:443"}, d.Addresses(1, mtproto.DCQuery{}), "other dcs are kept")
+
+	d.Set([]mtproto.DCOption{{ID: 3, Addr: "149.154.175.100:443"}})
+	assert.Empty(t, d.Addresses(2, mtproto.DCQuery{}))
+	assert.Len(t, d.Options(3), 1)
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package mtproto
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
+)
+
+// DestroyAuthKey asks server to forget current auth key. Request is sent unencrypted, as protocol requires.
+// After success (or if server doesn't know this key already), client forgets key too, so next
+// CreateConnection will generate new one.
+//
+// Note that stored session is not touched, use DeleteStoredSession to remove it.
+func (m *MTProto) DestroyAuthKey() error {
+	if !m.encrypted {
+		return errors.New("auth key is not created yet")
+	}
+
+	resp, err := m.destroyAuthKey()
+	if err != nil {
+		return errors.Wrap(err, "sending destroy_auth_key")
+	}
+
+	switch resp.(type) {
+	case *objects.DestroyAuthKeyOk, *objects.DestroyAuthKeyNone:
+	case *objects.DestroyAuthKeyFail:
+		return errors.New("server failed to destroy auth key")
+	default:
+		return fmt.Errorf("got invalid response type: %T", resp)
+	}
+
+	m.forgetAuthKey()
+
+	return nil
+}
+
+// DestroySession asks server to destroy another session of this auth key (e.g. session of previous
+// connection), so server stops storing its pending messages. Current session can't be destroyed this way.
+// It's not an error, if server doesn't know session with this id.
+func (m *MTProto) DestroySession(sessionID int64) error {
+	if sessionID == m.sessionId {
+		return errors.New("can't destroy current session")
+	}
+
+	resp, err := m.destroySession(sessionID)
+	if err != nil {
+		return errors.Wrap(err, "sending destroy_session")
+	}
+
+	switch resp.(type) {
+	case *objects.DestroySessionOk, *objects.DestroySessionNone:
+		return nil
+	default:
+		return fmt.Errorf("got invalid response type: %T", resp)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package mtproto_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xelaj/errs"
+
+	"github.com/xelaj/mtproto/server"
+	"github.com/xelaj/mtproto/session"
+)
+
+// legacyLoader implements only SessionLoader, like loaders, which were written before deleting was added.
+type legacyLoader struct {
+	stored *session.Session
+}
+
+func (l *legacyLoader) Load() (*session.Session, error) {
+	if l.stored == nil {
+		return nil, errs.NotFound("session", "legacy")
+	}
+	return l.stored, nil
+}
+
+func (l *legacyLoader) Store(s *session.Session) error {
+	l.stored = s
+	return nil
+}
+
+func sessionIDs(s *server.Server) []int64 {
+	res := make([]int64, 0)
+	for _, sess := range s.Sessions() {
+		res = append(res, sess.ID())
+	}
+	return res
+}
+
+func TestMTProto_DestroyAuthKey(t *testing.T) {
+	s, config := newServer(t)
+	s.Handle((&echoParams{}).CRC(), echo)
+	m := connect(t, config)
+
+	_, err := m.MakeRequest(&echoParams{Text: "hello"})
+	require.NoError(t, err)
+	key := m.GetAuthKey()
+	require.NotNil(t, key)
+
+	require.NoError(t, m.DestroyAuthKey())
+	assert.Nil(t, m.GetAuthKey())
+	assert.Empty(t, s.Sessions(), "sessions of destroyed key must be dropped by server")
+	assert.Error(t, m.DestroyAuthKey(), "there is no key to destroy")
+
+	// stored session is removed only by DeleteStoredSession
+	stored, err := config.SessionStorage.Load()
+	require.NoError(t, err)
+	assert.Equal(t, key, stored.Key)
+	require.NoError(t, m.DeleteStoredSession())
+	_, err = config.SessionStorage.Load()
+	assert.True(t, errs.IsNotFound(err), "got %v", err)
+}
+
+func TestMTProto_DestroySession(t *testing.T) {
+	s, config := newServer(t)
+	s.Handle((&echoParams{}).CRC(), echo)
+
+	// both clients use the same auth key, cause it's stored in shared storage
+	first := connect(t, config)
+	_, err := first.MakeRequest(&echoParams{Text: "first"})
+	require.NoError(t, err)
+	second := connect(t, config)
+	_, err = second.MakeRequest(&echoParams{Text: "second"})
+	require.NoError(t, err)
+	require.Equal(t, first.GetAuthKey(), second.GetAuthKey())
+	require.ElementsMatch(t, []int64{first.GetSessionID(), second.GetSessionID()}, sessionIDs(s))
+
+	assert.Error(t, second.DestroySession(second.GetSessionID()), "current session can't be destroyed")
+
+	require.NoError(t, second.DestroySession(first.GetSessionID()))
+	assert.Equal(t, []int64{second.GetSessionID()}, sessionIDs(s))
+
+	// server doesn't know this session anymore, it's not an error
+	assert.NoError(t, second.DestroySession(first.GetSessionID()))
+}
+
+func TestMTProto_DeleteStoredSessionNotSupported(t *testing.T) {
+	_, config := newServer(t)
+	config.SessionStorage = &legacyLoader{}
+	m := connect(t, config)
+
+	err := m.DeleteStoredSession()
+	assert.True(t, errors.Is(err, session.ErrDeleteNotSupported), "got %v", err)
+}
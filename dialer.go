@@ -0,0 +1,39 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package mtproto
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Dialer makes connection to server. addr is ServerHost (or address of other dc after migration) for tcp
+// transport, and host:port of url for http and websocket transports. Dialer could return any net.Conn, e.g.
+// unix socket to some sidecar or net.Pipe in tests.
+type Dialer interface {
+	DialContext(ctx context.Context, addr string) (net.Conn, error)
+}
+
+// DialerFunc is an adapter to use ordinary function as Dialer.
+type DialerFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+func (f DialerFunc) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	return f(ctx, addr)
+}
+
+// TCPDialer is a default Dialer, it connects to server directly through tcp.
+type TCPDialer struct {
+	// Timeout of connecting, zero means no timeout.
+	Timeout time.Duration
+}
+
+var _ Dialer = (*TCPDialer)(nil)
+
+func (d *TCPDialer) DialContext(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: d.Timeout}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
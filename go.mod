@@ -12,6 +12,6 @@ require (
 	github.com/xelaj/errs v0.0.0-20200831133608-d1c11863e019
 	github.com/xelaj/go-dry v0.0.0-20210621215431-21c77821487c
 	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
-	golang.org/x/sys v0.0.0-20210324051608-47abb6519492 // indirect
+	golang.org/x/sys v0.0.0-20210324051608-47abb6519492
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
 )
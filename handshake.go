@@ -85,7 +85,10 @@ func (m *MTProto) makeAuthKey() error { // nolint don't know how to make method
 	}
 
 	// check of hash, trandom bytes trail removing occurs in this func already
-	decodedMessage := ige.DecryptMessageWithTempKeys(dhParams.EncryptedAnswer, nonceSecond.Int, nonceServer.Int)
+	decodedMessage, err := ige.DecryptMessageWithTempKeys(dhParams.EncryptedAnswer, nonceSecond.Int, nonceServer.Int)
+	if err != nil {
+		return errors.Wrap(err, "decrypting response from server")
+	}
 	data, err := tl.DecodeUnknownObject(decodedMessage)
 	if err != nil {
 		return errors.Wrap(err, "decoding response from server")
@@ -105,22 +108,21 @@ func (m *MTProto) makeAuthKey() error { // nolint don't know how to make method
 	// this apparently is just part of diffie hellman, so just leave it as it is, hope that it will just work
 	_, gB, gAB := math.MakeGAB(dhi.G, big.NewInt(0).SetBytes(dhi.GA), big.NewInt(0).SetBytes(dhi.DhPrime))
 
-	authKey := gAB.Bytes()
-	if authKey[0] == 0 {
-		authKey = authKey[1:]
-	}
+	// auth key is always 2048 bit value, even if it has leading zeros
+	authKey := dry.BigIntBytes(gAB, 2048) //nolint:gomnd not magic
 
 	m.SetAuthKey(authKey)
 
 	// I don't know what it is, apparently some very specific way to generate keys
-	t4 := make([]byte, 32+1+8) // nolint:gomnd ALL PROTOCOL IS A MAGIC
-	copy(t4[0:], nonceSecond.Bytes())
+	nonceSecondBytes := dry.BigIntBytes(nonceSecond.Int, 256) //nolint:gomnd not magic
+	t4 := make([]byte, 32+1+8)                                // nolint:gomnd ALL PROTOCOL IS A MAGIC
+	copy(t4[0:], nonceSecondBytes)
 	t4[32] = 1
 	copy(t4[33:], dry.Sha1Byte(m.GetAuthKey())[0:8])
 	nonceHash1 := dry.Sha1Byte(t4)[4:20]
 	salt := make([]byte, tl.LongLen)
-	copy(salt, nonceSecond.Bytes()[:8])
-	math.Xor(salt, nonceServer.Bytes()[:8])
+	copy(salt, nonceSecondBytes[:8])
+	math.Xor(salt, dry.BigIntBytes(nonceServer.Int, 128)[:8]) //nolint:gomnd not magic
 	m.serverSalt = int64(binary.LittleEndian.Uint64(salt))
 
 	// (encoding) client_DH_inner_data
@@ -149,11 +151,11 @@ func (m *MTProto) makeAuthKey() error { // nolint don't know how to make method
 	if nonceServer.Cmp(dhg.ServerNonce.Int) != 0 {
 		return fmt.Errorf("handshake: Wrong server_nonce: %v, %v", nonceServer, dhg.ServerNonce)
 	}
-	if !bytes.Equal(nonceHash1, dhg.NewNonceHash1.Bytes()) {
+	if !bytes.Equal(nonceHash1, dry.BigIntBytes(dhg.NewNonceHash1.Int, 128)) { //nolint:gomnd not magic
 		return fmt.Errorf(
 			"handshake: Wrong new_nonce_hash1: %v, %v",
 			hex.EncodeToString(nonceHash1),
-			hex.EncodeToString(dhg.NewNonceHash1.Bytes()),
+			hex.EncodeToString(dry.BigIntBytes(dhg.NewNonceHash1.Int, 128)), //nolint:gomnd not magic
 		)
 	}
 
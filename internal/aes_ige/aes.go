@@ -8,6 +8,9 @@ package ige
 import (
 	"bytes"
 	"crypto/aes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
 	"math/big"
 
 	"github.com/xelaj/go-dry"
@@ -22,12 +25,20 @@ func MessageKey(msg []byte) []byte {
 }
 
 func Encrypt(msg, key []byte) ([]byte, error) {
+	return encrypt(msg, key, false)
+}
+
+// EncryptAsServer works same as Encrypt, but for messages, which are sending from server to client (aes key
+// and iv are generated in different way for each direction)
+func EncryptAsServer(msg, key []byte) ([]byte, error) {
+	return encrypt(msg, key, true)
+}
+
+func encrypt(msg, key []byte, fromServer bool) ([]byte, error) {
 	msgKey := MessageKey(msg)
-	aesKey, aesIV := generateAESIGE(msgKey, key, false)
+	aesKey, aesIV := generateAESIGE(msgKey, key, fromServer)
 
-	// СУДЯ ПО ВСЕМУ вообще не уверен, но это видимо паддинг для добива блока, чтоб он делился на 256 бит
-	data := make([]byte, len(msg)+((16-(len(msg)%16))&15))
-	copy(data, msg)
+	data := padMessage(msg)
 
 	c, err := NewCipher(aesKey, aesIV)
 	if err != nil {
@@ -42,9 +53,45 @@ func Encrypt(msg, key []byte) ([]byte, error) {
 	return out, nil
 }
 
+// СУДЯ ПО ВСЕМУ вообще не уверен, но это видимо паддинг для добива блока, чтоб он делился на 256 бит
+func padMessage(msg []byte) []byte {
+	data := make([]byte, len(msg)+((16-(len(msg)%16))&15))
+	copy(data, msg)
+
+	return data
+}
+
+// QuickAckToken returns token, which server sends in response to quick ack request of message. msg is a
+// plaintext of message from client, the same as for Encrypt. Most significant bit of token is always set.
+// https://core.telegram.org/mtproto/mtproto-transports#quick-ack
+func QuickAckToken(msg, key []byte) uint32 {
+	const (
+		keyPartStart = 88
+		keyPartEnd   = keyPartStart + 32
+	)
+
+	h := sha256.New()
+	// real auth keys are always 256 bytes
+	if len(key) >= keyPartEnd {
+		h.Write(key[keyPartStart:keyPartEnd])
+	}
+	h.Write(padMessage(msg))
+
+	return binary.LittleEndian.Uint32(h.Sum(nil)) | 1<<31
+}
+
 // checkData это msgkey в понятиях мтпрото, нужно что бы проверить, успешно ли прошла расшифровка
 func Decrypt(msg, key, checkData []byte) ([]byte, error) {
-	aesKey, aesIV := generateAESIGE(checkData, key, true)
+	return decrypt(msg, key, checkData, true)
+}
+
+// DecryptAsServer works same as Decrypt, but for messages, which are received by server from client.
+func DecryptAsServer(msg, key, checkData []byte) ([]byte, error) {
+	return decrypt(msg, key, checkData, false)
+}
+
+func decrypt(msg, key, checkData []byte, fromServer bool) ([]byte, error) {
+	aesKey, aesIV := generateAESIGE(checkData, key, fromServer)
 
 	c, err := NewCipher(aesKey, aesIV)
 	if err != nil {
@@ -76,24 +123,34 @@ func doAES256IGEdecrypt(data, out, key, iv []byte) error {
 }
 
 // DecryptMessageWithTempKeys дешифрует сообщение паролем, которые получены в процессе обмена ключами диффи хеллмана
-func DecryptMessageWithTempKeys(msg []byte, nonceSecond, nonceServer *big.Int) []byte {
+func DecryptMessageWithTempKeys(msg []byte, nonceSecond, nonceServer *big.Int) ([]byte, error) {
+	// at least sha1 of answer and one block of answer itself
+	if len(msg) < sha1.Size+aes.BlockSize {
+		return nil, ErrDataTooSmall
+	}
+	if len(msg)%aes.BlockSize != 0 {
+		return nil, ErrDataNotDivisible
+	}
+
 	key, iv := generateTempKeys(nonceSecond, nonceServer)
 	decodedWithHash := make([]byte, len(msg))
 	err := doAES256IGEdecrypt(msg, decodedWithHash, key, iv)
-	check(err)
+	if err != nil {
+		return nil, err
+	}
 
 	// decodedWithHash := SHA1(answer) + answer + (0-15 рандомных байт); длина должна делиться на 16;
-	decodedHash := decodedWithHash[:20]
-	decodedMessage := decodedWithHash[20:]
+	decodedHash := decodedWithHash[:sha1.Size]
+	decodedMessage := decodedWithHash[sha1.Size:]
 
 	// режем последние 0-15 байт ориентируюясь по хешу
-	for i := len(decodedMessage) - 1; i > len(decodedMessage)-16; i-- {
+	for i := len(decodedMessage); i > len(decodedMessage)-16 && i >= 0; i-- {
 		if bytes.Equal(decodedHash, dry.Sha1Byte(decodedMessage[:i])) {
-			return decodedMessage[:i]
+			return decodedMessage[:i], nil
 		}
 	}
 
-	panic("couldn't trim message: hashes incompatible on more than 16 tries")
+	return nil, ErrHashMismatch
 }
 
 // EncryptMessageWithTempKeys шифрует сообщение паролем, которые получены в процессе обмена ключами диффи хеллмана
@@ -102,8 +159,7 @@ func EncryptMessageWithTempKeys(msg []byte, nonceSecond, nonceServer *big.Int) [
 
 	// добавляем остаток рандомных байт в сообщение, что бы суммарно оно делилось на 16
 	totalLen := len(hash) + len(msg)
-	overflowedLen := totalLen % 16
-	needToAdd := 16 - overflowedLen
+	needToAdd := (16 - totalLen%16) % 16
 
 	msg = bytes.Join([][]byte{hash, msg, dry.RandomBytes(needToAdd)}, []byte{})
 	return encryptMessageWithTempKeys(msg, nonceSecond, nonceServer)
@@ -129,17 +185,21 @@ func generateTempKeys(nonceSecond, nonceServer *big.Int) (key, iv []byte) {
 		panic("nonceServer is nil")
 	}
 
+	// nonces are fixed size, so leading zeros are important
+	nonceSecondBytes := leftPad(nonceSecond.Bytes(), 32)
+	nonceServerBytes := leftPad(nonceServer.Bytes(), 16)
+
 	// nonceSecond + nonceServer
 	t1 := make([]byte, 48)
-	copy(t1[0:], nonceSecond.Bytes())
-	copy(t1[32:], nonceServer.Bytes())
+	copy(t1[0:], nonceSecondBytes)
+	copy(t1[32:], nonceServerBytes)
 	// SHA1 of nonceSecond + nonceServer
 	hash1 := dry.Sha1Byte(t1)
 
 	// nonceServer + nonceSecond
 	t2 := make([]byte, 48)
-	copy(t2[0:], nonceServer.Bytes())
-	copy(t2[16:], nonceSecond.Bytes())
+	copy(t2[0:], nonceServerBytes)
+	copy(t2[16:], nonceSecondBytes)
 	// SHA1 of nonceServer + nonceSecond
 	hash2 := dry.Sha1Byte(t2)
 
@@ -151,8 +211,8 @@ func generateTempKeys(nonceSecond, nonceServer *big.Int) (key, iv []byte) {
 	copy(tmpAESKey[20:], hash2[0:12])
 
 	t3 := make([]byte, 64) // nonceSecond + nonceSecond
-	copy(t3[0:], nonceSecond.Bytes())
-	copy(t3[32:], nonceSecond.Bytes())
+	copy(t3[0:], nonceSecondBytes)
+	copy(t3[32:], nonceSecondBytes)
 	hash3 := dry.Sha1Byte(t3) // SHA1 of nonceSecond + nonceSecond
 
 	// substr (SHA1(server_nonce + new_nonce), 12, 8) + SHA1(new_nonce + new_nonce) + substr (new_nonce, 0, 4);
@@ -162,7 +222,7 @@ func generateTempKeys(nonceSecond, nonceServer *big.Int) (key, iv []byte) {
 	// SHA1 of nonceSecond + nonceSecond
 	copy(tmpAESIV[8:], hash3)
 	// substr (nonceSecond, 0, 4)
-	copy(tmpAESIV[28:], nonceSecond.Bytes()[0:4])
+	copy(tmpAESIV[28:], nonceSecondBytes[0:4])
 
 	return tmpAESKey, tmpAESIV
 }
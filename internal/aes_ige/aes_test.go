@@ -6,6 +6,7 @@
 package ige
 
 import (
+	"crypto/aes"
 	"encoding/hex"
 	"math/big"
 	"testing"
@@ -75,18 +76,37 @@ func TestDecryptMessageWithTempKeys(t *testing.T) {
 	cases := newCasesDecryptMessageWithTempKeys()
 
 	for _, tcase := range cases {
-		result := DecryptMessageWithTempKeys(tcase.ciphertext, tcase.secondNonce, tcase.serverNonce)
+		result, err := DecryptMessageWithTempKeys(tcase.ciphertext, tcase.secondNonce, tcase.serverNonce)
+		assert.NoError(t, err)
 		assert.Equal(t, tcase.expected, result)
 	}
 }
 
+func TestDecryptMessageWithTempKeys_BadLength(t *testing.T) {
+	nonce := big.NewInt(1)
+	for _, tt := range []struct {
+		name    string
+		msg     []byte
+		wantErr error
+	}{
+		{"empty", nil, ErrDataTooSmall},
+		{"single block", make([]byte, aes.BlockSize), ErrDataTooSmall},
+		{"not aligned", make([]byte, 3*aes.BlockSize+1), ErrDataNotDivisible},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecryptMessageWithTempKeys(tt.msg, nonce, nonce)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
 func BenchmarkDecryptMessageWithTempKeys(b *testing.B) {
 	cases := newCasesDecryptMessageWithTempKeys()
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		for _, tcase := range cases {
-			res := DecryptMessageWithTempKeys(tcase.ciphertext, tcase.secondNonce, tcase.serverNonce)
+			res, _ := DecryptMessageWithTempKeys(tcase.ciphertext, tcase.secondNonce, tcase.serverNonce)
 			assert.Equal(b, tcase.expected, res)
 		}
 	}
@@ -343,14 +363,14 @@ func TestEncryptDecrypt(t *testing.T) {
 				return
 			}
 
-			// TODO: почему-то расшифровка так легко не проходит
-			//msgkey := MessageKey(tt.msg)
-			//decrypted, err := Decrypt(got, tt.key, msgkey)
-			//if !wantErr(t, err) {
-			//	return
-			//}
-			//
-			//assert.Equal(t, tt.msg, decrypted)
+			// client encrypts messages for server, so only server can decrypt it back
+			msgkey := MessageKey(tt.msg)
+			decrypted, err := DecryptAsServer(got, tt.key, msgkey)
+			if !wantErr(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.msg, decrypted[:len(tt.msg)])
 		})
 	}
 }
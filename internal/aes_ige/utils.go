@@ -11,3 +11,11 @@ func xor(dst, src []byte) {
 		dst[i] ^= src[i]
 	}
 }
+
+// leftPad adds leading zeros to b, if it's shorter than size
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
@@ -85,6 +85,12 @@ func TestEncode(t *testing.T) {
 				"323302656e000000000002656e006b18f9c4"),
 			wantErr: assert.NoError,
 		},
+		{
+			name:    "WrappedSlice",
+			obj:     tl.WrapSlice([]int64{322, 1337}),
+			want:    Hexed("15C4B51C0200000042010000000000003905000000000000"),
+			wantErr: assert.NoError,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
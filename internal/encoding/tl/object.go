@@ -52,11 +52,22 @@ func (*PseudoNil) Unwrap() any {
 }
 
 // WrappedSlice is pseudo type. YOU SHOULD NOT use it customly, instead, you must encode/decode value by
-// encoder.PutVector or decoder.PopVector
+// encoder.PutVector or decoder.PopVector. The only case, when you need it, is when vector must be passed as
+// tl.Object (e.g. server returns vector as result of rpc call), then use WrapSlice.
 type WrappedSlice struct {
 	data any
 }
 
+// WrapSlice makes tl.Object from slice, so it could be encoded as a root object.
+func WrapSlice(data any) *WrappedSlice {
+	return &WrappedSlice{data: data}
+}
+
+func (w *WrappedSlice) MarshalTL(e *Encoder) error {
+	e.PutVector(w.data)
+	return e.CheckErr()
+}
+
 func (*WrappedSlice) CRC() uint32 {
 	return CrcVector
 }
@@ -35,7 +35,25 @@ func DoRSAencrypt(block []byte, key *rsa.PublicKey) []byte {
 	c := big.NewInt(0).Exp(z, exponent, key.N)
 
 	res := make([]byte, 256)
-	copy(res, c.Bytes())
+	cBytes := c.Bytes()
+	copy(res[len(res)-len(cBytes):], cBytes) // big endian, so leading zeros must be kept
+
+	return res
+}
+
+// DoRSAdecrypt is a reverse of DoRSAencrypt: it decrypts message block with private key and returns exactly
+// 255 bytes (or nil, if decrypted data is bigger than block size, so data is definitely invalid).
+func DoRSAdecrypt(data []byte, key *rsa.PrivateKey) []byte {
+	c := big.NewInt(0).SetBytes(data)
+	z := big.NewInt(0).Exp(c, key.D, key.N)
+
+	zBytes := z.Bytes()
+	if len(zBytes) > math.MaxUint8 {
+		return nil
+	}
+
+	res := make([]byte, math.MaxUint8)
+	copy(res[len(res)-len(zBytes):], zBytes)
 
 	return res
 }
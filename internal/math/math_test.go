@@ -6,6 +6,9 @@
 package math_test
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
 	"math/big"
 	"testing"
 
@@ -28,3 +31,24 @@ func TestSplitPQ(t *testing.T) {
 		}
 	}
 }
+
+func TestRSAEncryptDecrypt(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// leading zeros must survive both ways
+	block := make([]byte, 255)
+	copy(block[3:], "some data which is smaller than block")
+
+	encrypted := math.DoRSAencrypt(block, &key.PublicKey)
+	if len(encrypted) != 256 {
+		t.Fatalf("encrypted block size is %v, want 256", len(encrypted))
+	}
+
+	decrypted := math.DoRSAdecrypt(encrypted, key)
+	if !bytes.Equal(block, decrypted) {
+		t.Errorf("decrypted block mismatch: %x, want %x", decrypted, block)
+	}
+}
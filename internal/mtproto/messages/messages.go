@@ -37,11 +37,46 @@ type Encrypted struct {
 	SessionID int64
 	SeqNo     int32
 	MsgKey    []byte
+
+	// QuickAckToken is a token, which server sends in response to quick ack request. It's set by Serialize
+	// and DeserializeEncryptedAsServer, cause only messages from client could be quick acked.
+	QuickAckToken uint32
 }
 
 func (msg *Encrypted) Serialize(client MessageInformator, requireToAck bool) ([]byte, error) {
-	obj := serializePacket(client, msg.Msg, msg.MsgID, requireToAck)
-	encryptedData, err := ige.Encrypt(obj, client.GetAuthKey())
+	return msg.encrypt(serializePacket(client, msg.Msg, msg.MsgID, requireToAck), client.GetAuthKey())
+}
+
+// SerializeWithSeqNo works like Serialize, but seqno is taken from message itself. It's used for messages,
+// which transport sends on its own, so their msg id and seqno are reserved by client.ReserveMessage.
+func (msg *Encrypted) SerializeWithSeqNo(client MessageInformator) ([]byte, error) {
+	obj := serializeRawPacket(client.GetServerSalt(), client.GetSessionID(), msg.MsgID, msg.SeqNo, msg.Msg)
+	return msg.encrypt(obj, client.GetAuthKey())
+}
+
+func (msg *Encrypted) encrypt(obj, authKey []byte) ([]byte, error) {
+	encryptedData, err := ige.Encrypt(obj, authKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypting")
+	}
+	msg.QuickAckToken = ige.QuickAckToken(obj, authKey)
+
+	buf := bytes.NewBuffer(nil)
+
+	e := tl.NewEncoder(buf)
+	e.PutRawBytes(utils.AuthKeyHash(authKey))
+	e.PutRawBytes(ige.MessageKey(obj))
+	e.PutRawBytes(encryptedData)
+
+	return buf.Bytes(), nil
+}
+
+// SerializeAsServer serializes message, which is sending from server to client. Unlike Serialize, all
+// session info (salt, session id, seqno) is taken from message itself, cause server handles many sessions
+// at the same time.
+func (msg *Encrypted) SerializeAsServer(authKey []byte) ([]byte, error) {
+	obj := serializeRawPacket(msg.Salt, msg.SessionID, msg.MsgID, msg.SeqNo, msg.Msg)
+	encryptedData, err := ige.EncryptAsServer(obj, authKey)
 	if err != nil {
 		return nil, errors.Wrap(err, "encrypting")
 	}
@@ -49,7 +84,7 @@ func (msg *Encrypted) Serialize(client MessageInformator, requireToAck bool) ([]
 	buf := bytes.NewBuffer(nil)
 
 	e := tl.NewEncoder(buf)
-	e.PutRawBytes(utils.AuthKeyHash(client.GetAuthKey()))
+	e.PutRawBytes(utils.AuthKeyHash(authKey))
 	e.PutRawBytes(ige.MessageKey(obj))
 	e.PutRawBytes(encryptedData)
 
@@ -57,28 +92,60 @@ func (msg *Encrypted) Serialize(client MessageInformator, requireToAck bool) ([]
 }
 
 func DeserializeEncrypted(data, authKey []byte) (*Encrypted, error) {
-	msg := new(Encrypted)
+	msg, _, err := deserializeEncrypted(data, authKey, ige.Decrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	mod := msg.MsgID & 3
+	if mod != 1 && mod != 3 {
+		return nil, fmt.Errorf("wrong bits of message_id: %d", mod)
+	}
+
+	return msg, nil
+}
+
+// DeserializeEncryptedAsServer deserializes message, which is received by server from client. Unlike
+// DeserializeEncrypted, msg_id isn't checked: server must answer to invalid msg_id by bad_msg_notification.
+func DeserializeEncryptedAsServer(data, authKey []byte) (*Encrypted, error) {
+	msg, decrypted, err := deserializeEncrypted(data, authKey, ige.DecryptAsServer)
+	if err != nil {
+		return nil, err
+	}
+	msg.QuickAckToken = ige.QuickAckToken(decrypted, authKey)
+
+	return msg, nil
+}
+
+func deserializeEncrypted(data, authKey []byte, decrypt func(msg, key, checkData []byte) ([]byte, error)) (
+	msg *Encrypted, decrypted []byte, err error,
+) {
+	msg = new(Encrypted)
+
+	if len(data) < tl.LongLen+tl.Int128Len {
+		return nil, nil, fmt.Errorf("message is too small: %v bytes", len(data))
+	}
 
 	buf := bytes.NewBuffer(data)
 	d, err := tl.NewDecoder(buf)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	keyHash := d.PopRawBytes(tl.LongLen)
 	if !bytes.Equal(keyHash, utils.AuthKeyHash(authKey)) {
-		return nil, errors.New("wrong encryption key")
+		return nil, nil, errors.New("wrong encryption key")
 	}
 	msg.MsgKey = d.PopRawBytes(tl.Int128Len) // msgKey это хэш от расшифрованного набора байт, последние 16 символов
 	encryptedData := d.PopRawBytes(len(data) - (tl.LongLen + tl.Int128Len))
 
-	decrypted, err := ige.Decrypt(encryptedData, authKey, msg.MsgKey)
+	decrypted, err = decrypt(encryptedData, authKey, msg.MsgKey)
 	if err != nil {
-		return nil, errors.Wrap(err, "decrypting message")
+		return nil, nil, errors.Wrap(err, "decrypting message")
 	}
 	buf = bytes.NewBuffer(decrypted)
 	d, err = tl.NewDecoder(buf)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	msg.Salt = d.PopLong()
 	msg.SessionID = d.PopLong()
@@ -86,23 +153,19 @@ func DeserializeEncrypted(data, authKey []byte) (*Encrypted, error) {
 	msg.SeqNo = d.PopInt()
 	messageLen := d.PopInt()
 
-	if len(decrypted) < int(messageLen)-(tl.LongLen+tl.LongLen+tl.LongLen+tl.WordLen+tl.WordLen) {
-		return nil, fmt.Errorf("message is smaller than it's defining: have %v, but messageLen is %v", len(decrypted), messageLen)
-	}
-
-	mod := msg.MsgID & 3
-	if mod != 1 && mod != 3 {
-		return nil, fmt.Errorf("wrong bits of message_id: %d", mod)
+	const headerLen = tl.LongLen + tl.LongLen + tl.LongLen + tl.WordLen + tl.WordLen
+	if messageLen < 0 || len(decrypted) < headerLen+int(messageLen) {
+		return nil, nil, fmt.Errorf("message is smaller than it's defining: have %v, but messageLen is %v", len(decrypted), messageLen)
 	}
 
 	// этот кусок проверяет валидность данных по ключу
-	trimed := decrypted[0 : 32+messageLen] // суммарное сообщение, после расшифровки
+	trimed := decrypted[0 : headerLen+messageLen] // суммарное сообщение, после расшифровки
 	if !bytes.Equal(dry.Sha1Byte(trimed)[4:20], msg.MsgKey) {
-		return nil, errors.New("wrong message key, can't trust to sender")
+		return nil, nil, errors.New("wrong message key, can't trust to sender")
 	}
 	msg.Msg = d.PopRawBytes(int(messageLen))
 
-	return msg, nil
+	return msg, decrypted, nil
 }
 
 func (msg *Encrypted) GetMsg() []byte {
@@ -134,20 +197,47 @@ func (msg *Unencrypted) Serialize(client MessageInformator) ([]byte, error) {
 }
 
 func DeserializeUnencrypted(data []byte) (*Unencrypted, error) {
-	msg := new(Unencrypted)
-	d, _ := tl.NewDecoder(bytes.NewBuffer(data))
-	_ = d.PopRawBytes(tl.LongLen) // authKeyHash, always 0 if unencrypted
-
-	msg.MsgID = d.PopLong()
+	msg, err := deserializeUnencrypted(data)
+	if err != nil {
+		return nil, err
+	}
 
 	mod := msg.MsgID & 3
 	if mod != 1 && mod != 3 {
 		return nil, fmt.Errorf("Wrong bits of message_id: %#v", uint64(mod))
 	}
 
+	return msg, nil
+}
+
+// DeserializeUnencryptedAsServer deserializes unencrypted message, which is received by server from client.
+func DeserializeUnencryptedAsServer(data []byte) (*Unencrypted, error) {
+	msg, err := deserializeUnencrypted(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if mod := msg.MsgID & 3; mod != 0 {
+		return nil, fmt.Errorf("Wrong bits of message_id: %#v", uint64(mod))
+	}
+
+	return msg, nil
+}
+
+func deserializeUnencrypted(data []byte) (*Unencrypted, error) {
+	const headerLen = tl.LongLen + tl.LongLen + tl.WordLen
+	if len(data) < headerLen {
+		return nil, fmt.Errorf("message is too small: %v bytes", len(data))
+	}
+
+	msg := new(Unencrypted)
+	d, _ := tl.NewDecoder(bytes.NewBuffer(data))
+	_ = d.PopRawBytes(tl.LongLen) // authKeyHash, always 0 if unencrypted
+
+	msg.MsgID = d.PopLong()
+
 	messageLen := d.PopUint()
-	if len(data)-(tl.LongLen+tl.LongLen+tl.WordLen) != int(messageLen) {
-		fmt.Println(len(data), int(messageLen), int(messageLen+(tl.LongLen+tl.LongLen+tl.WordLen)))
+	if len(data)-headerLen != int(messageLen) {
 		return nil, fmt.Errorf("message not equal defined size: have %v, want %v", len(data), messageLen)
 	}
 
@@ -181,23 +271,66 @@ type MessageInformator interface {
 	GetSeqNo() int32
 	GetServerSalt() int64
 	GetAuthKey() []byte
+	// ReserveMessage returns id of new message, corrected by server time, and its seqno. Content related
+	// messages take next seqno, so it's never returned again.
+	ReserveMessage(contentRelated bool) (msgID int64, seqNo int32)
 }
 
 func serializePacket(client MessageInformator, msg []byte, messageID int64, requireToAck bool) []byte {
+	seqNo := client.GetSeqNo()
+	if requireToAck { // не спрашивай, как это работает
+		seqNo |= 1 // почему тут добавляется бит не ебу
+	}
+
+	return serializeRawPacket(client.GetServerSalt(), client.GetSessionID(), messageID, seqNo, msg)
+}
+
+func serializeRawPacket(salt, sessionID, messageID int64, seqNo int32, msg []byte) []byte {
 	buf := bytes.NewBuffer(nil)
 	d := tl.NewEncoder(buf)
 
 	saltBytes := make([]byte, tl.LongLen)
-	binary.LittleEndian.PutUint64(saltBytes, uint64(client.GetServerSalt()))
+	binary.LittleEndian.PutUint64(saltBytes, uint64(salt))
 	d.PutRawBytes(saltBytes)
-	d.PutLong(client.GetSessionID())
+	d.PutLong(sessionID)
 	d.PutLong(messageID)
-	if requireToAck { // не спрашивай, как это работает
-		d.PutInt(client.GetSeqNo() | 1) // почему тут добавляется бит не ебу
-	} else {
-		d.PutInt(client.GetSeqNo())
-	}
+	d.PutInt(seqNo)
 	d.PutInt(int32(len(msg)))
 	d.PutRawBytes(msg)
+
 	return buf.Bytes()
 }
+
+// TrimPadding removes random padding, which is added to messages by padded intermediate mode. Real size of
+// message could be found only by its structure: encrypted data is aligned by 16 bytes, unencrypted message
+// defines its size in header. Packets smaller than any message are transport error codes. Data without
+// padding is returned as is.
+func TrimPadding(data []byte) []byte {
+	const (
+		unencryptedHeaderLen = tl.LongLen + tl.LongLen + tl.WordLen
+		encryptedHeaderLen   = tl.LongLen + tl.Int128Len
+		aesBlockLen          = 16
+	)
+
+	switch {
+	case len(data) < unencryptedHeaderLen:
+		if len(data) > tl.WordLen {
+			return data[:tl.WordLen]
+		}
+		return data
+
+	case binary.LittleEndian.Uint64(data) == 0:
+		size := unencryptedHeaderLen + int(binary.LittleEndian.Uint32(data[tl.LongLen+tl.LongLen:]))
+		if size < unencryptedHeaderLen || size > len(data) {
+			// broken message, parser will return error
+			return data
+		}
+		return data[:size]
+
+	case len(data) < encryptedHeaderLen:
+		return data
+
+	default:
+		return data[:len(data)-(len(data)-encryptedHeaderLen)%aesBlockLen]
+	}
+}
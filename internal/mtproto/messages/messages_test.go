@@ -10,9 +10,11 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/xelaj/go-dry"
 
 	. "github.com/xelaj/mtproto/internal/mtproto/messages"
+	"github.com/xelaj/mtproto/internal/utils"
 )
 
 type DummyClient struct {
@@ -38,6 +40,15 @@ func (d *DummyClient) GetAuthKey() []byte {
 	return d.authKey
 }
 
+func (d *DummyClient) ReserveMessage(contentRelated bool) (msgID int64, seqNo int32) {
+	seqNo = d.lastSeqNo
+	if contentRelated {
+		seqNo |= 1
+		d.lastSeqNo += 2
+	}
+	return utils.GenerateMessageId(), seqNo
+}
+
 var client = &DummyClient{
 	authKey: Hexed("28F43A9E1F5B15C093445BDBA697C78DCE12B53C8F05AE86F1E25338DC8EF962" +
 		"E9B89C8E560955FFA0E1A45C8D121A9AEFDB89C88BB1493374959C6D6E5C46D1" +
@@ -123,6 +134,63 @@ func TestSerializeEncryptedMessage(t *testing.T) {
 	}
 }
 
+func TestEncryptedRoundTrip(t *testing.T) {
+	request := &Encrypted{
+		Msg:   []byte("ping from client"),
+		MsgID: 0x5e0b800a5e0b8000, // client's msg_id is divisible by 4
+	}
+
+	data, err := request.Serialize(client, true)
+	require.NoError(t, err)
+
+	got, err := DeserializeEncryptedAsServer(data, client.GetAuthKey())
+	require.NoError(t, err)
+	assert.Equal(t, request.Msg, got.Msg)
+	assert.Equal(t, request.MsgID, got.MsgID)
+	assert.Equal(t, client.GetSeqNo()|1, got.SeqNo)
+	assert.Equal(t, request.QuickAckToken, got.QuickAckToken, "server must compute same quick ack token")
+	assert.NotZero(t, request.QuickAckToken&(1<<31), "token must have most significant bit")
+
+	_, err = DeserializeEncrypted(data, client.GetAuthKey())
+	assert.Error(t, err, "client must not decrypt its own message")
+
+	response := &Encrypted{
+		Msg:       []byte("pong from server"),
+		MsgID:     0x5e0b800a5e0b8001, // server's msg_id of response is 1 modulo 4
+		Salt:      got.Salt,
+		SessionID: got.SessionID,
+		SeqNo:     1,
+	}
+
+	data, err = response.SerializeAsServer(client.GetAuthKey())
+	require.NoError(t, err)
+
+	got, err = DeserializeEncrypted(data, client.GetAuthKey())
+	require.NoError(t, err)
+	assert.Equal(t, response.Msg, got.Msg)
+	assert.Equal(t, response.MsgID, got.MsgID)
+	assert.Equal(t, response.SeqNo, got.SeqNo)
+}
+
+func TestTrimPadding(t *testing.T) {
+	encrypted, err := (&Encrypted{Msg: []byte("ping from client"), MsgID: 0x5e0b800a5e0b8000}).Serialize(client, true)
+	require.NoError(t, err)
+	unencrypted, err := (&Unencrypted{Msg: []byte("req_pq"), MsgID: 0x5e0b800a5e0b8000}).Serialize(client)
+	require.NoError(t, err)
+	code := []byte{0x6c, 0xfe, 0xff, 0xff}
+
+	for _, original := range [][]byte{encrypted, unencrypted, code} {
+		for padding := 0; padding <= 15; padding++ {
+			padded := append(append([]byte{}, original...), make([]byte, padding)...)
+			assert.Equal(t, original, TrimPadding(padded), "padding %v", padding)
+		}
+	}
+
+	got, err := DeserializeEncryptedAsServer(TrimPadding(append(encrypted, 1, 2, 3)), client.GetAuthKey())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ping from client"), got.Msg)
+}
+
 func Hexed(in string) []byte {
 	res, err := hex.DecodeString(in)
 	dry.PanicIfErr(err)
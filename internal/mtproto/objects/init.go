@@ -12,9 +12,14 @@ import (
 func init() {
 	tl.RegisterObjects(
 		&ReqPQParams{},
+		&ReqPQMultiParams{},
 		&ReqDHParamsParams{},
 		&SetClientDHParamsParams{},
+		&GetFutureSaltsParams{},
 		&PingParams{},
+		&DestroySessionParams{},
+		&DestroyAuthKeyParams{},
+		&HttpWaitParams{},
 		&ResPQ{},
 		&PQInnerData{},
 		&ServerDHParamsFail{},
@@ -32,6 +37,11 @@ func init() {
 		&FutureSalt{},
 		&FutureSalts{},
 		&Pong{},
+		&DestroySessionOk{},
+		&DestroySessionNone{},
+		&DestroyAuthKeyOk{},
+		&DestroyAuthKeyNone{},
+		&DestroyAuthKeyFail{},
 		&NewSessionCreated{},
 		&MessageContainer{},
 		&MsgCopy{},
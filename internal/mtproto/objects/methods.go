@@ -39,6 +39,30 @@ func ReqPQ(m requester, nonce *tl.Int128) (*ResPQ, error) {
 	return resp, nil
 }
 
+// ReqPQMultiParams is same as ReqPQParams, but server returns all its public keys fingerprints. Modern
+// clients use this one instead of req_pq.
+type ReqPQMultiParams struct {
+	Nonce *tl.Int128
+}
+
+func (*ReqPQMultiParams) CRC() uint32 {
+	return 0xbe7e8ef1 //nolint:gomnd not magic
+}
+
+func ReqPQMulti(m requester, nonce *tl.Int128) (*ResPQ, error) {
+	data, err := m.MakeRequest(&ReqPQMultiParams{Nonce: nonce})
+	if err != nil {
+		return nil, errors.Wrap(err, "sending ReqPQMulti")
+	}
+
+	resp, ok := data.(*ResPQ)
+	if !ok {
+		return nil, errors.New("got invalid response type: " + reflect.TypeOf(data).String())
+	}
+
+	return resp, nil
+}
+
 type ReqDHParamsParams struct {
 	Nonce                *tl.Int128
 	ServerNonce          *tl.Int128
@@ -105,7 +129,30 @@ func SetClientDHParams(m requester, nonce, serverNonce *tl.Int128, encryptedData
 }
 
 // rpc_drop_answer
-// get_future_salts
+
+type GetFutureSaltsParams struct {
+	Num int32
+}
+
+func (*GetFutureSaltsParams) CRC() uint32 {
+	return 0xb921bd04 //nolint:gomnd not magic
+}
+
+func GetFutureSalts(m requester, num int32) (*FutureSalts, error) {
+	data, err := m.MakeRequest(&GetFutureSaltsParams{
+		Num: num,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "sending GetFutureSalts")
+	}
+
+	resp, ok := data.(*FutureSalts)
+	if !ok {
+		return nil, errors.New("got invalid response type: " + reflect.TypeOf(data).String())
+	}
+
+	return resp, nil
+}
 
 type PingParams struct {
 	PingID int64
@@ -132,14 +179,68 @@ func Ping(m requester, pingID int64) (*Pong, error) {
 }
 
 // ping_delay_disconnect
-// destroy_session
-// http_wait
+
+type DestroySessionParams struct {
+	SessionID int64
+}
+
+func (*DestroySessionParams) CRC() uint32 {
+	return 0xe7512126 //nolint:gomnd not magic
+}
+
+func DestroySession(m requester, sessionID int64) (DestroySessionRes, error) {
+	data, err := m.MakeRequest(&DestroySessionParams{
+		SessionID: sessionID,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "sending DestroySession")
+	}
+
+	resp, ok := data.(DestroySessionRes)
+	if !ok {
+		return nil, errors.New("got invalid response type: " + reflect.TypeOf(data).String())
+	}
+
+	return resp, nil
+}
+
+// DestroyAuthKeyParams MUST be sent unencrypted
+type DestroyAuthKeyParams null
+
+func (*DestroyAuthKeyParams) CRC() uint32 {
+	return 0xd1435160 //nolint:gomnd not magic
+}
+
+func DestroyAuthKey(m requester) (DestroyAuthKeyRes, error) {
+	data, err := m.MakeRequest(&DestroyAuthKeyParams{})
+	if err != nil {
+		return nil, errors.Wrap(err, "sending DestroyAuthKey")
+	}
+
+	resp, ok := data.(DestroyAuthKeyRes)
+	if !ok {
+		return nil, errors.New("got invalid response type: " + reflect.TypeOf(data).String())
+	}
+
+	return resp, nil
+}
+
+// HttpWaitParams is used only by http transport: server holds http request with this message until it has
+// something to send to client (or until max_wait milliseconds are passed). Server doesn't answer it.
+type HttpWaitParams struct {
+	MaxDelay  int32 // max delay in milliseconds to collect more messages after first one
+	WaitAfter int32 // delay in milliseconds after last message is received
+	MaxWait   int32 // max time in milliseconds to wait for messages
+}
+
+func (*HttpWaitParams) CRC() uint32 {
+	return 0x9299359f //nolint:gomnd not magic
+}
 
 // set_client_DH_params#f5045f1f nonce:int128 server_nonce:int128 encrypted_data:bytes = Set_client_DH_params_answer;
 
 // rpc_drop_answer#58e4a740 req_msg_id:long = RpcDropAnswer;
 // get_future_salts#b921bd04 num:int = FutureSalts;
 // ping_delay_disconnect#f3427b8c ping_id:long disconnect_delay:int = Pong;
-// destroy_session#e7512126 session_id:long = DestroySessionRes;
 
 // http_wait#9299359f max_delay:int wait_after:int max_wait:int = HttpWait;
@@ -249,8 +249,59 @@ func (*Pong) CRC() uint32 {
 	return 0x347773c5 //nolint:gomnd not magic
 }
 
-// destroy_session_ok#e22045fc session_id:long = DestroySessionRes;
-// destroy_session_none#62d350c9 session_id:long = DestroySessionRes;
+type DestroySessionRes interface {
+	tl.Object
+	ImplementsDestroySessionRes()
+}
+
+type DestroySessionOk struct {
+	SessionID int64
+}
+
+func (*DestroySessionOk) ImplementsDestroySessionRes() {}
+
+func (*DestroySessionOk) CRC() uint32 {
+	return 0xe22045fc //nolint:gomnd not magic
+}
+
+type DestroySessionNone struct {
+	SessionID int64
+}
+
+func (*DestroySessionNone) ImplementsDestroySessionRes() {}
+
+func (*DestroySessionNone) CRC() uint32 {
+	return 0x62d350c9 //nolint:gomnd not magic
+}
+
+type DestroyAuthKeyRes interface {
+	tl.Object
+	ImplementsDestroyAuthKeyRes()
+}
+
+type DestroyAuthKeyOk null
+
+func (*DestroyAuthKeyOk) ImplementsDestroyAuthKeyRes() {}
+
+func (*DestroyAuthKeyOk) CRC() uint32 {
+	return 0xf660e1d4 //nolint:gomnd not magic
+}
+
+type DestroyAuthKeyNone null
+
+func (*DestroyAuthKeyNone) ImplementsDestroyAuthKeyRes() {}
+
+func (*DestroyAuthKeyNone) CRC() uint32 {
+	return 0x0a9f2259 //nolint:gomnd not magic
+}
+
+type DestroyAuthKeyFail null
+
+func (*DestroyAuthKeyFail) ImplementsDestroyAuthKeyRes() {}
+
+func (*DestroyAuthKeyFail) CRC() uint32 {
+	return 0xea109b13 //nolint:gomnd not magic
+}
 
 type NewSessionCreated struct {
 	FirstMsgID int64
@@ -328,8 +379,52 @@ func (*GzipPacked) CRC() uint32 {
 	return CrcGzipPacked
 }
 
-func (*GzipPacked) MarshalTL(e *tl.Encoder) error {
-	panic("not implemented")
+func (t *GzipPacked) MarshalTL(e *tl.Encoder) error {
+	data, err := tl.Marshal(t.Obj)
+	if err != nil {
+		return errors.Wrap(err, "encoding object to compress")
+	}
+
+	compressed, err := compressGzip(data)
+	if err != nil {
+		return err
+	}
+
+	e.PutUint(t.CRC())
+	e.PutMessage(compressed)
+	return e.CheckErr()
+}
+
+// PackGzip wraps already serialized object into gzip_packed, so you don't need to encode object twice
+// (e.g. when you want to compare sizes of raw and compressed data).
+func PackGzip(serialized []byte) ([]byte, error) {
+	compressed, err := compressGzip(serialized)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	e := tl.NewEncoder(buf)
+	e.PutUint(CrcGzipPacked)
+	e.PutMessage(compressed)
+	if err := e.CheckErr(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func compressGzip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, errors.Wrap(err, "compressing data")
+	}
+	if err := gz.Close(); err != nil {
+		return nil, errors.Wrap(err, "compressing data")
+	}
+
+	return buf.Bytes(), nil
 }
 
 func (t *GzipPacked) UnmarshalTL(d *tl.Decoder) error {
@@ -0,0 +1,40 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package objects_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
+)
+
+func TestGzipPacked(t *testing.T) {
+	obj := &objects.MsgsAck{MsgIDs: make([]int64, 512)}
+	for i := range obj.MsgIDs {
+		obj.MsgIDs[i] = int64(i % 4)
+	}
+
+	raw, err := tl.Marshal(obj)
+	require.NoError(t, err)
+
+	packed, err := tl.Marshal(&objects.GzipPacked{Obj: obj})
+	require.NoError(t, err)
+	assert.Less(t, len(packed), len(raw))
+
+	packedFromRaw, err := objects.PackGzip(raw)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(packed, packedFromRaw))
+
+	decoded, err := tl.DecodeUnknownObject(packed)
+	require.NoError(t, err)
+	require.IsType(t, &objects.GzipPacked{}, decoded)
+	assert.Equal(t, obj, decoded.(*objects.GzipPacked).Obj)
+}
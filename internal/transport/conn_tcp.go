@@ -12,7 +12,7 @@ import (
 
 type tcpConn struct {
 	cancelReader *ioutil.CancelableReader
-	conn         *net.TCPConn
+	conn         net.Conn
 	timeout      time.Duration
 }
 
@@ -20,16 +20,22 @@ type TCPConnConfig struct {
 	Ctx     context.Context
 	Host    string
 	Timeout time.Duration
+	// Proxy is optional, if set, connection is made through it
+	Proxy *Proxy
+	// Dialer is optional, if set, it's used instead of default tcp dialing. Proxy is ignored in this case.
+	Dialer Dialer
+	// MaxFrameSize limits size of received messages, if zero, mode.DefaultMaxFrameSize is used
+	MaxFrameSize int
 }
 
 func NewTCP(cfg TCPConnConfig) (Conn, error) {
-	tcpAddr, err := net.ResolveTCPAddr("tcp", cfg.Host)
-	if err != nil {
-		return nil, errors.Wrap(err, "resolving tcp")
+	if cfg.Ctx == nil {
+		cfg.Ctx = context.Background()
 	}
-	conn, err := net.DialTCP("tcp", nil, tcpAddr)
+
+	conn, err := dial(cfg.Ctx, cfg.Host, cfg.Dialer, cfg.Proxy)
 	if err != nil {
-		return nil, errors.Wrap(err, "dialing tcp")
+		return nil, err
 	}
 
 	return &tcpConn{
@@ -39,6 +45,21 @@ func NewTCP(cfg TCPConnConfig) (Conn, error) {
 	}, nil
 }
 
+func dial(ctx context.Context, addr string, dialer Dialer, proxy *Proxy) (net.Conn, error) {
+	if dialer != nil {
+		conn, err := dialer.DialContext(ctx, addr)
+		return conn, errors.Wrap(err, "dialing")
+	}
+	if proxy != nil {
+		conn, err := proxy.DialContext(ctx, "tcp", addr)
+		return conn, errors.Wrap(err, "dialing through proxy")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	return conn, errors.Wrap(err, "dialing tcp")
+}
+
 func (t *tcpConn) Close() error {
 	return t.conn.Close()
 }
@@ -49,8 +70,10 @@ func (t *tcpConn) Write(b []byte) (int, error) {
 
 func (t *tcpConn) Read(b []byte) (int, error) {
 	if t.timeout > 0 {
-		err := t.conn.SetReadDeadline(time.Now().Add(t.timeout))
-		check(err)
+		// conn could be made by custom dialer, and some of them don't support deadlines at all
+		if err := t.conn.SetReadDeadline(time.Now().Add(t.timeout)); err != nil {
+			return 0, errors.Wrap(err, "setting read deadline")
+		}
 	}
 
 	n, err := t.cancelReader.Read(b)
@@ -0,0 +1,95 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/internal/transport"
+	"github.com/xelaj/mtproto/mode"
+)
+
+type pipeDialer struct {
+	addr string
+	conn net.Conn
+}
+
+func (d *pipeDialer) DialContext(_ context.Context, addr string) (net.Conn, error) {
+	d.addr = addr
+	return d.conn, nil
+}
+
+func TestTCPCustomDialer(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		m, err := mode.Detect(server)
+		if err != nil {
+			return
+		}
+		msg, err := m.ReadMsg()
+		if err != nil {
+			return
+		}
+		m.WriteMsg(msg) //nolint:errcheck test server
+	}()
+
+	d := &pipeDialer{conn: client}
+	conn, err := transport.NewTCP(transport.TCPConnConfig{
+		Ctx:    context.Background(),
+		Host:   "sidecar:443",
+		Dialer: d,
+		// dialer has priority over proxy
+		Proxy: &transport.Proxy{Type: transport.ProxySOCKS5, Addr: "127.0.0.1:1"},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "sidecar:443", d.addr)
+
+	m, err := mode.New(mode.Intermediate, conn)
+	require.NoError(t, err)
+
+	msg := []byte("through pipe")
+	require.NoError(t, m.WriteMsg(msg))
+
+	got, err := m.ReadMsg()
+	require.NoError(t, err)
+	assert.Equal(t, msg, got)
+}
+
+// noDeadlineConn is a conn of custom dialer, which doesn't support deadlines
+type noDeadlineConn struct {
+	net.Conn
+}
+
+var errNoDeadline = errors.New("deadlines are not supported")
+
+func (noDeadlineConn) SetReadDeadline(time.Time) error { return errNoDeadline }
+
+func TestTCPCustomDialer_DeadlineError(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn, err := transport.NewTCP(transport.TCPConnConfig{
+		Ctx:     context.Background(),
+		Host:    "sidecar:443",
+		Timeout: time.Second,
+		Dialer:  &pipeDialer{conn: noDeadlineConn{client}},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, errNoDeadline), "got %v", err)
+}
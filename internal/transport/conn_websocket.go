@@ -0,0 +1,379 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec websocket handshake requires sha1
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WebSocketConnConfig is a config of websocket connection, which is used by web clients of telegram
+// (e.g. wss://venus.web.telegram.org/apiws). Every write is sent as single binary websocket message, all
+// received messages are read as continuous stream, so any mode could work on top of it. Note that
+// telegram servers accept only obfuscated connections through websocket, so NewObfuscatedTransport must be
+// used for them.
+type WebSocketConnConfig struct {
+	Ctx context.Context
+	// URL of server, scheme must be ws or wss. If path is empty, /apiws is used.
+	URL     string
+	Timeout time.Duration
+	// TLSConfig is used for wss connections. If nil, default config is used.
+	TLSConfig *tls.Config
+	// Proxy is optional, if set, connection is made through it
+	Proxy *Proxy
+	// Dialer is optional, if set, it's used instead of default tcp dialing. Proxy is ignored in this case.
+	Dialer Dialer
+	// MaxFrameSize limits size of received messages, if zero, mode.DefaultMaxFrameSize is used
+	MaxFrameSize int
+}
+
+const (
+	wsDefaultPath = "/apiws"
+	wsProtocol    = "binary"
+	wsGUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// mtproto messages are limited by 1mb, frames could be a bit bigger cause of obfuscation and padding
+	wsMaxFrameLen = 1 << 24
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+
+	wsFinalBit = 0x80
+	wsMaskBit  = 0x80
+)
+
+type wsConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	ctx     context.Context
+	timeout time.Duration
+	// client masks all frames, server doesn't
+	client bool
+
+	writeMutex sync.Mutex
+	closeSent  bool
+
+	// unread payload of last data frame
+	buf []byte
+}
+
+// NewWebSocket connects to websocket server and makes handshake.
+func NewWebSocket(cfg WebSocketConnConfig) (Conn, error) {
+	if cfg.Ctx == nil {
+		cfg.Ctx = context.Background()
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing url")
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = wsDefaultPath
+	}
+
+	var defaultPort string
+	switch u.Scheme {
+	case "ws":
+		defaultPort = "80"
+	case "wss":
+		defaultPort = "443"
+	default:
+		return nil, errors.New("url scheme must be ws or wss, got " + u.Scheme)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	dialCtx := cfg.Ctx
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(dialCtx, cfg.Timeout)
+		defer cancel()
+	}
+	conn, err := dial(dialCtx, host, cfg.Dialer, cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "wss" {
+		tlsConfig := &tls.Config{} //nolint:gosec default config is fine
+		if cfg.TLSConfig != nil {
+			tlsConfig = cfg.TLSConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c := &wsConn{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		ctx:     cfg.Ctx,
+		timeout: cfg.Timeout,
+		client:  true,
+	}
+
+	if err := c.handshake(u); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "websocket handshake")
+	}
+
+	return c, nil
+}
+
+func (c *wsConn) handshake(u *url.URL) error {
+	nonce := make([]byte, 16) //nolint:gomnd defined by rfc 6455
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrap(err, "generating key")
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Protocol", wsProtocol)
+
+	if c.timeout > 0 {
+		if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+			return err
+		}
+		defer c.conn.SetDeadline(time.Time{}) //nolint:errcheck nothing to do with this error
+	}
+
+	if err := req.Write(c.conn); err != nil {
+		return errors.Wrap(err, "sending request")
+	}
+
+	resp, err := http.ReadResponse(c.reader, req)
+	if err != nil {
+		return errors.Wrap(err, "reading response")
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("unexpected status: %v", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		return errors.New("invalid Sec-WebSocket-Accept header")
+	}
+
+	return nil
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID)) //nolint:gosec websocket handshake requires sha1
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func (c *wsConn) Close() error {
+	// trying to close connection gracefully, but it's not so important
+	c.writeFrame(wsOpClose, nil) //nolint:errcheck connection is closing anyway
+	return c.conn.Close()
+}
+
+// Write sends data as single binary message.
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.writeFrame(wsOpBinary, b); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.closeSent {
+		return io.ErrClosedPipe
+	}
+	if opcode == wsOpClose {
+		c.closeSent = true
+	}
+
+	var frame bytes.Buffer
+	frame.WriteByte(wsFinalBit | opcode)
+
+	var maskBit byte
+	if c.client {
+		maskBit = wsMaskBit
+	}
+
+	switch size := len(payload); {
+	case size < 126: //nolint:gomnd defined by rfc 6455
+		frame.WriteByte(maskBit | byte(size))
+	case size <= 0xffff:
+		frame.WriteByte(maskBit | 126) //nolint:gomnd 16 bit length follows
+		size16 := make([]byte, 2)
+		binary.BigEndian.PutUint16(size16, uint16(size))
+		frame.Write(size16)
+	default:
+		frame.WriteByte(maskBit | 127) //nolint:gomnd 64 bit length follows
+		size64 := make([]byte, 8)
+		binary.BigEndian.PutUint64(size64, uint64(size))
+		frame.Write(size64)
+	}
+
+	if !c.client {
+		frame.Write(payload)
+	} else {
+		mask := make([]byte, 4)
+		if _, err := rand.Read(mask); err != nil {
+			return errors.Wrap(err, "generating mask")
+		}
+		frame.Write(mask)
+
+		masked := make([]byte, len(payload))
+		for i := range payload {
+			masked[i] = payload[i] ^ mask[i%4]
+		}
+		frame.Write(masked)
+	}
+
+	// whole frame is written at once, so frames of different writes never mix
+	_, err := c.conn.Write(frame.Bytes())
+	return err
+}
+
+// Read fills whole buffer, even if data is split into few messages, cause modes expect, that they get
+// exactly the size they asked (as tcp connection does).
+func (c *wsConn) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		if len(c.buf) == 0 {
+			if err := c.readDataFrame(); err != nil {
+				if c.ctx.Err() != nil {
+					return n, context.Canceled
+				}
+				return n, err
+			}
+		}
+
+		copied := copy(b[n:], c.buf)
+		c.buf = c.buf[copied:]
+		n += copied
+	}
+
+	return n, nil
+}
+
+// readDataFrame reads frames until it gets data, control frames are processed in place.
+func (c *wsConn) readDataFrame() error {
+	for {
+		if c.timeout > 0 {
+			if err := c.conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+				return err
+			}
+		}
+
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case wsOpBinary, wsOpContinuation:
+			if len(payload) == 0 {
+				continue
+			}
+			c.buf = payload
+			return nil
+
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return errors.Wrap(err, "sending pong")
+			}
+
+		case wsOpPong:
+			// we don't send pings, but it's not forbidden to get pongs
+
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload) //nolint:errcheck other side closed connection anyway
+			return io.EOF
+
+		case wsOpText:
+			return errors.New("got text message, expected binary")
+
+		default:
+			return fmt.Errorf("unknown websocket opcode 0x%x", opcode)
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (opcode byte, payload []byte, err error) {
+	header := make([]byte, 2) //nolint:gomnd defined by rfc 6455
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, nil, err
+	}
+	opcode = header[0] & 0x0f
+	masked := header[1]&wsMaskBit != 0
+
+	size := uint64(header[1] &^ wsMaskBit)
+	switch size {
+	case 126: //nolint:gomnd 16 bit length follows
+		size16 := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, size16); err != nil {
+			return 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(size16))
+	case 127: //nolint:gomnd 64 bit length follows
+		size64 := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, size64); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(size64)
+	}
+	if size > wsMaxFrameLen {
+		return 0, nil, fmt.Errorf("websocket frame is too big: %v bytes", size)
+	}
+
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.reader, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return opcode, payload, nil
+}
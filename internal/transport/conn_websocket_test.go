@@ -0,0 +1,182 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/mode"
+)
+
+// acceptWebSocket is a server side of websocket handshake.
+func acceptWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Sec-WebSocket-Protocol") != wsProtocol {
+		http.Error(w, "not a websocket", http.StatusBadRequest)
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Protocol: " + wsProtocol + "\r\n" +
+		"Sec-WebSocket-Accept: " + wsAcceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, reader: rw.Reader, ctx: context.Background()}, nil
+}
+
+// webSocketServer runs handler for every accepted connection.
+func webSocketServer(t *testing.T, secure bool, handler func(c *wsConn) error) WebSocketConnConfig {
+	t.Helper()
+
+	serverErr := make(chan error, 1)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, wsDefaultPath, r.URL.Path)
+
+		c, err := acceptWebSocket(w, r)
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer c.conn.Close()
+
+		serverErr <- handler(c)
+	})
+
+	cfg := WebSocketConnConfig{Ctx: context.Background()}
+	var srv *httptest.Server
+	if secure {
+		srv = httptest.NewTLSServer(h)
+		cfg.TLSConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+		cfg.URL = strings.Replace(srv.URL, "https://", "wss://", 1)
+	} else {
+		srv = httptest.NewServer(h)
+		cfg.URL = strings.Replace(srv.URL, "http://", "ws://", 1)
+	}
+	t.Cleanup(func() {
+		srv.Close()
+		assert.NoError(t, <-serverErr)
+	})
+
+	return cfg
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		secure := secure
+		t.Run(map[bool]string{false: "ws", true: "wss"}[secure], func(t *testing.T) {
+			cfg := webSocketServer(t, secure, func(c *wsConn) error {
+				// client must answer to pings by itself
+				if err := c.writeFrame(wsOpPing, []byte("ping")); err != nil {
+					return err
+				}
+
+				for {
+					if err := c.readDataFrame(); err != nil {
+						if err == io.EOF {
+							return nil
+						}
+						return err
+					}
+					if _, err := c.Write(c.buf); err != nil {
+						return err
+					}
+					c.buf = nil
+				}
+			})
+
+			conn, err := NewWebSocket(cfg)
+			require.NoError(t, err)
+
+			for _, msg := range [][]byte{
+				[]byte("hello"),
+				bytes.Repeat([]byte("medium"), 100),
+				bytes.Repeat([]byte("huge message!"), 10000),
+			} {
+				_, err := conn.Write(msg)
+				require.NoError(t, err)
+
+				got := make([]byte, len(msg))
+				_, err = io.ReadFull(conn, got)
+				require.NoError(t, err)
+				assert.Equal(t, msg, got)
+			}
+
+			require.NoError(t, conn.Close())
+		})
+	}
+}
+
+func TestWebSocketObfuscated(t *testing.T) {
+	cfg := webSocketServer(t, false, func(c *wsConn) error {
+		m, dc, err := mode.DetectObfuscated(c, nil)
+		if err != nil {
+			return err
+		}
+		if dc != 4 {
+			return io.ErrUnexpectedEOF
+		}
+
+		msg, err := m.ReadMsg()
+		if err != nil {
+			return err
+		}
+
+		return m.WriteMsg(msg)
+	})
+
+	conn, err := NewWebSocket(cfg)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	m, err := mode.NewObfuscated(mode.Intermediate, conn, nil, 4)
+	require.NoError(t, err)
+
+	msg := []byte("obfuscated message")
+	require.NoError(t, m.WriteMsg(msg))
+
+	got, err := m.ReadMsg()
+	require.NoError(t, err)
+	assert.Equal(t, msg, got)
+}
+
+func TestWebSocketClosedByServer(t *testing.T) {
+	cfg := webSocketServer(t, false, func(c *wsConn) error {
+		return c.writeFrame(wsOpClose, nil)
+	})
+
+	conn, err := NewWebSocket(cfg)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Read(make([]byte, 4))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestWebSocketWrongScheme(t *testing.T) {
+	_, err := NewWebSocket(WebSocketConnConfig{URL: "http://localhost/apiws"})
+	assert.Error(t, err)
+}
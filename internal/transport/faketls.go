@@ -0,0 +1,284 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package transport
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Fake-TLS hides obfuscated2 stream inside records, which look like TLS 1.3 traffic. Handshake is not a
+// real TLS: client sends ClientHello, which random is signed by proxy secret, proxy answers with
+// ServerHello, which random is signed too, after that all data is sent as application data records.
+
+const (
+	tlsRecordHandshake        = 0x16
+	tlsRecordChangeCipherSpec = 0x14
+	tlsRecordApplicationData  = 0x17
+
+	tlsRecordHeaderLen = 5
+	// max size of record payload, bigger records are rejected by proxies
+	tlsMaxRecordPayload = 1 << 14
+
+	// ClientHello is padded to this size, like browsers do
+	tlsClientHelloLen = 517
+
+	tlsRandomOffset = 11 // record header (5) + handshake header (4) + version (2)
+	tlsRandomLen    = 32
+)
+
+var (
+	tlsVersion = []byte{0x03, 0x03}
+	// change cipher spec record is always the same
+	tlsChangeCipherSpec = []byte{tlsRecordChangeCipherSpec, 0x03, 0x03, 0x00, 0x01, 0x01}
+)
+
+// NewFakeTLS makes fake-TLS handshake with MTProxy and returns connection, which wraps all data in TLS
+// application data records. key is 16 bytes of ee-secret, domain is SNI, which proxy expects.
+func NewFakeTLS(conn Conn, key []byte, domain string) (Conn, error) {
+	hello, err := clientHello(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(hello)
+	clientRandom := mac.Sum(nil)
+
+	// last 4 bytes of random are timestamp, so proxy could reject replayed hellos
+	timestamp := binary.LittleEndian.Uint32(clientRandom[tlsRandomLen-4:]) ^ uint32(time.Now().Unix())
+	binary.LittleEndian.PutUint32(clientRandom[tlsRandomLen-4:], timestamp)
+	copy(hello[tlsRandomOffset:], clientRandom)
+
+	if _, err := conn.Write(hello); err != nil {
+		return nil, errors.Wrap(err, "sending client hello")
+	}
+
+	if err := readServerHello(conn, key, clientRandom); err != nil {
+		return nil, err
+	}
+
+	return &fakeTLSConn{conn: conn}, nil
+}
+
+// readServerHello reads ServerHello, ChangeCipherSpec and first application data records, then checks
+// that server random is signed by same secret.
+func readServerHello(conn Conn, key, clientRandom []byte) error {
+	response := bytes.NewBuffer(nil)
+	for _, expected := range []byte{tlsRecordHandshake, tlsRecordChangeCipherSpec, tlsRecordApplicationData} {
+		header, payload, err := readTLSRecord(conn)
+		if err != nil {
+			return errors.Wrap(err, "reading server hello")
+		}
+		if header[0] != expected {
+			return fmt.Errorf("expected tls record 0x%02x, got 0x%02x", expected, header[0])
+		}
+
+		response.Write(header)
+		response.Write(payload)
+	}
+
+	data := response.Bytes()
+	if len(data) < tlsRandomOffset+tlsRandomLen {
+		return errors.New("server hello is too short")
+	}
+
+	serverRandom := make([]byte, tlsRandomLen)
+	copy(serverRandom, data[tlsRandomOffset:])
+	copy(data[tlsRandomOffset:tlsRandomOffset+tlsRandomLen], make([]byte, tlsRandomLen))
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(clientRandom)
+	mac.Write(data)
+	if !hmac.Equal(serverRandom, mac.Sum(nil)) {
+		return errors.New("server hello is not signed by secret")
+	}
+
+	return nil
+}
+
+func readTLSRecord(r io.Reader) (header, payload []byte, err error) {
+	header = make([]byte, tlsRecordHeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(header[1:3], tlsVersion) {
+		return nil, nil, fmt.Errorf("unexpected tls version %x", header[1:3])
+	}
+
+	size := binary.BigEndian.Uint16(header[3:])
+	if size > tlsMaxRecordPayload+256 { //nolint:gomnd tls allows a bit bigger encrypted records
+		return nil, nil, fmt.Errorf("tls record is too big: %v bytes", size)
+	}
+
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	return header, payload, nil
+}
+
+// clientHello returns ClientHello record with zero random. It looks like hello of modern browser.
+func clientHello(domain string) ([]byte, error) {
+	random := make([]byte, 32+32) //nolint:gomnd session id and key share
+	if _, err := rand.Read(random); err != nil {
+		return nil, errors.Wrap(err, "generating random")
+	}
+	sessionID, keyShare := random[:32], random[32:]
+
+	var ext bytes.Buffer
+	writeExtension := func(typ uint16, data []byte) {
+		writeUint16(&ext, typ)
+		writeUint16(&ext, uint16(len(data)))
+		ext.Write(data)
+	}
+
+	var sni bytes.Buffer
+	writeUint16(&sni, uint16(len(domain)+3)) //nolint:gomnd type and length of name
+	sni.WriteByte(0)                         // host_name
+	writeUint16(&sni, uint16(len(domain)))
+	sni.WriteString(domain)
+
+	writeExtension(0x0000, sni.Bytes())                                            // server_name
+	writeExtension(0x0017, nil)                                                    // extended_master_secret
+	writeExtension(0xff01, []byte{0x00})                                           // renegotiation_info
+	writeExtension(0x000a, []byte{0x00, 0x06, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18}) // supported_groups
+	writeExtension(0x000b, []byte{0x01, 0x00})                                     // ec_point_formats
+	writeExtension(0x0023, nil)                                                    // session_ticket
+	writeExtension(0x0010, append([]byte{0x00, 0x0c, 0x02}, "h2\x08http/1.1"...))  // alpn
+	writeExtension(0x0005, []byte{0x01, 0x00, 0x00, 0x00, 0x00})                   // status_request
+	writeExtension(0x000d, []byte{                                                 // signature_algorithms
+		0x00, 0x10, 0x04, 0x03, 0x08, 0x04, 0x04, 0x01, 0x05, 0x03, 0x08, 0x05, 0x05, 0x01, 0x08, 0x06, 0x06, 0x01,
+	})
+	writeExtension(0x0012, nil)                                                             // signed_certificate_timestamp
+	writeExtension(0x0033, append([]byte{0x00, 0x24, 0x00, 0x1d, 0x00, 0x20}, keyShare...)) // key_share
+	writeExtension(0x002d, []byte{0x01, 0x01})                                              // psk_key_exchange_modes
+	writeExtension(0x002b, []byte{0x04, 0x03, 0x04, 0x03, 0x03})                            // supported_versions
+
+	var body bytes.Buffer
+	body.Write(tlsVersion)
+	body.Write(make([]byte, tlsRandomLen))
+	body.WriteByte(byte(len(sessionID)))
+	body.Write(sessionID)
+	body.Write([]byte{
+		0x00, 0x1e, // cipher suites
+		0x13, 0x01, 0x13, 0x02, 0x13, 0x03, 0xc0, 0x2b, 0xc0, 0x2f, 0xc0, 0x2c, 0xc0, 0x30, 0xcc, 0xa9,
+		0xcc, 0xa8, 0xc0, 0x13, 0xc0, 0x14, 0x00, 0x9c, 0x00, 0x9d, 0x00, 0x2f, 0x00, 0x35,
+		0x01, 0x00, // compression methods
+	})
+
+	// headers of record (5), handshake (4), extensions (2) and padding extension (4)
+	const overhead = tlsRecordHeaderLen + 4 + 2 + 4
+	if padding := tlsClientHelloLen - overhead - body.Len() - ext.Len(); padding >= 0 {
+		writeExtension(0x0015, make([]byte, padding)) // padding
+	}
+
+	writeUint16(&body, uint16(ext.Len()))
+	body.Write(ext.Bytes())
+
+	handshakeLen := body.Len()
+	if handshakeLen+4 > tlsMaxRecordPayload {
+		return nil, errors.New("domain is too long")
+	}
+
+	var hello bytes.Buffer
+	hello.Write([]byte{tlsRecordHandshake, 0x03, 0x01})
+	writeUint16(&hello, uint16(handshakeLen+4)) //nolint:gomnd handshake header
+	hello.Write([]byte{0x01, byte(handshakeLen >> 16), byte(handshakeLen >> 8), byte(handshakeLen)})
+	hello.Write(body.Bytes())
+
+	return hello.Bytes(), nil
+}
+
+func writeUint16(w *bytes.Buffer, v uint16) {
+	w.Write([]byte{byte(v >> 8), byte(v)}) //nolint:gomnd big endian
+}
+
+// fakeTLSConn wraps data into application data records.
+type fakeTLSConn struct {
+	conn Conn
+
+	writeMutex sync.Mutex
+	// client sends change cipher spec before first data record
+	ccsSent bool
+
+	// unread payload of last record
+	buf []byte
+}
+
+func (c *fakeTLSConn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	var data bytes.Buffer
+	if !c.ccsSent {
+		data.Write(tlsChangeCipherSpec)
+	}
+
+	for rest := b; len(rest) > 0; {
+		chunk := rest
+		if len(chunk) > tlsMaxRecordPayload {
+			chunk = chunk[:tlsMaxRecordPayload]
+		}
+		rest = rest[len(chunk):]
+
+		data.WriteByte(tlsRecordApplicationData)
+		data.Write(tlsVersion)
+		writeUint16(&data, uint16(len(chunk)))
+		data.Write(chunk)
+	}
+
+	// writing everything at once, so records of different writes never mix
+	if _, err := c.conn.Write(data.Bytes()); err != nil {
+		return 0, err
+	}
+	c.ccsSent = true
+
+	return len(b), nil
+}
+
+// Read fills whole buffer, even if data is split into few records, cause modes expect, that they get exactly
+// the size they asked (as tcp connection does).
+func (c *fakeTLSConn) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		if len(c.buf) == 0 {
+			header, payload, err := readTLSRecord(c.conn)
+			if err != nil {
+				return n, err
+			}
+
+			switch header[0] {
+			case tlsRecordApplicationData:
+				c.buf = payload
+			case tlsRecordChangeCipherSpec:
+				// could be sent by other side anytime, it's meaningless
+			default:
+				return n, fmt.Errorf("unexpected tls record 0x%02x", header[0])
+			}
+		}
+
+		copied := copy(b[n:], c.buf)
+		c.buf = c.buf[copied:]
+		n += copied
+	}
+
+	return n, nil
+}
+
+func (c *fakeTLSConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package transport
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/mode"
+)
+
+// acceptFakeTLS is a proxy side of fake-TLS handshake, it works like real MTProxy.
+func acceptFakeTLS(conn net.Conn, key []byte, domain string) (Conn, error) {
+	header := make([]byte, tlsRecordHeaderLen)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[0] != tlsRecordHandshake {
+		return nil, errors.New("not a client hello")
+	}
+	hello := make([]byte, tlsRecordHeaderLen+int(binary.BigEndian.Uint16(header[3:])))
+	copy(hello, header)
+	if _, err := io.ReadFull(conn, hello[tlsRecordHeaderLen:]); err != nil {
+		return nil, err
+	}
+	if len(hello) != tlsClientHelloLen {
+		return nil, errors.New("unexpected size of client hello")
+	}
+	if !bytes.Contains(hello, []byte(domain)) {
+		return nil, errors.New("sni not found")
+	}
+
+	clientRandom := make([]byte, tlsRandomLen)
+	copy(clientRandom, hello[tlsRandomOffset:])
+	copy(hello[tlsRandomOffset:tlsRandomOffset+tlsRandomLen], make([]byte, tlsRandomLen))
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(hello)
+	expected := mac.Sum(nil)
+	if !bytes.Equal(expected[:tlsRandomLen-4], clientRandom[:tlsRandomLen-4]) {
+		return nil, errors.New("client hello is not signed by secret")
+	}
+	timestamp := binary.LittleEndian.Uint32(expected[tlsRandomLen-4:]) ^
+		binary.LittleEndian.Uint32(clientRandom[tlsRandomLen-4:])
+	if d := time.Since(time.Unix(int64(timestamp), 0)); d > time.Minute || d < -time.Minute {
+		return nil, errors.New("client hello is too old")
+	}
+
+	sessionID := hello[tlsRandomOffset+tlsRandomLen+1 : tlsRandomOffset+tlsRandomLen+1+32]
+
+	serverHello := []byte{0x03, 0x03}
+	serverHello = append(serverHello, make([]byte, tlsRandomLen)...)
+	serverHello = append(serverHello, 32)
+	serverHello = append(serverHello, sessionID...)
+	serverHello = append(serverHello, 0x13, 0x01, 0x00)                               // cipher suite, compression
+	serverHello = append(serverHello, 0x00, 0x2e)                                     // extensions length
+	serverHello = append(serverHello, 0x00, 0x33, 0x00, 0x24, 0x00, 0x1d, 0x00, 0x20) // key share
+	serverHello = append(serverHello, bytes.Repeat([]byte{0x42}, 32)...)
+	serverHello = append(serverHello, 0x00, 0x2b, 0x00, 0x02, 0x03, 0x04) // supported versions
+
+	var response bytes.Buffer
+	response.Write([]byte{tlsRecordHandshake, 0x03, 0x03})
+	writeUint16(&response, uint16(len(serverHello)+4))
+	response.Write([]byte{0x02, 0x00, byte(len(serverHello) >> 8), byte(len(serverHello))})
+	response.Write(serverHello)
+	response.Write(tlsChangeCipherSpec)
+	response.Write([]byte{tlsRecordApplicationData, 0x03, 0x03, 0x00, 0x40})
+	response.Write(bytes.Repeat([]byte{0x13}, 0x40))
+
+	data := response.Bytes()
+	mac = hmac.New(sha256.New, key)
+	mac.Write(clientRandom)
+	mac.Write(data)
+	copy(data[tlsRandomOffset:], mac.Sum(nil))
+
+	if _, err := conn.Write(data); err != nil {
+		return nil, err
+	}
+
+	return &fakeTLSConn{conn: conn, ccsSent: true}, nil
+}
+
+func TestFakeTLS(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 16)
+	hugeMessage := bytes.Repeat([]byte("big!"), 10000)
+
+	clientConn, proxyConn := net.Pipe()
+	defer clientConn.Close()
+	defer proxyConn.Close()
+
+	proxyErr := make(chan error, 1)
+	go func() {
+		proxyErr <- func() error {
+			conn, err := acceptFakeTLS(proxyConn, key, "example.com")
+			if err != nil {
+				return err
+			}
+
+			m, _, err := mode.DetectObfuscated(conn, key)
+			if err != nil {
+				return err
+			}
+
+			for i := 0; i < 2; i++ {
+				msg, err := m.ReadMsg()
+				if err != nil {
+					return err
+				}
+				if err := m.WriteMsg(msg); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}()
+	}()
+
+	conn, err := NewFakeTLS(clientConn, key, "example.com")
+	require.NoError(t, err)
+
+	m, err := mode.NewObfuscated(mode.Intermediate, conn, key, 2)
+	require.NoError(t, err)
+
+	for _, msg := range [][]byte{[]byte("test message"), hugeMessage} {
+		require.NoError(t, m.WriteMsg(msg))
+
+		got, err := m.ReadMsg()
+		require.NoError(t, err)
+		assert.Equal(t, msg, got)
+	}
+
+	require.NoError(t, <-proxyErr)
+}
+
+func TestFakeTLSWrongSecret(t *testing.T) {
+	clientConn, proxyConn := net.Pipe()
+	defer clientConn.Close()
+
+	proxyErr := make(chan error, 1)
+	go func() {
+		_, err := acceptFakeTLS(proxyConn, bytes.Repeat([]byte{1}, 16), "example.com")
+		proxyConn.Close()
+		proxyErr <- err
+	}()
+
+	_, err := NewFakeTLS(clientConn, bytes.Repeat([]byte{2}, 16), "example.com")
+	assert.Error(t, err)
+	assert.Error(t, <-proxyErr)
+}
@@ -0,0 +1,260 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/internal/mtproto/messages"
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
+)
+
+// HTTPConnConfig is a config of http transport. Unlike tcp, http transport doesn't use modes: each message
+// is sent as body of POST request, and answer is a body of response. Server can't send anything by itself,
+// so transport keeps long-polling request (http_wait) to get such messages.
+// https://core.telegram.org/mtproto/transports#http
+type HTTPConnConfig struct {
+	Ctx context.Context
+	// URL of server, e.g. http://149.154.167.50:80/api. If path is empty, /api is used.
+	URL string
+	// Timeout of single request. Long-polling requests wait a bit less than this timeout.
+	Timeout time.Duration
+	// Client is used for all requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// Proxy is optional, if set, all requests are sent through it. Ignored, if Client is set.
+	Proxy *Proxy
+	// Dialer is optional, if set, it makes connections for requests. Ignored, if Client is set, Proxy is
+	// ignored, if Dialer is set.
+	Dialer Dialer
+}
+
+const (
+	httpDefaultPath = "/api"
+
+	httpDefaultTimeout = 30 * time.Second
+	// long-polling request must finish before http timeout
+	httpWaitMargin = 5 * time.Second
+	// if something went wrong with long-polling, it waits a bit before next try
+	httpWaitRetryDelay = time.Second
+)
+
+type httpTransport struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	url     string
+	client  *http.Client
+	timeout time.Duration
+	m       messages.MessageInformator
+
+	// responses of all requests, in the same order as they are received
+	incoming chan httpResponse
+
+	waitOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type httpResponse struct {
+	data []byte
+	err  error
+}
+
+var _ Transport = (*httpTransport)(nil)
+
+func newHTTPTransport(m messages.MessageInformator, cfg HTTPConnConfig) (*httpTransport, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing url")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("url scheme must be http or https, got " + u.Scheme)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = httpDefaultPath
+	}
+
+	if cfg.Ctx == nil {
+		cfg.Ctx = context.Background()
+	}
+	if cfg.Client == nil && (cfg.Dialer != nil || cfg.Proxy != nil) {
+		dialer, proxy := cfg.Dialer, cfg.Proxy
+		cfg.Client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dial(ctx, addr, dialer, proxy)
+			},
+		}}
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Timeout <= httpWaitMargin {
+		cfg.Timeout = httpDefaultTimeout
+	}
+
+	ctx, cancel := context.WithCancel(cfg.Ctx)
+	return &httpTransport{
+		ctx:      ctx,
+		cancel:   cancel,
+		url:      u.String(),
+		client:   cfg.Client,
+		timeout:  cfg.Timeout,
+		m:        m,
+		incoming: make(chan httpResponse),
+	}, nil
+}
+
+func (t *httpTransport) Close() error {
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
+
+// WriteMsg sends message in separate request, so few requests could wait their answers at the same time.
+func (t *httpTransport) WriteMsg(msg messages.Common, requireToAck bool) error {
+	if t.ctx.Err() != nil {
+		return t.ctx.Err()
+	}
+
+	data, err := serializeMessage(t.m, msg, requireToAck)
+	if err != nil {
+		return err
+	}
+
+	// encrypted message means that auth key is created, so server can send something by itself
+	if _, ok := msg.(*messages.Encrypted); ok {
+		t.waitOnce.Do(t.startWaiting)
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.push(t.post(data))
+	}()
+
+	return nil
+}
+
+// WriteMsgQuickAck always returns ErrQuickAckNotSupported: http has no framing of mtproto transports, so
+// there is no way to ask for quick ack.
+func (t *httpTransport) WriteMsgQuickAck(messages.Common, bool) (uint32, error) {
+	return 0, ErrQuickAckNotSupported
+}
+
+func (t *httpTransport) ReadMsg() (messages.Common, error) {
+	select {
+	case <-t.ctx.Done():
+		return nil, context.Canceled
+
+	case resp := <-t.incoming:
+		if resp.err != nil {
+			// request is lost, like it happens when tcp connection is broken, so client must reconnect
+			return nil, io.EOF
+		}
+
+		return deserializeMessage(t.m, resp.data)
+	}
+}
+
+// startWaiting runs long-polling loop, which sends http_wait to server until transport is closed.
+func (t *httpTransport) startWaiting() {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		for t.ctx.Err() == nil {
+			resp := t.wait()
+			if resp.err != nil && t.ctx.Err() == nil {
+				select {
+				case <-t.ctx.Done():
+				case <-time.After(httpWaitRetryDelay):
+				}
+				continue
+			}
+
+			t.push(resp)
+		}
+	}()
+}
+
+func (t *httpTransport) wait() httpResponse {
+	req, err := tl.Marshal(&objects.HttpWaitParams{
+		MaxWait: int32((t.timeout - httpWaitMargin) / time.Millisecond),
+	})
+	if err != nil {
+		return httpResponse{err: errors.Wrap(err, "encoding http_wait")}
+	}
+
+	// http_wait doesn't require ack, so it's content unrelated and doesn't take next seqno
+	msgID, seqNo := t.m.ReserveMessage(false)
+	data, err := (&messages.Encrypted{
+		Msg:   req,
+		MsgID: msgID,
+		SeqNo: seqNo,
+	}).SerializeWithSeqNo(t.m)
+	if err != nil {
+		return httpResponse{err: errors.Wrap(err, "serializing message")}
+	}
+
+	return t.post(data)
+}
+
+func (t *httpTransport) post(data []byte) httpResponse {
+	ctx, cancel := context.WithTimeout(t.ctx, t.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return httpResponse{err: errors.Wrap(err, "creating request")}
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return httpResponse{err: errors.Wrap(err, "sending request")}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return httpResponse{err: errors.Wrap(err, "reading response")}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// transport errors are sent as http status (e.g. 404 means -404)
+		if len(body) != tl.WordLen {
+			body = make([]byte, tl.WordLen)
+			binary.LittleEndian.PutUint32(body, uint32(-int32(resp.StatusCode)))
+		}
+	}
+
+	return httpResponse{data: body}
+}
+
+// push sends response to reader. Empty responses (e.g. http_wait timed out) are skipping.
+func (t *httpTransport) push(resp httpResponse) {
+	if resp.err == nil && len(resp.data) == 0 {
+		return
+	}
+	if resp.err != nil && t.ctx.Err() != nil {
+		// transport is closed, nobody cares
+		return
+	}
+
+	select {
+	case <-t.ctx.Done():
+	case t.incoming <- resp:
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package transport_test
+
+import (
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/internal/mtproto/messages"
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
+	"github.com/xelaj/mtproto/internal/transport"
+	"github.com/xelaj/mtproto/internal/utils"
+	"github.com/xelaj/mtproto/mode"
+)
+
+type informator struct {
+	key []byte
+	// timeOffset and seqNo are returned by ReserveMessage
+	timeOffset time.Duration
+	seqNo      int32
+}
+
+func (*informator) GetSessionID() int64  { return 1 }
+func (*informator) GetSeqNo() int32      { return 0 }
+func (*informator) GetServerSalt() int64 { return 2 }
+func (i *informator) GetAuthKey() []byte { return i.key }
+
+func (i *informator) ReserveMessage(bool) (msgID int64, seqNo int32) {
+	return utils.GenerateMessageIdAt(time.Now().Add(i.timeOffset)), i.seqNo
+}
+
+func newHTTPTransport(t *testing.T, m messages.MessageInformator, h http.HandlerFunc) transport.Transport {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	tr, err := transport.NewTransport(m, transport.HTTPConnConfig{
+		Ctx:     context.Background(),
+		URL:     srv.URL,
+		Timeout: 10 * time.Second,
+	}, mode.Intermediate)
+	require.NoError(t, err)
+	t.Cleanup(func() { tr.Close() })
+
+	return tr
+}
+
+func TestHTTPTransport_Unencrypted(t *testing.T) {
+	// both requests are answered only when server got all of them, so they are waiting at the same time
+	var received sync.WaitGroup
+	received.Add(2)
+
+	tr := newHTTPTransport(t, &informator{}, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api", r.URL.Path)
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		msg, err := messages.DeserializeUnencryptedAsServer(body)
+		require.NoError(t, err)
+
+		received.Done()
+		received.Wait()
+
+		resp, err := (&messages.Unencrypted{Msg: msg.Msg, MsgID: msg.MsgID | 1}).Serialize(nil)
+		require.NoError(t, err)
+		w.Write(resp)
+	})
+
+	for _, text := range []string{"first request", "second request"} {
+		err := tr.WriteMsg(&messages.Unencrypted{Msg: []byte(text), MsgID: utils.GenerateMessageId()}, true)
+		require.NoError(t, err)
+	}
+
+	got := make([]string, 0, 2)
+	for i := 0; i < 2; i++ {
+		msg, err := tr.ReadMsg()
+		require.NoError(t, err)
+		got = append(got, string(msg.GetMsg()))
+	}
+	assert.ElementsMatch(t, []string{"first request", "second request"}, got)
+}
+
+func TestHTTPTransport_ErrorCode(t *testing.T) {
+	tr := newHTTPTransport(t, &informator{}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	err := tr.WriteMsg(&messages.Unencrypted{Msg: []byte("test"), MsgID: utils.GenerateMessageId()}, true)
+	require.NoError(t, err)
+
+	_, err = tr.ReadMsg()
+	assert.Equal(t, transport.ErrCode(-404), err)
+}
+
+func TestHTTPTransport_Wait(t *testing.T) {
+	key := make([]byte, 256)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	m := &informator{key: key}
+
+	pushed := []byte("update from server!!")
+	waitReceived := make(chan struct{}, 10)
+
+	tr := newHTTPTransport(t, m, func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		msg, err := messages.DeserializeEncryptedAsServer(body, key)
+		require.NoError(t, err)
+
+		obj, err := tl.DecodeUnknownObject(msg.Msg)
+		if err != nil || obj.CRC() != (&objects.HttpWaitParams{}).CRC() {
+			// regular request, nothing to answer
+			return
+		}
+
+		waitReceived <- struct{}{}
+		if len(waitReceived) > 1 {
+			// only first long-polling request gets update, others are waiting until transport is closed
+			<-r.Context().Done()
+			return
+		}
+
+		resp, err := (&messages.Encrypted{
+			Msg:       pushed,
+			MsgID:     utils.GenerateMessageId() | 3,
+			Salt:      m.GetServerSalt(),
+			SessionID: m.GetSessionID(),
+			SeqNo:     1,
+		}).SerializeAsServer(key)
+		require.NoError(t, err)
+		w.Write(resp)
+	})
+
+	err = tr.WriteMsg(&messages.Encrypted{Msg: []byte("some request"), MsgID: utils.GenerateMessageId()}, true)
+	require.NoError(t, err)
+
+	msg, err := tr.ReadMsg()
+	require.NoError(t, err)
+	assert.Equal(t, pushed, msg.GetMsg())
+}
+
+func TestHTTPTransport_WaitTimeOffset(t *testing.T) {
+	key := make([]byte, 256)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	// client clock is an hour ahead of server one
+	m := &informator{key: key, timeOffset: -time.Hour, seqNo: 6}
+
+	waits := make(chan *messages.Encrypted, 10)
+	tr := newHTTPTransport(t, m, func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		msg, err := messages.DeserializeEncryptedAsServer(body, key)
+		require.NoError(t, err)
+
+		obj, err := tl.DecodeUnknownObject(msg.Msg)
+		if err != nil || obj.CRC() != (&objects.HttpWaitParams{}).CRC() {
+			return
+		}
+
+		waits <- msg
+		<-r.Context().Done()
+	})
+
+	// long polling starts with first encrypted request
+	err = tr.WriteMsg(&messages.Encrypted{Msg: []byte("some request"), MsgID: utils.GenerateMessageId()}, true)
+	require.NoError(t, err)
+
+	msg := <-waits
+	sent := time.Unix(msg.MsgID>>32, 0)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), sent, time.Minute, "msg id must be corrected by server time")
+	assert.Equal(t, int32(6), msg.SeqNo)
+}
@@ -1,7 +1,9 @@
 package transport
 
 import (
+	"context"
 	"io"
+	"net"
 )
 
 type ConnConfig interface{}
@@ -12,3 +14,9 @@ type Mode interface {
 	WriteMsg(msg []byte) error // this is not same as the io.Writer
 	ReadMsg() ([]byte, error)
 }
+
+// Dialer makes raw connection to server (or to proxy). If it's not set in config, connection is made
+// through tcp.
+type Dialer interface {
+	DialContext(ctx context.Context, addr string) (net.Conn, error)
+}
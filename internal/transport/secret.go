@@ -0,0 +1,73 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package transport
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	proxySecretLen = 16
+
+	proxySecretPadded  = 0xdd
+	proxySecretFakeTLS = 0xee
+)
+
+// ProxySecret is a parsed secret of MTProxy. There are three kinds of secrets:
+//   - plain, 16 bytes: obfuscated2 with any mode;
+//   - "dd" + 16 bytes: obfuscated2 with padded intermediate mode only;
+//   - "ee" + 16 bytes + domain: obfuscated2 inside fake-TLS records, domain is used as SNI.
+type ProxySecret struct {
+	Key     []byte
+	Padded  bool
+	FakeTLS bool
+	Domain  string
+}
+
+// ParseProxySecret parses secret as it's written in tg://proxy links: hex or base64 (both url-safe and
+// standard).
+func ParseProxySecret(s string) (*ProxySecret, error) {
+	s = strings.TrimSpace(s)
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		data, err = decodeBase64(s)
+		if err != nil {
+			return nil, errors.New("secret is neither hex nor base64")
+		}
+	}
+
+	switch {
+	case len(data) == proxySecretLen:
+		return &ProxySecret{Key: data}, nil
+
+	case len(data) == proxySecretLen+1 && data[0] == proxySecretPadded:
+		return &ProxySecret{Key: data[1:], Padded: true}, nil
+
+	case len(data) > proxySecretLen+1 && data[0] == proxySecretFakeTLS:
+		return &ProxySecret{
+			Key:     data[1 : proxySecretLen+1],
+			FakeTLS: true,
+			Domain:  string(data[proxySecretLen+1:]),
+		}, nil
+
+	default:
+		return nil, errors.New("invalid secret format")
+	}
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if strings.ContainsAny(s, "-_") {
+		return base64.RawURLEncoding.DecodeString(s)
+	}
+
+	return base64.RawStdEncoding.DecodeString(s)
+}
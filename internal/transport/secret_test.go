@@ -0,0 +1,70 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package transport_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/internal/transport"
+)
+
+func TestParseProxySecret(t *testing.T) {
+	key := []byte{
+		0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+	}
+
+	for _, tt := range []struct {
+		name    string
+		secret  string
+		want    *transport.ProxySecret
+		wantErr bool
+	}{
+		{
+			name:   "plain hex",
+			secret: "00112233445566778899aabbccddeeff",
+			want:   &transport.ProxySecret{Key: key},
+		},
+		{
+			name:   "dd",
+			secret: "dd00112233445566778899AABBCCDDEEFF",
+			want:   &transport.ProxySecret{Key: key, Padded: true},
+		},
+		{
+			name:   "ee",
+			secret: "ee00112233445566778899aabbccddeeff" + "676f6f676c652e636f6d",
+			want:   &transport.ProxySecret{Key: key, FakeTLS: true, Domain: "google.com"},
+		},
+		{
+			name:   "ee base64",
+			secret: "7gARIjNEVWZ3iJmqu8zd7v9nb29nbGUuY29t",
+			want:   &transport.ProxySecret{Key: key, FakeTLS: true, Domain: "google.com"},
+		},
+		{
+			name:    "too short",
+			secret:  "00112233",
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			secret:  "not a secret!",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := transport.ParseProxySecret(tt.secret)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -9,13 +9,18 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/xelaj/mtproto/internal/encoding/tl"
-	"github.com/xelaj/mtproto/internal/mode"
 	"github.com/xelaj/mtproto/internal/mtproto/messages"
+	"github.com/xelaj/mtproto/mode"
 )
 
 type Transport interface {
 	Close() error
 	WriteMsg(msg messages.Common, requireToAck bool) error
+	// WriteMsgQuickAck works like WriteMsg, but asks server for quick ack and returns token, which server
+	// will send back. Token is returned by ReadMsg as *mode.QuickAck error. Only encrypted messages could be
+	// quick acked, if mode (or transport itself) doesn't support quick acks, ErrQuickAckNotSupported is
+	// returned, and message is not sent.
+	WriteMsgQuickAck(msg messages.Common, requireToAck bool) (token uint32, err error)
 	ReadMsg() (messages.Common, error)
 }
 
@@ -26,6 +31,72 @@ type transport struct {
 }
 
 func NewTransport(m messages.MessageInformator, conn ConnConfig, modeVariant mode.Variant) (Transport, error) {
+	// http has its own framing, so mode is not used
+	if cfg, ok := conn.(HTTPConnConfig); ok {
+		return newHTTPTransport(m, cfg)
+	}
+
+	t, err := newTransport(m, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := mode.New(modeVariant, t.conn)
+	if err != nil {
+		t.conn.Close()
+		return nil, errors.Wrap(err, "setup mode")
+	}
+	t.mode = md
+
+	return t, t.limitFrameSize(md, conn)
+}
+
+// ObfuscationConfig enables obfuscated2 protocol for transport, which is required to connect through
+// MTProxy.
+type ObfuscationConfig struct {
+	// Secret of MTProxy. Could be nil for direct connection to telegram server.
+	Secret *ProxySecret
+	// DC is id of datacenter, which proxy must connect to.
+	DC int16
+}
+
+// NewObfuscatedTransport works like NewTransport, but obfuscates all traffic. If secret requires specific
+// mode (e.g. dd-secret works only with padded intermediate mode), modeVariant is ignored.
+func NewObfuscatedTransport(
+	m messages.MessageInformator, conn ConnConfig, modeVariant mode.Variant, obfuscation ObfuscationConfig,
+) (Transport, error) {
+	var key []byte
+	if s := obfuscation.Secret; s != nil {
+		if s.Padded {
+			modeVariant = mode.PaddedIntermediate
+		}
+		key = s.Key
+	}
+
+	t, err := newTransport(m, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if s := obfuscation.Secret; s != nil && s.FakeTLS {
+		t.conn, err = NewFakeTLS(t.conn, s.Key, s.Domain)
+		if err != nil {
+			t.conn.Close()
+			return nil, errors.Wrap(err, "setup fake-TLS")
+		}
+	}
+
+	md, err := mode.NewObfuscated(modeVariant, t.conn, key, obfuscation.DC)
+	if err != nil {
+		t.conn.Close()
+		return nil, errors.Wrap(err, "setup mode")
+	}
+	t.mode = md
+
+	return t, t.limitFrameSize(md, conn)
+}
+
+func newTransport(m messages.MessageInformator, conn ConnConfig) (*transport, error) {
 	t := &transport{
 		m: m,
 	}
@@ -34,6 +105,8 @@ func NewTransport(m messages.MessageInformator, conn ConnConfig, modeVariant mod
 	switch cfg := conn.(type) {
 	case TCPConnConfig:
 		t.conn, err = NewTCP(cfg)
+	case WebSocketConnConfig:
+		t.conn, err = NewWebSocket(cfg)
 	default:
 		return nil, fmt.Errorf("unsupported connection type %v", reflect.TypeOf(conn).String())
 	}
@@ -41,12 +114,25 @@ func NewTransport(m messages.MessageInformator, conn ConnConfig, modeVariant mod
 		return nil, errors.Wrap(err, "setup connection")
 	}
 
-	t.mode, err = mode.New(modeVariant, t.conn)
-	if err != nil {
-		return nil, errors.Wrap(err, "setup mode")
+	return t, nil
+}
+
+// limitFrameSize sets max size of frame from connection config
+func (t *transport) limitFrameSize(md mode.Mode, conn ConnConfig) error {
+	var size int
+	switch cfg := conn.(type) {
+	case TCPConnConfig:
+		size = cfg.MaxFrameSize
+	case WebSocketConnConfig:
+		size = cfg.MaxFrameSize
 	}
 
-	return t, nil
+	if err := mode.SetMaxFrameSize(md, size); err != nil {
+		t.conn.Close()
+		return err
+	}
+
+	return nil
 }
 
 func (t *transport) Close() error {
@@ -54,49 +140,88 @@ func (t *transport) Close() error {
 }
 
 func (t *transport) WriteMsg(msg messages.Common, requireToAck bool) error {
-	var data []byte
-	switch message := msg.(type) {
-	case *messages.Unencrypted:
-		data, _ = message.Serialize(t.m)
-
-	case *messages.Encrypted:
-		var err error
-		data, err = message.Serialize(t.m, requireToAck)
-		if err != nil {
-			return errors.Wrap(err, "serializing message")
-		}
-
-	default:
-		return fmt.Errorf("supported only mtproto predefined messages, got %v", reflect.TypeOf(msg).String())
+	data, err := serializeMessage(t.m, msg, requireToAck)
+	if err != nil {
+		return err
 	}
 
-	err := t.mode.WriteMsg(data)
+	err = t.mode.WriteMsg(data)
 	if err != nil {
 		return errors.Wrap(err, "sending request")
 	}
 	return nil
 }
 
+func (t *transport) WriteMsgQuickAck(msg messages.Common, requireToAck bool) (uint32, error) {
+	encrypted, ok := msg.(*messages.Encrypted)
+	acker, supported := t.mode.(mode.QuickAcker)
+	if !ok || !supported {
+		return 0, ErrQuickAckNotSupported
+	}
+
+	data, err := serializeMessage(t.m, encrypted, requireToAck)
+	if err != nil {
+		return 0, err
+	}
+
+	err = acker.WriteMsgQuickAck(data)
+	if err != nil {
+		return 0, errors.Wrap(err, "sending request")
+	}
+	return encrypted.QuickAckToken, nil
+}
+
 func (t *transport) ReadMsg() (messages.Common, error) {
 	data, err := t.mode.ReadMsg()
 	if err != nil {
+		if _, ok := err.(*mode.QuickAck); ok {
+			return nil, err
+		}
 		switch err {
 		case io.EOF, context.Canceled:
 			return nil, err
+		case io.ErrUnexpectedEOF:
+			// connection is broken in the middle of frame, it's the same as closed connection
+			return nil, io.EOF
 		default:
 			return nil, errors.Wrap(err, "reading message")
 		}
 	}
 
+	return deserializeMessage(t.m, data)
+}
+
+func serializeMessage(m messages.MessageInformator, msg messages.Common, requireToAck bool) ([]byte, error) {
+	switch message := msg.(type) {
+	case *messages.Unencrypted:
+		return message.Serialize(m)
+
+	case *messages.Encrypted:
+		data, err := message.Serialize(m, requireToAck)
+		if err != nil {
+			return nil, errors.Wrap(err, "serializing message")
+		}
+		return data, nil
+
+	default:
+		return nil, fmt.Errorf("supported only mtproto predefined messages, got %v", reflect.TypeOf(msg).String())
+	}
+}
+
+func deserializeMessage(m messages.MessageInformator, data []byte) (messages.Common, error) {
+	// padded intermediate mode adds random bytes to every message
+	data = messages.TrimPadding(data)
+
 	// checking that response is not error code
 	if len(data) == tl.WordLen {
-		code := int(binary.LittleEndian.Uint32(data))
+		code := int(int32(binary.LittleEndian.Uint32(data)))
 		return nil, ErrCode(code)
 	}
 
 	var msg messages.Common
+	var err error
 	if isPacketEncrypted(data) {
-		msg, err = messages.DeserializeEncrypted(data, t.m.GetAuthKey())
+		msg, err = messages.DeserializeEncrypted(data, m.GetAuthKey())
 	} else {
 		msg, err = messages.DeserializeUnencrypted(data)
 	}
@@ -120,6 +245,9 @@ func isPacketEncrypted(data []byte) bool {
 	return binary.LittleEndian.Uint64(authKeyHash) != 0
 }
 
+// ErrQuickAckNotSupported is returned by WriteMsgQuickAck, when message can't be quick acked.
+var ErrQuickAckNotSupported = errors.New("quick ack is not supported")
+
 type ErrCode int
 
 func (e ErrCode) Error() string {
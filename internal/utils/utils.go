@@ -19,8 +19,13 @@ import (
 // GenerateMessageId отдает по сути unix timestamp но ужасно специфическим образом
 // TODO: нахуя нужно битовое и на -4??
 func GenerateMessageId() int64 {
+	return GenerateMessageIdAt(time.Now())
+}
+
+// GenerateMessageIdAt works like GenerateMessageId, but with specific time, e.g. corrected by server time
+func GenerateMessageIdAt(now time.Time) int64 {
 	const billion = 1000 * 1000 * 1000
-	unixnano := time.Now().UnixNano()
+	unixnano := now.UnixNano()
 	seconds := unixnano / billion
 	nanoseconds := unixnano % billion
 	return (seconds << 32) | (nanoseconds & -4)
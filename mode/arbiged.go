@@ -0,0 +1,126 @@
+package mode
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+)
+
+type abridged struct {
+	conn io.ReadWriter
+	FrameLimit
+}
+
+var (
+	_ Mode       = (*abridged)(nil)
+	_ QuickAcker = (*abridged)(nil)
+)
+
+var transportModeAbridged = [...]byte{0xef} // meta:immutable
+
+func (*abridged) Variant() Variant {
+	return Abridged
+}
+
+const (
+	// If the packet length is greater than or equal to 127 words, we encode 4 bytes length, 1 is a magic
+	// number, remaining 3 is real length
+	// https://core.telegram.org/mtproto/mtproto-transports#abridged
+	magicValueSizeMoreThanSingleByte byte = 0x7f
+
+	// most significant bit of first byte of size requests quick ack
+	abridgedQuickAckFlag byte = 0x80
+)
+
+func (m *abridged) WriteMsg(msg []byte) error {
+	return m.writeMsg(msg, false)
+}
+
+func (m *abridged) WriteMsgQuickAck(msg []byte) error {
+	return m.writeMsg(msg, true)
+}
+
+func (m *abridged) writeMsg(msg []byte, quickAck bool) error {
+	if len(msg)%4 != 0 {
+		return ErrNotMultiple{Len: len(msg)}
+	}
+
+	var size []byte
+
+	msgLength := len(msg) / tl.WordLen
+	if msgLength < int(magicValueSizeMoreThanSingleByte) {
+		size = []byte{byte(msgLength)}
+	} else {
+		b1 := byte(msgLength)
+		b2 := byte(msgLength >> 8)
+		b3 := byte(msgLength >> 16)
+
+		size = []byte{magicValueSizeMoreThanSingleByte, b1, b2, b3}
+	}
+	if quickAck {
+		size[0] |= abridgedQuickAckFlag
+	}
+
+	// size and message are written at once, so frame is never split between writes
+	_, err := m.conn.Write(append(size, msg...))
+	return err
+}
+
+func (m *abridged) ReadMsg() ([]byte, error) {
+	msg, _, err := m.readMsg(false)
+	return msg, err
+}
+
+func (m *abridged) ReadMsgQuickAck() ([]byte, bool, error) {
+	return m.readMsg(true)
+}
+
+func (m *abridged) readMsg(server bool) ([]byte, bool, error) {
+	sizeBuf := make([]byte, 4)
+	if _, err := io.ReadFull(m.conn, sizeBuf[:1]); err != nil {
+		return nil, false, err
+	}
+
+	quickAck := sizeBuf[0]&abridgedQuickAckFlag != 0
+	if quickAck && !server {
+		// token is sent instead of size in big endian, so its first byte always has the flag
+		if _, err := io.ReadFull(m.conn, sizeBuf[1:]); err != nil {
+			return nil, false, err
+		}
+		return nil, false, &QuickAck{Token: binary.BigEndian.Uint32(sizeBuf)}
+	}
+	sizeBuf[0] &^= abridgedQuickAckFlag
+
+	size := 0
+
+	if sizeBuf[0] == magicValueSizeMoreThanSingleByte {
+		if _, err := io.ReadFull(m.conn, sizeBuf[:3]); err != nil {
+			return nil, false, err
+		}
+
+		size = int(binary.LittleEndian.Uint32(sizeBuf))
+	} else {
+		size = int(sizeBuf[0])
+	}
+
+	size *= tl.WordLen
+	if err := m.CheckFrameSize(size); err != nil {
+		return nil, false, err
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(m.conn, msg); err != nil {
+		return nil, false, err
+	}
+
+	return msg, quickAck, nil
+}
+
+func (m *abridged) WriteQuickAck(token uint32) error {
+	buf := make([]byte, tl.WordLen)
+	binary.BigEndian.PutUint32(buf, token|quickAckFlag)
+
+	_, err := m.conn.Write(buf)
+	return err
+}
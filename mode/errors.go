@@ -0,0 +1,72 @@
+package mode
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+)
+
+var (
+	ErrInterfaceIsNil        = errors.New("interface is nil")
+	ErrModeNotSupported      = errors.New("mode is not supported")
+	ErrAmbiguousModeAnnounce = errors.New("ambiguous mode announce, expected other byte sequence")
+)
+
+type ErrNotMultiple struct {
+	Len int
+}
+
+func (e ErrNotMultiple) Error() string {
+	msg := "size of message not multiple of 4"
+	if e.Len != 0 {
+		return fmt.Sprintf(msg+" (got %v)", e.Len)
+	}
+	return msg
+}
+
+// ErrFrameTooBig is returned, when other side announces message bigger than allowed.
+type ErrFrameTooBig struct {
+	Size int
+	Max  int
+}
+
+func (e *ErrFrameTooBig) Error() string {
+	return fmt.Sprintf("frame is too big: %v bytes, max is %v", e.Size, e.Max)
+}
+
+// ErrFrameTooSmall is returned, when other side announces size, which is smaller than required headers.
+type ErrFrameTooSmall struct {
+	Size int
+}
+
+func (e *ErrFrameTooSmall) Error() string {
+	return fmt.Sprintf("frame is too small: %v bytes", e.Size)
+}
+
+// ErrChecksumMismatch is returned by full mode, when crc32 of received packet is wrong.
+type ErrChecksumMismatch struct {
+	Expected uint32
+	Got      uint32
+}
+
+func (e *ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("wrong checksum of packet: expected %08x, got %08x", e.Expected, e.Got)
+}
+
+// ErrSeqNoMismatch is returned by full mode, when packet is lost or repeated.
+type ErrSeqNoMismatch struct {
+	Expected int32
+	Got      int32
+}
+
+func (e *ErrSeqNoMismatch) Error() string {
+	return fmt.Sprintf("wrong sequence number of packet: expected %v, got %v", e.Expected, e.Got)
+}
+
+func checkMsgSize(msg []byte) error {
+	if len(msg)%tl.WordLen != 0 {
+		return &ErrNotMultiple{Len: len(msg)}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package mode_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/mode"
+)
+
+// chunkedConn returns data by random small chunks, like tcp connection does with big messages
+type chunkedConn struct {
+	r    io.Reader
+	rand *rand.Rand
+}
+
+func (c *chunkedConn) Read(b []byte) (int, error) {
+	if len(b) > 1 {
+		b = b[:1+c.rand.Intn(len(b))]
+	}
+	return c.r.Read(b)
+}
+
+func (c *chunkedConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// countingConn counts writes to check that frame is never split
+type countingConn struct {
+	bytes.Buffer
+	writes int
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	c.writes++
+	return c.Buffer.Write(b)
+}
+
+func randomMessages(r *rand.Rand) [][]byte {
+	msgs := make([][]byte, 1+r.Intn(10))
+	for i := range msgs {
+		// sometimes messages are bigger than 127 words, so abridged uses long size
+		size := 4 * r.Intn(300)
+		if r.Intn(5) == 0 {
+			size = 4 * (1000 + r.Intn(20000))
+		}
+		msgs[i] = make([]byte, size)
+		r.Read(msgs[i])
+	}
+
+	return msgs
+}
+
+func TestFramingChunkedReads(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		msgs := randomMessages(r)
+
+		for _, variant := range []mode.Variant{mode.Abridged, mode.Intermediate, mode.PaddedIntermediate, mode.Full} {
+			for _, obfuscated := range []bool{false, true} {
+				if obfuscated && variant == mode.Full {
+					// full mode can't be obfuscated
+					continue
+				}
+
+				buf := &countingConn{}
+
+				var m mode.Mode
+				var err error
+				if obfuscated {
+					m, err = mode.NewObfuscated(variant, buf, nil, 2)
+				} else {
+					m, err = mode.New(variant, buf)
+				}
+				require.NoError(t, err)
+				buf.writes = 0
+
+				for _, msg := range msgs {
+					require.NoError(t, m.WriteMsg(msg))
+				}
+				assert.Equal(t, len(msgs), buf.writes, "every frame must be written at once")
+
+				conn := &chunkedConn{r: buf, rand: r}
+				if obfuscated {
+					m, _, err = mode.DetectObfuscated(conn, nil)
+				} else {
+					m, err = mode.Detect(conn)
+				}
+				require.NoError(t, err)
+
+				for i, msg := range msgs {
+					got, err := m.ReadMsg()
+					require.NoError(t, err, "seed %v, message %v", seed, i)
+					if variant == mode.PaddedIntermediate {
+						// padding could be removed only by message parser
+						require.True(t, len(got)-len(msg) <= 15, "seed %v, message %v: padding is too long", seed, i)
+						got = got[:len(msg)]
+					}
+					require.Equal(t, msg, got, "seed %v, message %v", seed, i)
+				}
+
+				_, err = m.ReadMsg()
+				assert.Equal(t, io.EOF, err)
+			}
+		}
+	}
+}
+
+func TestFramingTruncated(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	m, err := mode.New(mode.Intermediate, buf)
+	require.NoError(t, err)
+	require.NoError(t, m.WriteMsg([]byte("some test message")))
+	buf.Truncate(buf.Len() - 1)
+
+	m, err = mode.Detect(buf)
+	require.NoError(t, err)
+
+	_, err = m.ReadMsg()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestFramingTooBig(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		in    []byte
+		limit int
+		size  int
+	}{
+		{
+			name: "intermediate",
+			in:   []byte{0xee, 0xee, 0xee, 0xee, 0xff, 0xff, 0xff, 0x7f},
+			size: 0x7fffffff,
+		},
+		{
+			name: "abridged",
+			in:   []byte{0xef, 0x7f, 0xff, 0xff, 0xff},
+			size: 0xffffff * 4,
+		},
+		{
+			name:  "custom limit",
+			in:    []byte{0xee, 0xee, 0xee, 0xee, 0x08, 0x00, 0x00, 0x00, 0, 0, 0, 0, 0, 0, 0, 0},
+			limit: 4,
+			size:  8,
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := mode.Detect(bytes.NewBuffer(tt.in))
+			require.NoError(t, err)
+			require.NoError(t, mode.SetMaxFrameSize(m, tt.limit))
+
+			max := tt.limit
+			if max == 0 {
+				max = mode.DefaultMaxFrameSize
+			}
+
+			_, err = m.ReadMsg()
+			assert.Equal(t, &mode.ErrFrameTooBig{Size: tt.size, Max: max}, err)
+		})
+	}
+}
+
+func TestFullModeErrors(t *testing.T) {
+	packets := bytes.NewBuffer(nil)
+	m, err := mode.New(mode.Full, packets)
+	require.NoError(t, err)
+	require.NoError(t, m.WriteMsg([]byte("first")))
+	first := append([]byte{}, packets.Bytes()...)
+	require.NoError(t, m.WriteMsg([]byte("second")))
+
+	corrupted := append([]byte{}, first...)
+	corrupted[10] ^= 0xff
+
+	for _, tt := range []struct {
+		name string
+		in   []byte
+		// number of successful reads before error
+		ok   int
+		want error
+	}{
+		{
+			name: "corrupted",
+			in:   corrupted,
+			want: &mode.ErrChecksumMismatch{},
+		},
+		{
+			name: "repeated",
+			in:   append(append([]byte{}, first...), first...),
+			ok:   1,
+			want: &mode.ErrSeqNoMismatch{Expected: 1, Got: 0},
+		},
+		{
+			name: "lost",
+			in:   packets.Bytes()[len(first):],
+			want: &mode.ErrSeqNoMismatch{Expected: 0, Got: 1},
+		},
+		{
+			name: "too small",
+			in:   []byte{0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			want: &mode.ErrFrameTooSmall{Size: 8},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := mode.Detect(bytes.NewBuffer(tt.in))
+			require.NoError(t, err)
+			variant, err := mode.GetVariant(m)
+			require.NoError(t, err)
+			require.Equal(t, mode.Full, variant)
+
+			for i := 0; i < tt.ok; i++ {
+				_, err := m.ReadMsg()
+				require.NoError(t, err)
+			}
+
+			_, err = m.ReadMsg()
+			require.IsType(t, tt.want, err)
+			if _, ok := tt.want.(*mode.ErrChecksumMismatch); !ok {
+				assert.Equal(t, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package mode
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+)
+
+// full is the most reliable mode: every packet has sequence number and checksum, so lost, repeated or
+// broken packets are detected. It doesn't have announcement, server detects it by absence of other ones.
+// https://core.telegram.org/mtproto/mtproto-transports#full
+type full struct {
+	conn io.ReadWriter
+	FrameLimit
+
+	writeMutex sync.Mutex
+	writeSeqNo int32
+	readSeqNo  int32
+}
+
+var _ Mode = (*full)(nil)
+
+// length, seqno and crc32
+const fullOverhead = tl.WordLen + tl.WordLen + tl.WordLen
+
+func (*full) Variant() Variant {
+	return Full
+}
+
+func (m *full) WriteMsg(msg []byte) error {
+	m.writeMutex.Lock()
+	defer m.writeMutex.Unlock()
+
+	// whole packet is written at once, so frame is never split between writes
+	frame := make([]byte, len(msg)+fullOverhead)
+	binary.LittleEndian.PutUint32(frame, uint32(len(frame)))
+	binary.LittleEndian.PutUint32(frame[tl.WordLen:], uint32(m.writeSeqNo))
+	copy(frame[tl.WordLen*2:], msg)
+	checksumStart := len(frame) - tl.WordLen
+	binary.LittleEndian.PutUint32(frame[checksumStart:], crc32.ChecksumIEEE(frame[:checksumStart]))
+
+	if _, err := m.conn.Write(frame); err != nil {
+		return err
+	}
+	m.writeSeqNo++
+
+	return nil
+}
+
+func (m *full) ReadMsg() ([]byte, error) {
+	sizeBuf := make([]byte, tl.WordLen)
+	if _, err := io.ReadFull(m.conn, sizeBuf); err != nil {
+		return nil, err
+	}
+
+	size := int(binary.LittleEndian.Uint32(sizeBuf))
+	if size < fullOverhead {
+		return nil, &ErrFrameTooSmall{Size: size}
+	}
+	if err := m.CheckFrameSize(size - fullOverhead); err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, size)
+	copy(frame, sizeBuf)
+	if _, err := io.ReadFull(m.conn, frame[tl.WordLen:]); err != nil {
+		return nil, err
+	}
+
+	checksumStart := len(frame) - tl.WordLen
+	expected := crc32.ChecksumIEEE(frame[:checksumStart])
+	if got := binary.LittleEndian.Uint32(frame[checksumStart:]); got != expected {
+		return nil, &ErrChecksumMismatch{Expected: expected, Got: got}
+	}
+
+	seqNo := int32(binary.LittleEndian.Uint32(frame[tl.WordLen:]))
+	if seqNo != m.readSeqNo {
+		return nil, &ErrSeqNoMismatch{Expected: m.readSeqNo, Got: seqNo}
+	}
+	m.readSeqNo++
+
+	return frame[tl.WordLen*2 : checksumStart], nil
+}
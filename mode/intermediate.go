@@ -0,0 +1,102 @@
+package mode
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+)
+
+type intermediate struct {
+	conn io.ReadWriter
+	FrameLimit
+}
+
+var (
+	_ Mode       = (*intermediate)(nil)
+	_ QuickAcker = (*intermediate)(nil)
+)
+
+var transportModeIntermediate = [...]byte{0xee, 0xee, 0xee, 0xee} // meta:immutable
+
+func (*intermediate) Variant() Variant {
+	return Intermediate
+}
+
+func (m *intermediate) WriteMsg(msg []byte) error {
+	return m.writeMsg(msg, false)
+}
+
+func (m *intermediate) WriteMsgQuickAck(msg []byte) error {
+	return m.writeMsg(msg, true)
+}
+
+func (m *intermediate) writeMsg(msg []byte, quickAck bool) error {
+	// size and message are written at once, so frame is never split between writes
+	frame := make([]byte, tl.WordLen+len(msg))
+	putSize(frame, len(msg), quickAck)
+	copy(frame[tl.WordLen:], msg)
+
+	_, err := m.conn.Write(frame)
+	return err
+}
+
+func (m *intermediate) ReadMsg() ([]byte, error) {
+	msg, _, err := readSizedMsg(m.conn, &m.FrameLimit, false)
+	return msg, err
+}
+
+func (m *intermediate) ReadMsgQuickAck() ([]byte, bool, error) {
+	return readSizedMsg(m.conn, &m.FrameLimit, true)
+}
+
+func (m *intermediate) WriteQuickAck(token uint32) error {
+	return writeQuickAck(m.conn, token)
+}
+
+// putSize writes size of message in the way of intermediate modes: 4 bytes little endian, where most
+// significant bit requests quick ack.
+func putSize(b []byte, size int, quickAck bool) {
+	s := uint32(size)
+	if quickAck {
+		s |= quickAckFlag
+	}
+	binary.LittleEndian.PutUint32(b, s)
+}
+
+// readSizedMsg reads message, which is prefixed by its size, like in intermediate modes. If server is
+// false, size with quick ack flag is a token from server, otherwise it's a request of quick ack from
+// client.
+func readSizedMsg(conn io.Reader, limit *FrameLimit, server bool) ([]byte, bool, error) {
+	sizeBuf := make([]byte, tl.WordLen)
+	if _, err := io.ReadFull(conn, sizeBuf); err != nil {
+		return nil, false, err
+	}
+
+	rawSize := binary.LittleEndian.Uint32(sizeBuf)
+	quickAck := rawSize&quickAckFlag != 0
+	if quickAck && !server {
+		return nil, false, &QuickAck{Token: rawSize}
+	}
+
+	size := int(rawSize &^ quickAckFlag)
+	if err := limit.CheckFrameSize(size); err != nil {
+		return nil, false, err
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, false, err
+	}
+
+	return msg, quickAck, nil
+}
+
+// writeQuickAck sends token instead of size of message, like in intermediate modes.
+func writeQuickAck(conn io.Writer, token uint32) error {
+	buf := make([]byte, tl.WordLen)
+	binary.LittleEndian.PutUint32(buf, token|quickAckFlag)
+
+	_, err := conn.Write(buf)
+	return err
+}
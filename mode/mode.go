@@ -0,0 +1,163 @@
+package mode
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Mode is an interface which handles many ways as the connection sides must determine the size of the
+// transmitted messages. Unlike HTTP or UDP connections, raw TCP connections, as well as WebSockets doesn't
+// have a standard way to determine the size of the transmitted or received message: their main purpose is
+// just to transmit bytes with right order. Mode allows the sides of the connection don't analyze traffic or
+// use any end message sequence. In fact, in MTProto world, Mode works like microprotocol, which is packaging
+// messages in the container that announces its size in advance
+//
+// Mode doesn't write or read announcement by itself: it's made by New and Detect, using Spec of mode, so
+// custom modes could be added with Register.
+type Mode interface {
+	WriteMsg([]byte) error // this is not same as the io.Writer
+	ReadMsg() ([]byte, error)
+
+	// Variant returns id of mode, which it was registered with
+	Variant() Variant
+}
+
+type Variant uint8
+
+const (
+	Abridged Variant = iota
+	Intermediate
+	PaddedIntermediate
+	Full
+)
+
+func New(v Variant, conn io.ReadWriter) (Mode, error) {
+	if conn == nil {
+		return nil, ErrInterfaceIsNil
+	}
+
+	spec, ok := Lookup(v)
+	if !ok {
+		return nil, ErrModeNotSupported
+	}
+
+	// mode could have no announcement (like full), and empty write could be sent as empty packet (e.g. in
+	// websocket)
+	if len(spec.Announcement) > 0 {
+		if _, err := conn.Write(spec.Announcement); err != nil {
+			return nil, errors.Wrap(err, "can't setup connection")
+		}
+	}
+
+	return spec.Init(conn), nil
+}
+
+// Detect detects mode based on first byte sequence returned from conn. Announcements of all registered modes
+// are checked, if no one matches, fallback mode is used (full, by default), and bytes which were already
+// read are returned back to it.
+func Detect(conn io.ReadWriter) (Mode, error) {
+	if conn == nil {
+		return nil, ErrInterfaceIsNil
+	}
+
+	specs := registeredSpecs()
+
+	var read []byte
+	b := []byte{0x0}
+	for {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil, err
+		}
+		read = append(read, b[0])
+
+		candidates := 0
+		for _, spec := range specs {
+			if !bytes.HasPrefix(spec.Announcement, read) {
+				continue
+			}
+			// announcements can't be prefixes of each other, so full match is always single
+			if len(spec.Announcement) == len(read) {
+				return spec.Init(conn), nil
+			}
+			candidates++
+		}
+
+		if candidates == 0 {
+			break
+		}
+	}
+
+	fallback, ok := fallbackSpec(specs)
+	if !ok {
+		return nil, ErrAmbiguousModeAnnounce
+	}
+
+	return fallback.Init(&prefixedConn{
+		Reader: io.MultiReader(bytes.NewReader(read), conn),
+		Writer: conn,
+	}), nil
+}
+
+// prefixedConn returns bytes, which were read during detection, before reading from connection.
+type prefixedConn struct {
+	io.Reader
+	io.Writer
+}
+
+// DefaultMaxFrameSize is a maximum size of single message, which mode reads by default. Real messages are
+// much smaller (about 1mb), so bigger size means that stream is broken or other side is malicious.
+const DefaultMaxFrameSize = 1 << 24
+
+// FrameLimiter is implemented by modes, which can limit size of read messages. All builtin modes implement
+// it, custom ones could do it by embedding FrameLimit.
+type FrameLimiter interface {
+	SetMaxFrameSize(size int)
+}
+
+// SetMaxFrameSize limits size of messages, which mode reads: bigger frames are rejected before allocating
+// memory for them. Zero or negative size means DefaultMaxFrameSize. It must be called before reading.
+func SetMaxFrameSize(m Mode, size int) error {
+	l, ok := m.(FrameLimiter)
+	if !ok {
+		return errors.New("mode doesn't support frame size limit")
+	}
+
+	l.SetMaxFrameSize(size)
+	return nil
+}
+
+// FrameLimit is embedded in all modes, which announce size of messages. Zero value uses
+// DefaultMaxFrameSize.
+type FrameLimit struct {
+	max int
+}
+
+var _ FrameLimiter = (*FrameLimit)(nil)
+
+func (l *FrameLimit) SetMaxFrameSize(size int) {
+	l.max = size
+}
+
+// CheckFrameSize must be called with announced size of message before reading it. It returns
+// *ErrFrameTooBig, if size is greater than limit.
+func (l *FrameLimit) CheckFrameSize(size int) error {
+	max := l.max
+	if max <= 0 {
+		max = DefaultMaxFrameSize
+	}
+	if size < 0 || size > max {
+		return &ErrFrameTooBig{Size: size, Max: max}
+	}
+
+	return nil
+}
+
+func GetVariant(m Mode) (Variant, error) {
+	if m == nil {
+		return Variant(0xff), ErrInterfaceIsNil
+	}
+
+	return m.Variant(), nil
+}
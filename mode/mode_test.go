@@ -6,7 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
-	mode "github.com/xelaj/mtproto/internal/mode"
+	mode "github.com/xelaj/mtproto/mode"
 )
 
 func TestModeEncode(t *testing.T) {
@@ -29,6 +29,16 @@ func TestModeEncode(t *testing.T) {
 				0x73, 0x61, 0x67, 0x65,
 			},
 		},
+		{
+			name: "full, without announcement",
+			in:   []byte("test message"),
+			mode: mode.Full,
+			expect: []byte{
+				0x18, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x74, 0x65, 0x73, 0x74, 0x20, 0x6d, 0x65, 0x73,
+				0x73, 0x61, 0x67, 0x65, 0xfe, 0x47, 0x91, 0x16,
+			},
+		},
 		{
 			name: "arbiged, most unstable",
 			in:   []byte("test message"),
@@ -80,6 +90,26 @@ func TestModeDecode(t *testing.T) {
 			mode:   mode.Intermediate,
 			expect: []byte("test message"),
 		},
+		{
+			name: "padded intermediate",
+			in: []byte{
+				0xdd, 0xdd, 0xdd, 0xdd, 0x0f, 0x00, 0x00, 0x00,
+				0x74, 0x65, 0x73, 0x74, 0x20, 0x6d, 0x65, 0x73,
+				0x73, 0x61, 0x67, 0x65, 0x01, 0x02, 0x03,
+			},
+			mode:   mode.PaddedIntermediate,
+			expect: []byte{0x74, 0x65, 0x73, 0x74, 0x20, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x01, 0x02, 0x03},
+		},
+		{
+			name: "full, without announcement",
+			in: []byte{
+				0x18, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x74, 0x65, 0x73, 0x74, 0x20, 0x6d, 0x65, 0x73,
+				0x73, 0x61, 0x67, 0x65, 0xfe, 0x47, 0x91, 0x16,
+			},
+			mode:   mode.Full,
+			expect: []byte("test message"),
+		},
 		{
 			name: "arbiged, most unstable",
 			in: []byte{
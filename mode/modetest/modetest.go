@@ -0,0 +1,248 @@
+// Package modetest contains conformance tests for transport modes. Every mode, builtin or registered with
+// mode.Register, must pass them:
+//
+//	func TestMyMode(t *testing.T) {
+//		require.NoError(t, mode.Register(mode.Spec{...}))
+//		modetest.Run(t, myVariant)
+//	}
+package modetest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/mode"
+)
+
+// seeds is a count of random message sets, which are checked by every test
+const seeds = 20
+
+// Run checks registered mode: messages must be written by single write and read back by any chunks, also
+// mode must be detected by its announcement (and obfuscated tag, if it's set).
+func Run(t *testing.T, v mode.Variant) {
+	t.Helper()
+
+	spec, ok := mode.Lookup(v)
+	require.True(t, ok, "mode %v is not registered", v)
+
+	t.Run("RoundTrip", func(t *testing.T) { testRoundTrip(t, spec, false) })
+	t.Run("Obfuscated", func(t *testing.T) {
+		if len(spec.ObfuscatedTag) == 0 {
+			t.Skip("mode can't be obfuscated")
+		}
+		testRoundTrip(t, spec, true)
+	})
+	t.Run("BothDirections", func(t *testing.T) { testBothDirections(t, spec) })
+	t.Run("Truncated", func(t *testing.T) { testTruncated(t, spec) })
+	t.Run("FrameLimit", func(t *testing.T) { testFrameLimit(t, spec) })
+	t.Run("QuickAck", func(t *testing.T) { testQuickAck(t, spec) })
+}
+
+// Messages returns random messages, their sizes are multiple of 4, like sizes of real mtproto messages.
+// Some of them are bigger than 127 words, cause it's a usual edge case of modes.
+func Messages(r *rand.Rand) [][]byte {
+	msgs := make([][]byte, 1+r.Intn(10))
+	for i := range msgs {
+		size := 4 * r.Intn(300)
+		if r.Intn(5) == 0 {
+			size = 4 * (1000 + r.Intn(20000))
+		}
+		msgs[i] = make([]byte, size)
+		r.Read(msgs[i])
+	}
+
+	return msgs
+}
+
+// ChunkedReader returns data by random small chunks, like tcp connection does with big messages.
+type ChunkedReader struct {
+	R    io.Reader
+	Rand *rand.Rand
+}
+
+func (c *ChunkedReader) Read(b []byte) (int, error) {
+	if len(b) > 1 {
+		b = b[:1+c.Rand.Intn(len(b))]
+	}
+	return c.R.Read(b)
+}
+
+// countingConn counts writes to check that frame is never split
+type countingConn struct {
+	bytes.Buffer
+	writes int
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	c.writes++
+	return c.Buffer.Write(b)
+}
+
+// duplex is a one side of connection: reads what other side wrote and vice versa
+type duplex struct {
+	io.Reader
+	io.Writer
+}
+
+func newMode(t *testing.T, spec mode.Spec, conn io.ReadWriter, obfuscated bool) mode.Mode {
+	t.Helper()
+
+	var m mode.Mode
+	var err error
+	if obfuscated {
+		m, err = mode.NewObfuscated(spec.Variant, conn, nil, 2)
+	} else {
+		m, err = mode.New(spec.Variant, conn)
+	}
+	require.NoError(t, err)
+	require.Equal(t, spec.Variant, m.Variant())
+
+	return m
+}
+
+func detectMode(t *testing.T, spec mode.Spec, conn io.ReadWriter, obfuscated bool) mode.Mode {
+	t.Helper()
+
+	var m mode.Mode
+	var err error
+	if obfuscated {
+		m, _, err = mode.DetectObfuscated(conn, nil)
+	} else {
+		m, err = mode.Detect(conn)
+	}
+	require.NoError(t, err)
+	require.Equal(t, spec.Variant, m.Variant(), "detected other mode")
+
+	return m
+}
+
+// requireMessage checks received message, ignoring padding, which could be added by mode.
+func requireMessage(t *testing.T, spec mode.Spec, expected, got []byte, msgAndArgs ...interface{}) {
+	t.Helper()
+
+	require.True(t, len(got) >= len(expected) && len(got)-len(expected) <= spec.MaxPadding,
+		"unexpected size of message: %v, expected %v", len(got), len(expected))
+	require.Equal(t, expected, got[:len(expected)], msgAndArgs...)
+}
+
+func testRoundTrip(t *testing.T, spec mode.Spec, obfuscated bool) {
+	for seed := int64(0); seed < seeds; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		msgs := Messages(r)
+
+		buf := &countingConn{}
+		m := newMode(t, spec, buf, obfuscated)
+		buf.writes = 0
+
+		for _, msg := range msgs {
+			require.NoError(t, m.WriteMsg(msg))
+		}
+		assert.Equal(t, len(msgs), buf.writes, "every frame must be written at once")
+
+		m = detectMode(t, spec, duplex{&ChunkedReader{R: buf, Rand: r}, ioutil.Discard}, obfuscated)
+		for i, msg := range msgs {
+			got, err := m.ReadMsg()
+			require.NoError(t, err, "seed %v, message %v", seed, i)
+			requireMessage(t, spec, msg, got, "seed %v, message %v", seed, i)
+		}
+
+		_, err := m.ReadMsg()
+		assert.Equal(t, io.EOF, err, "seed %v: stream is finished between frames", seed)
+	}
+}
+
+func testBothDirections(t *testing.T, spec mode.Spec) {
+	toServer, toClient := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+
+	client := newMode(t, spec, duplex{toClient, toServer}, false)
+	require.NoError(t, client.WriteMsg([]byte("ping")))
+
+	server := detectMode(t, spec, duplex{toServer, toClient}, false)
+	got, err := server.ReadMsg()
+	require.NoError(t, err)
+	requireMessage(t, spec, []byte("ping"), got)
+
+	// server never sends announcement
+	require.NoError(t, server.WriteMsg([]byte("pong")))
+	got, err = client.ReadMsg()
+	require.NoError(t, err)
+	requireMessage(t, spec, []byte("pong"), got)
+}
+
+func testTruncated(t *testing.T, spec mode.Spec) {
+	buf := bytes.NewBuffer(nil)
+	m := newMode(t, spec, buf, false)
+	require.NoError(t, m.WriteMsg([]byte("some test message...")))
+	buf.Truncate(buf.Len() - 1)
+
+	m = detectMode(t, spec, duplex{buf, ioutil.Discard}, false)
+	_, err := m.ReadMsg()
+	assert.Equal(t, io.ErrUnexpectedEOF, errors.Cause(err))
+}
+
+func testFrameLimit(t *testing.T, spec mode.Spec) {
+	buf := bytes.NewBuffer(nil)
+	m := newMode(t, spec, buf, false)
+	if _, ok := m.(mode.FrameLimiter); !ok {
+		t.Skip("mode doesn't limit frame size")
+	}
+	msg := make([]byte, 64)
+	require.NoError(t, m.WriteMsg(msg))
+	require.NoError(t, m.WriteMsg(msg))
+
+	m = detectMode(t, spec, duplex{buf, ioutil.Discard}, false)
+	require.NoError(t, mode.SetMaxFrameSize(m, 128))
+	_, err := m.ReadMsg()
+	require.NoError(t, err, "message is smaller than limit")
+
+	require.NoError(t, mode.SetMaxFrameSize(m, 16))
+	_, err = m.ReadMsg()
+	require.IsType(t, &mode.ErrFrameTooBig{}, errors.Cause(err))
+}
+
+func testQuickAck(t *testing.T, spec mode.Spec) {
+	toServer, toClient := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+
+	client := newMode(t, spec, duplex{toClient, toServer}, false)
+	clientAcker, ok := client.(mode.QuickAcker)
+	if !ok {
+		t.Skip("mode doesn't support quick acks")
+	}
+	big := make([]byte, 4*1000)
+	require.NoError(t, clientAcker.WriteMsgQuickAck([]byte("ping")))
+	require.NoError(t, clientAcker.WriteMsgQuickAck(big))
+	require.NoError(t, client.WriteMsg([]byte("ping")))
+
+	server := detectMode(t, spec, duplex{toServer, toClient}, false)
+	serverAcker, ok := server.(mode.QuickAcker)
+	require.True(t, ok, "detected mode must support quick acks too")
+	for _, tt := range []struct {
+		msg      []byte
+		quickAck bool
+	}{
+		{[]byte("ping"), true},
+		{big, true},
+		{[]byte("ping"), false},
+	} {
+		got, quickAck, err := serverAcker.ReadMsgQuickAck()
+		require.NoError(t, err)
+		requireMessage(t, spec, tt.msg, got)
+		assert.Equal(t, tt.quickAck, quickAck)
+	}
+
+	require.NoError(t, serverAcker.WriteQuickAck(0x12345678))
+	require.NoError(t, server.WriteMsg([]byte("pong")))
+
+	_, err := client.ReadMsg()
+	assert.Equal(t, &mode.QuickAck{Token: 0x92345678}, err, "token always has most significant bit")
+	got, err := client.ReadMsg()
+	require.NoError(t, err, "stream must be fine after quick ack")
+	requireMessage(t, spec, []byte("pong"), got)
+}
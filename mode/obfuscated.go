@@ -0,0 +1,206 @@
+package mode
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Obfuscated2 makes traffic look like random bytes: connection starts with 64 bytes random header, which
+// contains keys and mode tag, then everything is encrypted by AES-256-CTR in both directions. It's required
+// by MTProxy, but telegram servers accept it too.
+// https://core.telegram.org/mtproto/mtproto-transports#transport-obfuscation
+
+const (
+	obfuscatedHeaderLen = 64
+
+	// positions of fields inside header
+	obfuscatedKeyStart = 8
+	obfuscatedKeyEnd   = 40
+	obfuscatedIVEnd    = 56
+	obfuscatedTagEnd   = 60
+	obfuscatedDCEnd    = 62
+)
+
+// these first words are forbidden, cause server must not confuse obfuscated header with other protocols.
+// Announcements of registered modes are forbidden too.
+var forbiddenHeaderStarts = [][]byte{
+	[]byte("HEAD"),
+	[]byte("POST"),
+	[]byte("GET "),
+	[]byte("OPTI"),
+	{0x16, 0x03, 0x01, 0x02}, // tls handshake
+}
+
+// NewObfuscated works like New, but wraps conn in obfuscated2 stream. Mode tag is sent inside encrypted
+// header instead of plain announcement. secret is a key of MTProxy (16 bytes, without dd/ee prefix), it
+// could be nil for direct connections to telegram. dc is id of datacenter, which proxy must connect to.
+func NewObfuscated(v Variant, conn io.ReadWriter, secret []byte, dc int16) (Mode, error) {
+	if conn == nil {
+		return nil, ErrInterfaceIsNil
+	}
+
+	spec, ok := Lookup(v)
+	if !ok || len(spec.ObfuscatedTag) == 0 {
+		return nil, ErrModeNotSupported
+	}
+
+	header, err := generateObfuscatedHeader(spec.ObfuscatedTag, dc)
+	if err != nil {
+		return nil, err
+	}
+
+	reversed := reverseBytes(header[obfuscatedKeyStart:obfuscatedIVEnd])
+	o := &obfuscatedConn{conn: conn}
+	o.encryptor, err = obfuscatedStream(header[obfuscatedKeyStart:obfuscatedIVEnd], secret)
+	if err != nil {
+		return nil, err
+	}
+	o.decryptor, err = obfuscatedStream(reversed, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// only tag, dc and padding are encrypted in header, but stream must be shifted by whole header
+	encrypted := make([]byte, obfuscatedHeaderLen)
+	o.encryptor.XORKeyStream(encrypted, header)
+	copy(header[obfuscatedIVEnd:], encrypted[obfuscatedIVEnd:])
+
+	if _, err := conn.Write(header); err != nil {
+		return nil, errors.Wrap(err, "can't setup connection")
+	}
+
+	return spec.Init(o), nil
+}
+
+// DetectObfuscated is a server side of NewObfuscated: it reads obfuscated header, checks it and returns mode,
+// which was requested by client, and id of datacenter from header.
+func DetectObfuscated(conn io.ReadWriter, secret []byte) (Mode, int16, error) {
+	if conn == nil {
+		return nil, 0, ErrInterfaceIsNil
+	}
+
+	header := make([]byte, obfuscatedHeaderLen)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, 0, err
+	}
+
+	reversed := reverseBytes(header[obfuscatedKeyStart:obfuscatedIVEnd])
+	o := &obfuscatedConn{conn: conn}
+	var err error
+	o.decryptor, err = obfuscatedStream(header[obfuscatedKeyStart:obfuscatedIVEnd], secret)
+	if err != nil {
+		return nil, 0, err
+	}
+	o.encryptor, err = obfuscatedStream(reversed, secret)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	decrypted := make([]byte, obfuscatedHeaderLen)
+	o.decryptor.XORKeyStream(decrypted, header)
+
+	spec, ok := specByObfuscatedTag(decrypted[obfuscatedIVEnd:obfuscatedTagEnd])
+	if !ok {
+		return nil, 0, ErrAmbiguousModeAnnounce
+	}
+	dc := int16(binary.LittleEndian.Uint16(decrypted[obfuscatedTagEnd:obfuscatedDCEnd]))
+
+	return spec.Init(o), dc, nil
+}
+
+func generateObfuscatedHeader(tag []byte, dc int16) ([]byte, error) {
+	header := make([]byte, obfuscatedHeaderLen)
+	for {
+		if _, err := rand.Read(header); err != nil {
+			return nil, errors.Wrap(err, "generating header")
+		}
+
+		if validObfuscatedHeader(header) {
+			break
+		}
+	}
+
+	copy(header[obfuscatedIVEnd:], tag)
+	binary.LittleEndian.PutUint16(header[obfuscatedTagEnd:], uint16(dc))
+
+	return header, nil
+}
+
+func validObfuscatedHeader(header []byte) bool {
+	for _, spec := range registeredSpecs() {
+		if len(spec.Announcement) > 0 && bytes.HasPrefix(header, spec.Announcement) {
+			return false
+		}
+	}
+	for _, start := range forbiddenHeaderStarts {
+		if bytes.Equal(header[:4], start) {
+			return false
+		}
+	}
+
+	// second word can't be zero, otherwise header looks like full mode
+	return !bytes.Equal(header[4:8], []byte{0, 0, 0, 0})
+}
+
+// obfuscatedStream creates AES-256-CTR stream from 48 bytes of key and iv. If secret is set, key is mixed
+// with it.
+func obfuscatedStream(keyAndIV, secret []byte) (cipher.Stream, error) {
+	key := keyAndIV[:obfuscatedKeyEnd-obfuscatedKeyStart]
+	iv := keyAndIV[obfuscatedKeyEnd-obfuscatedKeyStart:]
+
+	if len(secret) > 0 {
+		hash := sha256.Sum256(append(append([]byte{}, key...), secret...))
+		key = hash[:]
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating cipher")
+	}
+
+	return cipher.NewCTR(block, iv), nil
+}
+
+func reverseBytes(b []byte) []byte {
+	res := make([]byte, len(b))
+	for i := range b {
+		res[len(b)-1-i] = b[i]
+	}
+
+	return res
+}
+
+// obfuscatedConn encrypts everything, what mode writes, and decrypts everything, what mode reads.
+type obfuscatedConn struct {
+	conn io.ReadWriter
+
+	// stream ciphers are stateful, so writes must not mix
+	writeMutex sync.Mutex
+	encryptor  cipher.Stream
+	decryptor  cipher.Stream
+}
+
+func (o *obfuscatedConn) Write(b []byte) (int, error) {
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+
+	encrypted := make([]byte, len(b))
+	o.encryptor.XORKeyStream(encrypted, b)
+
+	return o.conn.Write(encrypted)
+}
+
+func (o *obfuscatedConn) Read(b []byte) (int, error) {
+	n, err := o.conn.Read(b)
+	o.decryptor.XORKeyStream(b[:n], b[:n])
+
+	return n, err
+}
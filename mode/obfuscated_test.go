@@ -0,0 +1,68 @@
+package mode_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mode "github.com/xelaj/mtproto/mode"
+)
+
+// duplex is a one side of connection: reads what other side wrote and vice versa
+type duplex struct {
+	io.Reader
+	io.Writer
+}
+
+func TestObfuscatedRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		mode   mode.Variant
+		secret []byte
+	}{
+		{name: "intermediate", mode: mode.Intermediate},
+		{name: "abridged", mode: mode.Abridged},
+		{name: "intermediate with secret", mode: mode.Intermediate, secret: bytes.Repeat([]byte{0x42}, 16)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			toServer, toClient := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+
+			client, err := mode.NewObfuscated(tt.mode, duplex{toClient, toServer}, tt.secret, -2)
+			require.NoError(t, err)
+			require.Equal(t, 64, toServer.Len())
+
+			require.NoError(t, client.WriteMsg([]byte("test message")))
+			assert.NotContains(t, toServer.String(), "test message")
+
+			server, dc, err := mode.DetectObfuscated(duplex{toServer, toClient}, tt.secret)
+			require.NoError(t, err)
+			assert.Equal(t, int16(-2), dc)
+
+			variant, err := mode.GetVariant(server)
+			require.NoError(t, err)
+			assert.Equal(t, tt.mode, variant)
+
+			got, err := server.ReadMsg()
+			require.NoError(t, err)
+			assert.Equal(t, []byte("test message"), got)
+
+			require.NoError(t, server.WriteMsg([]byte("test answer!")))
+			got, err = client.ReadMsg()
+			require.NoError(t, err)
+			assert.Equal(t, []byte("test answer!"), got)
+		})
+	}
+}
+
+func TestObfuscatedWrongSecret(t *testing.T) {
+	toServer, toClient := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+
+	_, err := mode.NewObfuscated(mode.Intermediate, duplex{toClient, toServer}, bytes.Repeat([]byte{1}, 16), 2)
+	require.NoError(t, err)
+
+	_, _, err = mode.DetectObfuscated(duplex{toServer, toClient}, bytes.Repeat([]byte{2}, 16))
+	assert.Error(t, err)
+}
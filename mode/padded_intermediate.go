@@ -0,0 +1,72 @@
+package mode
+
+import (
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+)
+
+// paddedIntermediate is the same as intermediate, but random padding (0-15 bytes) is added to every
+// message, so size of packets doesn't disclose real size of messages. Padding is a part of message for
+// mode, it could be removed only by message parser.
+// https://core.telegram.org/mtproto/mtproto-transports#padded-intermediate
+type paddedIntermediate struct {
+	conn io.ReadWriter
+	FrameLimit
+}
+
+var (
+	_ Mode       = (*paddedIntermediate)(nil)
+	_ QuickAcker = (*paddedIntermediate)(nil)
+)
+
+var transportModePaddedIntermediate = [...]byte{0xdd, 0xdd, 0xdd, 0xdd} // meta:immutable
+
+const maxPaddingLen = 15
+
+func (*paddedIntermediate) Variant() Variant {
+	return PaddedIntermediate
+}
+
+func (m *paddedIntermediate) WriteMsg(msg []byte) error {
+	return m.writeMsg(msg, false)
+}
+
+func (m *paddedIntermediate) WriteMsgQuickAck(msg []byte) error {
+	return m.writeMsg(msg, true)
+}
+
+func (m *paddedIntermediate) writeMsg(msg []byte, quickAck bool) error {
+	paddingLen := make([]byte, 1)
+	if _, err := rand.Read(paddingLen); err != nil {
+		return errors.Wrap(err, "generating padding")
+	}
+	size := len(msg) + int(paddingLen[0]&maxPaddingLen)
+
+	// size, message and padding are written at once, so frame is never split between writes
+	frame := make([]byte, tl.WordLen+size)
+	putSize(frame, size, quickAck)
+	copy(frame[tl.WordLen:], msg)
+	if _, err := rand.Read(frame[tl.WordLen+len(msg):]); err != nil {
+		return errors.Wrap(err, "generating padding")
+	}
+
+	_, err := m.conn.Write(frame)
+	return err
+}
+
+func (m *paddedIntermediate) ReadMsg() ([]byte, error) {
+	msg, _, err := readSizedMsg(m.conn, &m.FrameLimit, false)
+	return msg, err
+}
+
+func (m *paddedIntermediate) ReadMsgQuickAck() ([]byte, bool, error) {
+	return readSizedMsg(m.conn, &m.FrameLimit, true)
+}
+
+func (m *paddedIntermediate) WriteQuickAck(token uint32) error {
+	return writeQuickAck(m.conn, token)
+}
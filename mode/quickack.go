@@ -0,0 +1,39 @@
+package mode
+
+import (
+	"fmt"
+)
+
+// QuickAcker is implemented by modes, which support quick acks: client could ask server to confirm, that
+// message is received, even before it's handled. Server confirms message by short token, which is derived
+// from message, so client must compute it by itself to find out, which message is confirmed.
+//
+// Abridged, intermediate and padded intermediate modes support quick acks, full mode doesn't.
+// https://core.telegram.org/mtproto/mtproto-transports#quick-ack
+type QuickAcker interface {
+	// WriteMsgQuickAck works like WriteMsg, but asks other side for quick ack. Received token is returned by
+	// ReadMsg as *QuickAck error.
+	WriteMsgQuickAck(msg []byte) error
+
+	// ReadMsgQuickAck is a server side of WriteMsgQuickAck: it works like ReadMsg, but also returns, whether
+	// client asked for quick ack. Server must read messages only by this method, cause ReadMsg treats
+	// request of quick ack as a token.
+	ReadMsgQuickAck() (msg []byte, quickAck bool, err error)
+
+	// WriteQuickAck sends token to client. Most significant bit of token is always set.
+	WriteQuickAck(token uint32) error
+}
+
+// quickAckFlag is a most significant bit of size, which means quick ack request (from client) or token (from
+// server).
+const quickAckFlag = 1 << 31
+
+// QuickAck is returned by ReadMsg instead of message, when server confirms receiving of message. It's not a
+// real error: connection is still fine and next message could be read.
+type QuickAck struct {
+	Token uint32
+}
+
+func (e *QuickAck) Error() string {
+	return fmt.Sprintf("quick ack %08x", e.Token)
+}
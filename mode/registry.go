@@ -0,0 +1,163 @@
+package mode
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Spec describes how mode is announced and detected. Builtin modes are registered by default, custom ones
+// could be added with Register, then New, Detect, NewObfuscated and DetectObfuscated will use them like
+// builtin ones.
+type Spec struct {
+	Variant Variant
+	// Name is used only for error messages
+	Name string
+
+	// Announcement is written by client before first message, server uses it to detect mode. Announcements
+	// of different modes can't be prefixes of each other. Only fallback mode could have empty announcement.
+	Announcement []byte
+	// ObfuscatedTag is a 4 bytes tag, which is sent inside obfuscated2 header instead of announcement. If
+	// it's empty, mode can't be obfuscated.
+	ObfuscatedTag []byte
+	// Fallback mode is used by Detect, when none of announcements matches first bytes of connection. Only
+	// one mode could be fallback.
+	Fallback bool
+	// MaxPadding is a maximum count of random bytes, which mode appends to messages. Padding isn't removed
+	// by mode itself, so it's required for checking modes in tests.
+	MaxPadding int
+
+	// Init creates mode over connection. Announcement is already written (or read) at this moment.
+	Init func(conn io.ReadWriter) Mode
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[Variant]Spec)
+)
+
+// obfuscatedTagLen is a size of tag in obfuscated2 header
+const obfuscatedTagLen = 4
+
+func init() {
+	for _, spec := range []Spec{
+		{
+			Variant:       Abridged,
+			Name:          "abridged",
+			Announcement:  transportModeAbridged[:],
+			ObfuscatedTag: bytes.Repeat(transportModeAbridged[:], obfuscatedTagLen),
+			Init:          func(conn io.ReadWriter) Mode { return &abridged{conn: conn} },
+		},
+		{
+			Variant:       Intermediate,
+			Name:          "intermediate",
+			Announcement:  transportModeIntermediate[:],
+			ObfuscatedTag: transportModeIntermediate[:],
+			Init:          func(conn io.ReadWriter) Mode { return &intermediate{conn: conn} },
+		},
+		{
+			Variant:       PaddedIntermediate,
+			Name:          "padded intermediate",
+			Announcement:  transportModePaddedIntermediate[:],
+			ObfuscatedTag: transportModePaddedIntermediate[:],
+			MaxPadding:    maxPaddingLen,
+			Init:          func(conn io.ReadWriter) Mode { return &paddedIntermediate{conn: conn} },
+		},
+		{
+			Variant:  Full,
+			Name:     "full",
+			Fallback: true,
+			Init:     func(conn io.ReadWriter) Mode { return &full{conn: conn} },
+		},
+	} {
+		if err := Register(spec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register adds custom mode. It returns error, if variant is already used, or if mode could be confused with
+// other one: announcements are prefixes of each other, obfuscated tags are same or both modes are fallback.
+func Register(spec Spec) error {
+	if spec.Init == nil {
+		return errors.Errorf("mode %q: Init is nil", spec.Name)
+	}
+	if len(spec.Announcement) == 0 && !spec.Fallback {
+		return errors.Errorf("mode %q: only fallback mode could have empty announcement", spec.Name)
+	}
+	if len(spec.Announcement) > 0 && spec.Fallback {
+		return errors.Errorf("mode %q: fallback mode can't have announcement", spec.Name)
+	}
+	if len(spec.ObfuscatedTag) != 0 && len(spec.ObfuscatedTag) != obfuscatedTagLen {
+		return errors.Errorf("mode %q: obfuscated tag must be %v bytes", spec.Name, obfuscatedTagLen)
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	for _, other := range registry {
+		switch {
+		case other.Variant == spec.Variant:
+			return errors.Errorf("mode %q: variant %v is already used by %q", spec.Name, spec.Variant, other.Name)
+		case other.Fallback && spec.Fallback:
+			return errors.Errorf("mode %q: %q is already fallback", spec.Name, other.Name)
+		case len(spec.Announcement) > 0 && len(other.Announcement) > 0 &&
+			(bytes.HasPrefix(spec.Announcement, other.Announcement) ||
+				bytes.HasPrefix(other.Announcement, spec.Announcement)):
+			return errors.Errorf("mode %q: announcement conflicts with %q", spec.Name, other.Name)
+		case len(spec.ObfuscatedTag) > 0 && bytes.Equal(spec.ObfuscatedTag, other.ObfuscatedTag):
+			return errors.Errorf("mode %q: obfuscated tag is already used by %q", spec.Name, other.Name)
+		}
+	}
+
+	spec.Announcement = append([]byte(nil), spec.Announcement...)
+	spec.ObfuscatedTag = append([]byte(nil), spec.ObfuscatedTag...)
+	registry[spec.Variant] = spec
+
+	return nil
+}
+
+// Lookup returns spec of registered mode.
+func Lookup(v Variant) (Spec, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	spec, ok := registry[v]
+	return spec, ok
+}
+
+// registeredSpecs returns all modes sorted by variant, so detection doesn't depend on map order.
+func registeredSpecs() []Spec {
+	registryMutex.RLock()
+	specs := make([]Spec, 0, len(registry))
+	for _, spec := range registry {
+		specs = append(specs, spec)
+	}
+	registryMutex.RUnlock()
+
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Variant < specs[j].Variant })
+	return specs
+}
+
+func fallbackSpec(specs []Spec) (Spec, bool) {
+	for _, spec := range specs {
+		if spec.Fallback {
+			return spec, true
+		}
+	}
+
+	return Spec{}, false
+}
+
+func specByObfuscatedTag(tag []byte) (Spec, bool) {
+	for _, spec := range registeredSpecs() {
+		if len(spec.ObfuscatedTag) > 0 && bytes.Equal(spec.ObfuscatedTag, tag) {
+			return spec, true
+		}
+	}
+
+	return Spec{}, false
+}
@@ -0,0 +1,151 @@
+package mode_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/mode"
+	"github.com/xelaj/mtproto/mode/modetest"
+)
+
+// bigEndian is an example of custom mode: it's like intermediate, but size is big endian.
+type bigEndian struct {
+	conn io.ReadWriter
+	mode.FrameLimit
+}
+
+const bigEndianVariant mode.Variant = 0x80
+
+func (*bigEndian) Variant() mode.Variant { return bigEndianVariant }
+
+func (m *bigEndian) WriteMsg(msg []byte) error {
+	frame := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+	copy(frame[4:], msg)
+
+	_, err := m.conn.Write(frame)
+	return err
+}
+
+func (m *bigEndian) ReadMsg() ([]byte, error) {
+	sizeBuf := make([]byte, 4)
+	if _, err := io.ReadFull(m.conn, sizeBuf); err != nil {
+		return nil, err
+	}
+
+	size := int(binary.BigEndian.Uint32(sizeBuf))
+	if err := m.CheckFrameSize(size); err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(m.conn, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func init() {
+	err := mode.Register(mode.Spec{
+		Variant:       bigEndianVariant,
+		Name:          "big endian",
+		Announcement:  []byte{0xbe, 0xbe, 0xbe, 0xbe},
+		ObfuscatedTag: []byte{0xbe, 0xbe, 0xbe, 0xbe},
+		Init:          func(conn io.ReadWriter) mode.Mode { return &bigEndian{conn: conn} },
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		variant mode.Variant
+	}{
+		{"abridged", mode.Abridged},
+		{"intermediate", mode.Intermediate},
+		{"padded intermediate", mode.PaddedIntermediate},
+		{"full", mode.Full},
+		{"custom", bigEndianVariant},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			modetest.Run(t, tt.variant)
+		})
+	}
+}
+
+func TestCustomModeDetect(t *testing.T) {
+	m, err := mode.Detect(bytes.NewBuffer([]byte{0xbe, 0xbe, 0xbe, 0xbe, 0x00, 0x00, 0x00, 0x04, 't', 'e', 's', 't'}))
+	require.NoError(t, err)
+
+	variant, err := mode.GetVariant(m)
+	require.NoError(t, err)
+	assert.Equal(t, bigEndianVariant, variant)
+
+	got, err := m.ReadMsg()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("test"), got)
+}
+
+func TestRegisterConflicts(t *testing.T) {
+	initMode := func(conn io.ReadWriter) mode.Mode { return &bigEndian{conn: conn} }
+
+	for _, tt := range []struct {
+		name string
+		spec mode.Spec
+	}{
+		{
+			name: "same variant",
+			spec: mode.Spec{Variant: mode.Intermediate, Announcement: []byte{0x01}, Init: initMode},
+		},
+		{
+			name: "announcement is prefix",
+			spec: mode.Spec{Variant: 0x81, Announcement: []byte{0xee, 0xee}, Init: initMode},
+		},
+		{
+			name: "announcement starts with other one",
+			spec: mode.Spec{Variant: 0x81, Announcement: []byte{0xef, 0x01}, Init: initMode},
+		},
+		{
+			name: "second fallback",
+			spec: mode.Spec{Variant: 0x81, Fallback: true, Init: initMode},
+		},
+		{
+			name: "without announcement",
+			spec: mode.Spec{Variant: 0x81, Init: initMode},
+		},
+		{
+			name: "same obfuscated tag",
+			spec: mode.Spec{
+				Variant:       0x81,
+				Announcement:  []byte{0x01},
+				ObfuscatedTag: []byte{0xee, 0xee, 0xee, 0xee},
+				Init:          initMode,
+			},
+		},
+		{
+			name: "wrong obfuscated tag",
+			spec: mode.Spec{Variant: 0x81, Announcement: []byte{0x01}, ObfuscatedTag: []byte{0x01}, Init: initMode},
+		},
+		{
+			name: "without init",
+			spec: mode.Spec{Variant: 0x81, Announcement: []byte{0x01}},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, mode.Register(tt.spec))
+
+			_, ok := mode.Lookup(0x81)
+			assert.False(t, ok, "mode must not be registered")
+		})
+	}
+}
@@ -7,11 +7,14 @@ package mtproto
 
 import (
 	"reflect"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/xelaj/mtproto/internal/encoding/tl"
-	"github.com/xelaj/mtproto/internal/session"
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
 	"github.com/xelaj/mtproto/internal/utils"
+	"github.com/xelaj/mtproto/session"
 )
 
 // helper methods
@@ -26,6 +29,21 @@ func (m *MTProto) GetSeqNo() int32 {
 	return m.seqNo
 }
 
+// ReserveMessage returns id of new message and its seqno for transport, which sends messages on its own (like
+// http_wait). Seqno is taken under same lock as in sendPacket, so they are never mixed up.
+func (m *MTProto) ReserveMessage(contentRelated bool) (msgID int64, seqNo int32) {
+	m.seqNoMutex.Lock()
+	defer m.seqNoMutex.Unlock()
+
+	seqNo = m.seqNo
+	if contentRelated {
+		seqNo |= 1
+		m.seqNo += 2
+	}
+
+	return utils.GenerateMessageIdAt(m.serverTime()), seqNo
+}
+
 // GetServerSalt returns current server salt 🧐
 func (m *MTProto) GetServerSalt() int64 {
 	return m.serverSalt
@@ -63,17 +81,131 @@ func (m *MTProto) warnError(err error) {
 }
 
 func (m *MTProto) SaveSession() (err error) {
+	m.mutex.Lock()
+	dcKeys := make(map[int]*session.AuthKey, len(m.dcKeys))
+	for dc, key := range m.dcKeys {
+		dcKeys[dc] = key
+	}
+	m.mutex.Unlock()
+
 	return m.tokensStorage.Store(&session.Session{
-		Key:      m.authKey,
-		Hash:     m.authKeyHash,
-		Salt:     m.serverSalt,
-		Hostname: m.addr,
+		Key:         m.authKey,
+		Hash:        m.authKeyHash,
+		Salt:        m.serverSalt,
+		Hostname:    m.addr,
+		DC:          m.dcID,
+		DCKeys:      dcKeys,
+		TimeOffset:  m.GetTimeOffset(),
+		FutureSalts: m.futureSalts,
+		UserID:      m.userID,
+		Bot:         m.bot,
+		Layer:       m.layer,
 	})
 }
 
+// lockSession locks session storage, if it could be shared with other processes.
+func lockSession(storage session.SessionLoader) error {
+	if locker, ok := storage.(session.SessionLocker); ok {
+		return errors.Wrap(locker.Lock(), "locking session")
+	}
+	return nil
+}
+
+func unlockSession(storage session.SessionLoader) error {
+	if locker, ok := storage.(session.SessionLocker); ok {
+		return errors.Wrap(locker.Unlock(), "unlocking session")
+	}
+	return nil
+}
+
+// DeleteStoredSession removes session from storage. Current connection is not affected, so if you want to
+// forget auth key completely, call DestroyAuthKey before. If storage doesn't implement session.SessionDeleter,
+// session.ErrDeleteNotSupported is returned.
+func (m *MTProto) DeleteStoredSession() error {
+	if deleter, ok := m.tokensStorage.(session.SessionDeleter); ok {
+		return deleter.Delete()
+	}
+	return session.ErrDeleteNotSupported
+}
+
 func (m *MTProto) LoadSession(s *session.Session) {
 	m.authKey = s.Key
 	m.authKeyHash = s.Hash
 	m.serverSalt = s.Salt
 	m.addr = s.Hostname
+	// legacy sessions don't know their dc, so configured one is used
+	if s.DC != 0 {
+		m.dcID = s.DC
+	}
+
+	m.mutex.Lock()
+	m.dcKeys = make(map[int]*session.AuthKey, len(s.DCKeys))
+	for dc, key := range s.DCKeys {
+		m.dcKeys[dc] = key
+	}
+	m.mutex.Unlock()
+
+	atomic.StoreInt64(&m.timeOffset, int64(s.TimeOffset))
+	m.futureSalts = s.FutureSalts
+	// stored salt could be expired long ago, but one of future salts is probably still valid
+	if salt, ok := s.CurrentSalt(m.serverTime()); ok {
+		m.serverSalt = salt
+	}
+	m.userID = s.UserID
+	m.bot = s.Bot
+	m.layer = s.Layer
+}
+
+// GetTimeOffset returns difference between server and local clocks 🧐
+func (m *MTProto) GetTimeOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.timeOffset))
+}
+
+// GetUser returns id of authorized user, which is stored in session. If session isn't authorized, id is zero.
+func (m *MTProto) GetUser() (id int64, bot bool) {
+	return m.userID, m.bot
+}
+
+// SetUser binds session to authorized user and saves session.
+func (m *MTProto) SetUser(id int64, bot bool) error {
+	m.userID = id
+	m.bot = bot
+	return m.SaveSession()
+}
+
+// GetLayer returns api layer, which session was initialized with 🧐
+func (m *MTProto) GetLayer() int {
+	return m.layer
+}
+
+// SetLayer saves api layer, which session was initialized with. Session is saved only if layer is changed.
+func (m *MTProto) SetLayer(layer int) error {
+	if m.layer == layer {
+		return nil
+	}
+	m.layer = layer
+	return m.SaveSession()
+}
+
+// serverTime returns current time by server clock
+func (m *MTProto) serverTime() time.Time {
+	return time.Now().Add(m.GetTimeOffset())
+}
+
+// syncTime corrects offset of clock by msg_id of message from server, cause msg_id is a time of sending.
+func (m *MTProto) syncTime(serverMsgID int64) {
+	offset := time.Until(time.Unix(serverMsgID>>32, 0)) //nolint:gomnd upper half of msg_id is unix time
+	atomic.StoreInt64(&m.timeOffset, int64(offset))
+}
+
+func (m *MTProto) setFutureSalts(salts []*objects.FutureSalt) {
+	res := make([]session.FutureSalt, len(salts))
+	for i, salt := range salts {
+		res[i] = session.FutureSalt{
+			ValidSince: time.Unix(int64(salt.ValidSince), 0),
+			ValidUntil: time.Unix(int64(salt.ValidUntil), 0),
+			Salt:       salt.Salt,
+		}
+	}
+	m.futureSalts = res
 }
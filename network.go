@@ -6,6 +6,7 @@
 package mtproto
 
 import (
+	"fmt"
 	"reflect"
 	"strconv"
 
@@ -15,18 +16,35 @@ import (
 	"github.com/xelaj/mtproto/internal/encoding/tl"
 	"github.com/xelaj/mtproto/internal/mtproto/messages"
 	"github.com/xelaj/mtproto/internal/mtproto/objects"
+	"github.com/xelaj/mtproto/internal/transport"
 	"github.com/xelaj/mtproto/internal/utils"
 )
 
-func (m *MTProto) sendPacket(request tl.Object, expectedTypes ...reflect.Type) (chan tl.Object, error) {
+// sendPacket sends request and returns channel, where response will be written. If received is not nil and
+// quick acks are enabled, it's called, when server confirms, that request is received.
+func (m *MTProto) sendPacket(
+	request tl.Object, received func(), expectedTypes ...reflect.Type,
+) (chan tl.Object, int64, error) {
 	msg, err := tl.Marshal(request)
 	if err != nil {
-		return nil, errors.Wrap(err, "encoding request message")
+		return nil, 0, errors.Wrap(err, "encoding request message")
 	}
 
+	// some service messages must be sent unencrypted even in encrypted session
+	encrypted := m.encrypted && messageRequireEncryption(request)
+
+	if encrypted {
+		msg = m.compressIfWorthIt(msg)
+	}
+
+	// must write synchroniously, cuz seqno must be upper each request. msg_id is generated under same lock,
+	// cause server rejects messages, which have bigger msg_id, but smaller seqno than other ones
+	m.seqNoMutex.Lock()
+	defer m.seqNoMutex.Unlock()
+
 	var (
 		data  messages.Common
-		msgID = utils.GenerateMessageId()
+		msgID = utils.GenerateMessageIdAt(m.serverTime())
 	)
 
 	// adding types for parser if required
@@ -36,13 +54,26 @@ func (m *MTProto) sendPacket(request tl.Object, expectedTypes ...reflect.Type) (
 
 	// dealing with response channel
 	resp := m.getRespChannel()
-	if isNullableResponse(request) {
-		go func() { resp <- &objects.Null{} }() // goroutine cuz we don't read from it RIGHT NOW
-	} else {
-		m.responseChannels.Add(int(msgID), resp)
+	switch r := request.(type) {
+	case *objects.DestroySessionParams:
+		// answer of destroy_session is not wrapped in rpc_result, so it could be found only by session id
+		m.destroySessionChannels.Add(int(r.SessionID), resp)
+
+	case *objects.DestroyAuthKeyParams:
+		// answer of destroy_auth_key is even unencrypted, it could be found only by its type
+		m.mutex.Lock()
+		m.destroyAuthKeyChannel = resp
+		m.mutex.Unlock()
+
+	default:
+		if isNullableResponse(request) {
+			go func() { resp <- &objects.Null{} }() // goroutine cuz we don't read from it RIGHT NOW
+		} else {
+			m.responseChannels.Add(int(msgID), resp)
+		}
 	}
 
-	if m.encrypted {
+	if encrypted {
 		data = &messages.Encrypted{
 			Msg:         msg,
 			MsgID:       msgID,
@@ -55,16 +86,12 @@ func (m *MTProto) sendPacket(request tl.Object, expectedTypes ...reflect.Type) (
 		}
 	}
 
-	// must write synchroniously, cuz seqno must be upper each request
-	m.seqNoMutex.Lock()
-	defer m.seqNoMutex.Unlock()
-
-	err = m.transport.WriteMsg(data, MessageRequireToAck(request))
+	err = m.writeMsg(data, MessageRequireToAck(request), received)
 	if err != nil {
-		return nil, errors.Wrap(err, "sending request")
+		return nil, 0, errors.Wrap(err, "sending request")
 	}
 
-	if m.encrypted {
+	if encrypted {
 		// since we sending this message, we are incrementing the seqno BUT ONLY when we
 		// are sending an encrypted message. why? I don’t know. But the fact remains:
 		// we must to block seqno, cause messages with a bigger seqno can go faster than
@@ -72,7 +99,81 @@ func (m *MTProto) sendPacket(request tl.Object, expectedTypes ...reflect.Type) (
 		m.seqNo += 2
 	}
 
-	return resp, nil
+	return resp, msgID, nil
+}
+
+// quickAckWaiter is a request, which waits for confirmation of receiving
+type quickAckWaiter struct {
+	msgID    int64
+	received func()
+}
+
+// writeMsg sends message, asking server for quick ack, if it's enabled and someone waits for it.
+func (m *MTProto) writeMsg(msg messages.Common, requireToAck bool, received func()) error {
+	if !m.quickAck || received == nil {
+		return m.transport.WriteMsg(msg, requireToAck)
+	}
+
+	// reading routine must not handle quick ack, until token is saved
+	m.quickAckMutex.Lock()
+	defer m.quickAckMutex.Unlock()
+
+	token, err := m.transport.WriteMsgQuickAck(msg, requireToAck)
+	if err == transport.ErrQuickAckNotSupported {
+		return m.transport.WriteMsg(msg, requireToAck)
+	}
+	if err != nil {
+		return err
+	}
+
+	m.quickAcks[token] = quickAckWaiter{msgID: int64(msg.GetMsgID()), received: received}
+	return nil
+}
+
+func (m *MTProto) handleQuickAck(token uint32) {
+	m.quickAckMutex.Lock()
+	w, ok := m.quickAcks[token]
+	delete(m.quickAcks, token)
+	m.quickAckMutex.Unlock()
+
+	if !ok {
+		m.warnError(fmt.Errorf("unknown quick ack token %08x", token))
+		return
+	}
+	w.received()
+}
+
+// forgetQuickAck removes token of request, which is already answered: server could skip quick ack, if
+// response is ready immediately.
+func (m *MTProto) forgetQuickAck(msgID int64) {
+	m.quickAckMutex.Lock()
+	defer m.quickAckMutex.Unlock()
+
+	for token, w := range m.quickAcks {
+		if w.msgID == msgID {
+			delete(m.quickAcks, token)
+			return
+		}
+	}
+}
+
+// compressIfWorthIt wraps serialized request into gzip_packed, if request is not smaller than compress
+// threshold and compressed version is actually smaller than original one.
+func (m *MTProto) compressIfWorthIt(msg []byte) []byte {
+	if m.compressThreshold < 0 || len(msg) < m.compressThreshold {
+		return msg
+	}
+
+	packed, err := objects.PackGzip(msg)
+	if err != nil {
+		m.warnError(errors.Wrap(err, "compressing request"))
+		return msg
+	}
+	if len(packed) >= len(msg) {
+		return msg
+	}
+
+	return packed
 }
 
 func (m *MTProto) writeRPCResponse(msgID int, data tl.Object) error {
@@ -88,11 +189,37 @@ func (m *MTProto) writeRPCResponse(msgID int, data tl.Object) error {
 	return nil
 }
 
+func (m *MTProto) writeDestroySessionResponse(sessionID int64, data tl.Object) error {
+	v, ok := m.destroySessionChannels.Get(int(sessionID))
+	if !ok {
+		return errs.NotFound("sessionID", strconv.FormatInt(sessionID, 10))
+	}
+
+	v <- data
+
+	m.destroySessionChannels.Delete(int(sessionID))
+	return nil
+}
+
+func (m *MTProto) writeDestroyAuthKeyResponse(data tl.Object) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.destroyAuthKeyChannel == nil {
+		return errors.New("auth key destroying was not requested")
+	}
+
+	m.destroyAuthKeyChannel <- data
+	m.destroyAuthKeyChannel = nil
+	return nil
+}
+
 func (m *MTProto) getRespChannel() chan tl.Object {
 	if m.serviceModeActivated {
 		return m.serviceChannel
 	}
-	return make(chan tl.Object)
+	// buffered, cause reading routine must not wait until someone will read response
+	return make(chan tl.Object, 1)
 }
 
 // проверяет, надо ли ждать от сервера пинга
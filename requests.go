@@ -0,0 +1,177 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package mtproto
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
+)
+
+// PendingRequest is a handle of request, which is already sent to the server, but response is not received
+// yet. Request could be resent a few times (e.g. when server salt changed), so msg_id of request could change
+// until Wait() returns.
+type PendingRequest struct {
+	m             *MTProto
+	msg           tl.Object
+	expectedTypes []reflect.Type
+
+	// requests, which must be processed by server before this one. if after is not empty, wrap builds real
+	// request from msg ids of previous requests
+	after []*PendingRequest
+	wrap  func(msgIDs []int64) tl.Object
+
+	msgID int64 // atomic, cause it's changing on resending
+	resp  chan tl.Object
+
+	received     chan struct{}
+	receivedOnce sync.Once
+
+	once   sync.Once
+	result any
+	err    error
+}
+
+// MakeRequestAsync sends request and returns immediately, without waiting for the response. Call Wait() of
+// returned handle to get it.
+func (m *MTProto) MakeRequestAsync(msg tl.Object, expectedTypes ...reflect.Type) (*PendingRequest, error) {
+	return m.makeRequestAsync(msg, expectedTypes...)
+}
+
+// MakeRequestAfter sends request, which must be processed by server only after all of after requests. Since
+// ordering is a part of api layer (e.g. invokeAfterMsgs), wrap must build real request from msg_ids of
+// previous requests. wrap could be called few times, if request will be resent.
+//
+// If request must be resent, it waits until all previous requests will be finished, so order is kept even
+// after retries.
+func (m *MTProto) MakeRequestAfter(
+	after []*PendingRequest, wrap func(msgIDs []int64) tl.Object, expectedTypes ...reflect.Type,
+) (*PendingRequest, error) {
+	if wrap == nil {
+		return nil, errors.New("wrap function is nil")
+	}
+	if len(after) == 0 {
+		return m.makeRequestAsync(wrap(nil), expectedTypes...)
+	}
+
+	req := &PendingRequest{
+		m:             m,
+		expectedTypes: expectedTypes,
+		after:         after,
+		wrap:          wrap,
+		received:      make(chan struct{}),
+	}
+	if err := req.send(); err != nil {
+		return nil, errors.Wrap(err, "sending message")
+	}
+
+	return req, nil
+}
+
+func (m *MTProto) makeRequestAsync(msg tl.Object, expectedTypes ...reflect.Type) (*PendingRequest, error) {
+	req := &PendingRequest{
+		m:             m,
+		msg:           msg,
+		expectedTypes: expectedTypes,
+		received:      make(chan struct{}),
+	}
+	if err := req.send(); err != nil {
+		return nil, errors.Wrap(err, "sending message")
+	}
+
+	return req, nil
+}
+
+// MsgID returns msg_id of the last sent copy of this request.
+func (r *PendingRequest) MsgID() int64 {
+	return atomic.LoadInt64(&r.msgID)
+}
+
+// Received returns channel, which is closed, when server confirms that request is received, but not handled
+// yet (e.g. to show "sent" state of message). Server confirms requests only if Config.QuickAck is set and
+// transport supports quick acks, otherwise channel is closed only when Wait receives response.
+func (r *PendingRequest) Received() <-chan struct{} {
+	return r.received
+}
+
+func (r *PendingRequest) markReceived() {
+	r.receivedOnce.Do(func() { close(r.received) })
+}
+
+// Wait blocks until response is received. It's safe to call Wait few times, even from different goroutines:
+// all of them will get same result.
+func (r *PendingRequest) Wait() (any, error) {
+	r.once.Do(r.wait)
+	return r.result, r.err
+}
+
+func (r *PendingRequest) send() error {
+	msg := r.msg
+	if r.wrap != nil {
+		msgIDs := make([]int64, len(r.after))
+		for i, prev := range r.after {
+			msgIDs[i] = prev.MsgID()
+		}
+		msg = r.wrap(msgIDs)
+	}
+
+	resp, msgID, err := r.m.sendPacket(msg, r.markReceived, r.expectedTypes...)
+	if err != nil {
+		return err
+	}
+
+	r.resp = resp
+	atomic.StoreInt64(&r.msgID, msgID)
+	return nil
+}
+
+func (r *PendingRequest) wait() {
+	// response means that request is received in any case
+	defer r.markReceived()
+
+	for {
+		response := <-r.resp
+		r.m.forgetQuickAck(r.MsgID())
+
+		switch v := response.(type) {
+		case *objects.RpcError:
+			realErr := RpcErrorToNative(v)
+
+			err := r.m.tryToProcessErr(realErr.(*ErrResponseCode))
+			if err != nil {
+				r.err = err
+				return
+			}
+
+		case *objects.BadMsgNotification:
+			r.err = BadMsgErrorFromNative(v)
+			return
+
+		case *errorSessionConfigsChanged:
+			// just resending
+
+		default:
+			r.result = tl.UnwrapNativeTypes(response)
+			return
+		}
+
+		// if request is ordered, previous requests must be finished before resending, otherwise we can't be
+		// sure, that server received them in right order
+		for _, prev := range r.after {
+			_, _ = prev.Wait()
+		}
+
+		if err := r.send(); err != nil {
+			r.err = errors.Wrap(err, "resending message")
+			return
+		}
+	}
+}
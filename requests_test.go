@@ -0,0 +1,258 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package mtproto_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto"
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
+	"github.com/xelaj/mtproto/server"
+	"github.com/xelaj/mtproto/session"
+)
+
+type echoParams struct {
+	Text string
+}
+
+func (*echoParams) CRC() uint32 {
+	return 0x3c7a1f11 //nolint:gomnd not magic
+}
+
+type echoResult struct {
+	Text string
+}
+
+func (*echoResult) CRC() uint32 {
+	return 0x3c7a1f12 //nolint:gomnd not magic
+}
+
+// afterParams works like invokeAfterMsg of telegram api
+type afterParams struct {
+	MsgID int64
+	Query tl.Object
+}
+
+func (*afterParams) CRC() uint32 {
+	return 0x3c7a1f13 //nolint:gomnd not magic
+}
+
+func init() {
+	tl.RegisterObjects(&echoParams{}, &echoResult{}, &afterParams{})
+}
+
+func echo(r *server.Request) (tl.Object, error) {
+	return &echoResult{Text: r.Object.(*echoParams).Text}, nil
+}
+
+// wrapAfter wraps query in afterParams, if there are previous requests
+func wrapAfter(query tl.Object) func(msgIDs []int64) tl.Object {
+	return func(msgIDs []int64) tl.Object {
+		if len(msgIDs) == 0 {
+			return query
+		}
+		return &afterParams{MsgID: msgIDs[0], Query: query}
+	}
+}
+
+// afterRecorder passes wrapped query of afterParams to next handler and remembers msg_ids, which requests
+// wait for.
+type afterRecorder struct {
+	next  server.HandlerFunc
+	mutex sync.Mutex
+	ids   []int64
+}
+
+func (a *afterRecorder) handle(r *server.Request) (tl.Object, error) {
+	after := r.Object.(*afterParams)
+	a.mutex.Lock()
+	a.ids = append(a.ids, after.MsgID)
+	a.mutex.Unlock()
+
+	return a.next(&server.Request{Session: r.Session, MsgID: r.MsgID, Object: after.Query})
+}
+
+func (a *afterRecorder) get() []int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]int64(nil), a.ids...)
+}
+
+// startServer starts server and connects client to it. Both of them are closed after test.
+func startServer(t *testing.T) (*server.Server, *mtproto.MTProto) {
+	t.Helper()
+
+	s, config := newServer(t)
+	return s, connect(t, config)
+}
+
+// newServer starts server, which is closed after test, and returns config of client, which stores its session
+// in memory.
+func newServer(t *testing.T) (*server.Server, mtproto.Config) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	s, err := server.New(server.Config{PrivateKey: key})
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(l) //nolint:errcheck always ErrServerClosed after Close
+	t.Cleanup(func() { s.Close() })
+
+	return s, mtproto.Config{
+		ServerHost:     l.Addr().String(),
+		PublicKey:      &key.PublicKey,
+		SessionStorage: session.NewInMemory(nil),
+	}
+}
+
+// connect connects new client, which is disconnected after test.
+func connect(t *testing.T, config mtproto.Config) *mtproto.MTProto { //nolint:gocritic same as NewMTProto
+	t.Helper()
+
+	m, err := mtproto.NewMTProto(config)
+	require.NoError(t, err)
+	require.NoError(t, m.CreateConnection())
+	t.Cleanup(func() { m.Disconnect() })
+
+	return m
+}
+
+func TestMTProto_MakeRequestAsync(t *testing.T) {
+	s, m := startServer(t)
+	s.Handle((&echoParams{}).CRC(), echo)
+
+	req, err := m.MakeRequestAsync(&echoParams{Text: "hello"})
+	require.NoError(t, err)
+	assert.NotZero(t, req.MsgID())
+
+	res, err := req.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, &echoResult{Text: "hello"}, res)
+
+	// result is kept
+	res, err = req.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, &echoResult{Text: "hello"}, res)
+
+	select {
+	case <-req.Received():
+	default:
+		t.Fatal("request must be marked as received after response")
+	}
+}
+
+func TestMTProto_MakeRequestAfter(t *testing.T) {
+	s, m := startServer(t)
+	s.Handle((&echoParams{}).CRC(), echo)
+	after := afterRecorder{next: echo}
+	s.Handle((&afterParams{}).CRC(), after.handle)
+
+	_, err := m.MakeRequestAfter(nil, nil)
+	assert.Error(t, err, "wrap function is required")
+
+	// nothing to wait, so request isn't wrapped
+	first, err := m.MakeRequestAfter(nil, wrapAfter(&echoParams{Text: "first"}))
+	require.NoError(t, err)
+	second, err := m.MakeRequestAfter([]*mtproto.PendingRequest{first}, wrapAfter(&echoParams{Text: "second"}))
+	require.NoError(t, err)
+
+	res, err := second.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, &echoResult{Text: "second"}, res)
+	res, err = first.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, &echoResult{Text: "first"}, res)
+
+	assert.Equal(t, []int64{first.MsgID()}, after.get())
+}
+
+func TestMTProto_MakeRequestAfterResend(t *testing.T) {
+	s, m := startServer(t)
+
+	var (
+		mutex  sync.Mutex
+		events []string
+	)
+	event := func(e string) {
+		mutex.Lock()
+		events = append(events, e)
+		mutex.Unlock()
+	}
+
+	started := make(chan struct{})
+	var startedOnce sync.Once
+	release := make(chan struct{})
+	handle := func(r *server.Request) (tl.Object, error) {
+		text := r.Object.(*echoParams).Text
+		if text == "first" {
+			// bad_server_salt makes client resend all pending requests, so first request is received twice
+			startedOnce.Do(func() { close(started) })
+			<-release
+		}
+		event(text)
+		return echo(r)
+	}
+	s.Handle((&echoParams{}).CRC(), handle)
+	after := afterRecorder{next: handle}
+	s.Handle((&afterParams{}).CRC(), after.handle)
+
+	first, err := m.MakeRequestAsync(&echoParams{Text: "first"})
+	require.NoError(t, err)
+	<-started
+
+	// second request gets bad_server_salt, but it must not be resent until first one is finished: otherwise
+	// server could get it before first one
+	s.ResetSalts()
+	second, err := m.MakeRequestAfter([]*mtproto.PendingRequest{first}, wrapAfter(&echoParams{Text: "second"}))
+	require.NoError(t, err)
+
+	// requests are resent only by Wait
+	done := make(chan error, 1)
+	go func() {
+		_, err := second.Wait()
+		done <- err
+	}()
+	time.Sleep(300 * time.Millisecond)
+	close(release)
+	require.NoError(t, <-done)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Contains(t, events, "second")
+	assert.Equal(t, "first", events[0], "second request was resent before first one finished")
+	assert.Equal(t, []int64{first.MsgID()}, after.get(), "resent request must wait current msg_id of first one")
+}
+
+func TestMTProto_BadMsgNotification(t *testing.T) {
+	s, m := startServer(t)
+	s.Handle((&echoParams{}).CRC(), func(r *server.Request) (tl.Object, error) {
+		// server rejects request, but client must find it by bad_msg_id
+		err := r.Session.Push(&objects.BadMsgNotification{BadMsgID: r.MsgID, Code: 35})
+		if err != nil {
+			return nil, err
+		}
+		return &echoResult{}, nil
+	})
+
+	_, err := m.MakeRequest(&echoParams{Text: "hello"})
+	var badMsg *mtproto.BadMsgError
+	require.True(t, errors.As(err, &badMsg), "got %v", err)
+	assert.Equal(t, int32(35), badMsg.Code)
+}
@@ -0,0 +1,466 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xelaj/errs"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/internal/mtproto/messages"
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
+	"github.com/xelaj/mtproto/mode"
+)
+
+const (
+	// client's msg_id must be near server time
+	// https://core.telegram.org/mtproto/description#message-identifier-msg-id
+	msgIDMaxPast   = 300 * time.Second
+	msgIDMaxFuture = 30 * time.Second
+)
+
+// conn is a single connection with client. Client could use a few auth keys and sessions through one
+// connection, so conn doesn't store them, except last used key (it's required for destroy_auth_key, which
+// is sent unencrypted).
+type conn struct {
+	s    *Server
+	raw  net.Conn
+	mode mode.Mode
+
+	writeMutex sync.Mutex
+
+	// handshake and lastKey are used only by reading goroutine
+	handshake *handshake
+	lastKey   *authKey
+
+	sessionsMutex sync.Mutex
+	sessions      map[*Session]null
+}
+
+func newConn(s *Server, raw net.Conn) *conn {
+	return &conn{
+		s:        s,
+		raw:      raw,
+		sessions: make(map[*Session]null),
+	}
+}
+
+func (c *conn) serve() {
+	defer c.close()
+	// broken message of single client mustn't crash whole server
+	defer func() {
+		if v := recover(); v != nil {
+			c.s.warnError(fmt.Errorf("handling connection panicked: %v", v))
+		}
+	}()
+
+	var err error
+	c.mode, err = mode.Detect(fullReader{c.raw})
+	if err != nil {
+		c.s.warnError(errors.Wrap(err, "detecting mode"))
+		return
+	}
+
+	for {
+		data, quickAck, err := c.readFrame()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !c.s.isClosed() {
+				c.s.warnError(errors.Wrap(err, "reading message"))
+			}
+			return
+		}
+
+		if err := c.handleFrame(data, quickAck); err != nil {
+			c.s.warnError(errors.Wrap(err, "handling message"))
+			return
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.raw.Close()
+
+	c.sessionsMutex.Lock()
+	defer c.sessionsMutex.Unlock()
+
+	for sess := range c.sessions {
+		sess.unbindConn(c)
+	}
+}
+
+// readFrame reads message and checks, whether client asked for quick ack.
+func (c *conn) readFrame() ([]byte, bool, error) {
+	if acker, ok := c.mode.(mode.QuickAcker); ok {
+		return acker.ReadMsgQuickAck()
+	}
+
+	data, err := c.mode.ReadMsg()
+	return data, false, err
+}
+
+func (c *conn) writeFrame(data []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	return c.mode.WriteMsg(data)
+}
+
+func (c *conn) writeQuickAck(token uint32) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	// only modes, which support quick acks, could request them
+	return c.mode.(mode.QuickAcker).WriteQuickAck(token)
+}
+
+// writeCode writes transport error instead of message
+func (c *conn) writeCode(code int32) error {
+	data := make([]byte, tl.WordLen)
+	binary.LittleEndian.PutUint32(data, uint32(code))
+	return c.writeFrame(data)
+}
+
+// handleFrame handles single message from client. Returned error means, that connection can't be used
+// anymore.
+func (c *conn) handleFrame(data []byte, quickAck bool) error {
+	// padded intermediate mode adds random bytes to every message
+	data = messages.TrimPadding(data)
+
+	if len(data) < tl.LongLen {
+		return fmt.Errorf("message is too small: %v bytes", len(data))
+	}
+
+	keyID := int64(binary.LittleEndian.Uint64(data))
+	if keyID == 0 {
+		return c.handleUnencrypted(data)
+	}
+
+	key, err := c.s.getAuthKey(keyID)
+	if err != nil {
+		if !errs.IsNotFound(err) {
+			c.s.warnError(errors.Wrap(err, "loading auth key"))
+		}
+		return c.writeCode(transportErrAuthKeyNotFound)
+	}
+
+	msg, err := messages.DeserializeEncryptedAsServer(data, key.key)
+	if err != nil {
+		return errors.Wrap(err, "decrypting message")
+	}
+	if quickAck {
+		if err := c.writeQuickAck(msg.QuickAckToken); err != nil {
+			return errors.Wrap(err, "sending quick ack")
+		}
+	}
+	c.lastKey = key
+
+	sess := key.getSession(msg.SessionID)
+	sess.bindConn(c)
+	c.sessionsMutex.Lock()
+	c.sessions[sess] = null{}
+	c.sessionsMutex.Unlock()
+
+	now := time.Now()
+	if code := checkMsgID(msg.MsgID, now); code != 0 {
+		return c.badMsg(sess, msg, code)
+	}
+	if !key.isValidSalt(msg.Salt, now) {
+		return sess.send(&objects.BadServerSalt{
+			BadMsgID:    msg.MsgID,
+			BadMsgSeqNo: msg.SeqNo,
+			ErrorCode:   badMsgServerSalt,
+			NewSalt:     key.currentSalt(now),
+		}, false, true)
+	}
+
+	if sess.announce() {
+		err := sess.send(&objects.NewSessionCreated{
+			FirstMsgID: msg.MsgID,
+			UniqueID:   sess.uniqueID,
+			ServerSalt: key.currentSalt(now),
+		}, true, false)
+		if err != nil {
+			return errors.Wrap(err, "sending new_session_created")
+		}
+	}
+
+	return c.handleMessage(sess, msg)
+}
+
+// handleMessage handles decrypted message (or message from container)
+func (c *conn) handleMessage(sess *Session, msg *messages.Encrypted) error {
+	obj, decodeErr := tl.DecodeUnknownObject(msg.Msg)
+	// if message can't be decoded, it's unknown, whether it's content related, so client is trusted
+	if decodeErr == nil {
+		if code := checkSeqNoParity(obj, msg.SeqNo); code != 0 {
+			return c.badMsg(sess, msg, code)
+		}
+	}
+
+	code, duplicate := sess.receive(msg.MsgID, msg.SeqNo, time.Now())
+	if duplicate {
+		// client already got (or will get) answer
+		return nil
+	}
+	if code != 0 {
+		return c.badMsg(sess, msg, code)
+	}
+
+	if decodeErr != nil {
+		if msg.SeqNo&1 == 0 {
+			// client doesn't wait answer, so just ignoring it
+			return nil
+		}
+		return sess.send(&objects.RpcResult{
+			ReqMsgID: msg.MsgID,
+			Obj:      &objects.RpcError{ErrorCode: 400, ErrorMessage: invalidMethodMessage(msg.Msg)}, //nolint:gomnd
+		}, true, true)
+	}
+
+	return c.handleObject(sess, msg, obj)
+}
+
+func (c *conn) handleObject(sess *Session, msg *messages.Encrypted, obj tl.Object) error {
+	switch o := obj.(type) {
+	case *objects.MessageContainer:
+		now := time.Now()
+		for _, inner := range *o {
+			if code := checkMsgID(inner.MsgID, now); code != 0 {
+				if err := c.badMsg(sess, inner, code); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := c.handleMessage(sess, inner); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *objects.GzipPacked:
+		return c.handleObject(sess, msg, o.Obj)
+
+	case *objects.MsgsAck:
+		return nil
+
+	case *objects.PingParams:
+		return sess.send(&objects.Pong{MsgID: msg.MsgID, PingID: o.PingID}, true, true)
+
+	case *objects.GetFutureSaltsParams:
+		num := int(o.Num)
+		const maxSalts = 64
+		if num < 1 {
+			num = 1
+		} else if num > maxSalts {
+			num = maxSalts
+		}
+
+		now := time.Now()
+		return sess.send(&objects.FutureSalts{
+			ReqMsgID: msg.MsgID,
+			Now:      int32(now.Unix()),
+			Salts:    sess.key.futureSalts(now, num),
+		}, true, true)
+
+	case *objects.DestroySessionParams:
+		var res tl.Object = &objects.DestroySessionNone{SessionID: o.SessionID}
+		if o.SessionID != sess.id && sess.key.destroySession(o.SessionID) {
+			res = &objects.DestroySessionOk{SessionID: o.SessionID}
+		}
+		return sess.send(res, true, true)
+
+	default:
+		// handlers could be pretty slow, so they don't block reading of next messages
+		go c.handleRPC(sess, msg.MsgID, obj)
+		return nil
+	}
+}
+
+func (c *conn) handleRPC(sess *Session, msgID int64, obj tl.Object) {
+	res, transportErr := c.callHandler(&Request{
+		Session: sess,
+		MsgID:   msgID,
+		Object:  obj,
+	})
+	if transportErr != nil {
+		if err := c.writeCode(transportErr.Code); err != nil {
+			c.s.warnError(errors.Wrapf(err, "sending transport error of %T", obj))
+		}
+		return
+	}
+
+	// client waits answer anyway, so if handler returned something weird, client must know about it
+	if _, err := tl.Marshal(res); err != nil {
+		c.s.warnError(errors.Wrapf(err, "encoding result of %T", obj))
+		res = internalError()
+	}
+
+	err := sess.send(&objects.RpcResult{ReqMsgID: msgID, Obj: res}, true, true)
+	if err != nil {
+		c.s.warnError(errors.Wrapf(err, "sending result of %T", obj))
+	}
+}
+
+// callHandler returns result of handler or rpc_error, if something went wrong. If handler returned
+// *TransportError, it's returned instead of result.
+func (c *conn) callHandler(r *Request) (res tl.Object, transportErr *TransportError) {
+	h := c.s.handler(r.Object.CRC())
+	if h == nil {
+		return &objects.RpcError{ErrorCode: 400, ErrorMessage: fmt.Sprintf("INPUT_METHOD_INVALID_%d", r.Object.CRC())}, nil //nolint:gomnd
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			c.s.warnError(fmt.Errorf("handler of %T panicked: %v", r.Object, v))
+			res, transportErr = internalError(), nil
+		}
+	}()
+
+	res, err := h(r)
+	if err != nil {
+		var rpcErr *RpcError
+		if errors.As(err, &rpcErr) {
+			return &objects.RpcError{ErrorCode: rpcErr.Code, ErrorMessage: rpcErr.Message}, nil
+		}
+		if errors.As(err, &transportErr) {
+			return nil, transportErr
+		}
+
+		c.s.warnError(errors.Wrapf(err, "handling %T", r.Object))
+		return internalError(), nil
+	}
+	if res == nil {
+		c.s.warnError(fmt.Errorf("handler of %T returned nil result", r.Object))
+		return internalError(), nil
+	}
+
+	return res, nil
+}
+
+func (c *conn) badMsg(sess *Session, msg *messages.Encrypted, code int32) error {
+	return sess.send(&objects.BadMsgNotification{
+		BadMsgID:    msg.MsgID,
+		BadMsgSeqNo: msg.SeqNo,
+		Code:        code,
+	}, false, true)
+}
+
+func (c *conn) handleUnencrypted(data []byte) error {
+	msg, err := messages.DeserializeUnencryptedAsServer(data)
+	if err != nil {
+		return errors.Wrap(err, "parsing message")
+	}
+
+	obj, err := tl.DecodeUnknownObject(msg.Msg)
+	if err != nil {
+		return errors.Wrap(err, "decoding message")
+	}
+
+	var res tl.Object
+	switch o := obj.(type) {
+	case *objects.DestroyAuthKeyParams:
+		res, err = c.destroyAuthKey()
+
+	default:
+		res, err = c.handleHandshake(o)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err = tl.Marshal(res)
+	if err != nil {
+		return errors.Wrap(err, "encoding response")
+	}
+
+	data, err = (&messages.Unencrypted{Msg: data, MsgID: c.s.newMsgID(true)}).Serialize(nil)
+	if err != nil {
+		return errors.Wrap(err, "serializing response")
+	}
+
+	return c.writeFrame(data)
+}
+
+func (c *conn) destroyAuthKey() (objects.DestroyAuthKeyRes, error) {
+	if c.lastKey == nil {
+		return &objects.DestroyAuthKeyNone{}, nil
+	}
+
+	if err := c.s.deleteAuthKey(c.lastKey.id); err != nil {
+		c.s.warnError(err)
+		return &objects.DestroyAuthKeyFail{}, nil
+	}
+
+	c.lastKey = nil
+	return &objects.DestroyAuthKeyOk{}, nil
+}
+
+// checkMsgID returns code of bad_msg_notification, if msg_id is invalid, or zero, if it's ok.
+func checkMsgID(msgID int64, now time.Time) int32 {
+	switch msgTime := msgID >> 32; {
+	case msgID&3 != 0: //nolint:gomnd two lower bits
+		return badMsgIDNotAligned
+	case msgTime < now.Add(-msgIDMaxPast).Unix():
+		return badMsgIDTooLow
+	case msgTime > now.Add(msgIDMaxFuture).Unix():
+		return badMsgIDTooHigh
+	default:
+		return 0
+	}
+}
+
+// checkSeqNoParity returns code of bad_msg_notification, if parity of seqno doesn't match type of message:
+// content related messages must have odd seqno, others must have even one.
+func checkSeqNoParity(obj tl.Object, seqNo int32) int32 {
+	switch contentRelated, odd := isContentRelated(obj), seqNo&1 == 1; {
+	case contentRelated && !odd:
+		return badMsgSeqNoNotOdd
+	case !contentRelated && odd:
+		return badMsgSeqNoNotEven
+	default:
+		return 0
+	}
+}
+
+// isContentRelated returns false for messages, which don't require acknowledgment.
+func isContentRelated(obj tl.Object) bool {
+	switch o := obj.(type) {
+	case *objects.MsgsAck, *objects.MessageContainer, *objects.HttpWaitParams:
+		return false
+	case *objects.GzipPacked:
+		return isContentRelated(o.Obj)
+	default:
+		return true
+	}
+}
+
+func invalidMethodMessage(msg []byte) string {
+	if len(msg) < tl.WordLen {
+		return "INPUT_METHOD_INVALID"
+	}
+	return fmt.Sprintf("INPUT_METHOD_INVALID_%d", binary.LittleEndian.Uint32(msg))
+}
+
+func internalError() *objects.RpcError {
+	return &objects.RpcError{ErrorCode: 500, ErrorMessage: "INTERNAL"} //nolint:gomnd
+}
+
+// fullReader makes each Read call read whole buffer, cause modes expect, that they get exactly the size
+// they asked.
+type fullReader struct {
+	net.Conn
+}
+
+func (r fullReader) Read(b []byte) (int, error) {
+	return io.ReadFull(r.Conn, b)
+}
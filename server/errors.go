@@ -0,0 +1,59 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+var ErrServerClosed = errors.New("server closed")
+
+// RpcError is an error, which is sending to client as rpc_error. If handler returns any other error, client
+// gets 500 INTERNAL error.
+type RpcError struct {
+	Code    int32
+	Message string
+}
+
+func (e *RpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// NewRpcError creates rpc error with code and message. Message must be in telegram style, like
+// FLOOD_WAIT_5 or PHONE_NUMBER_INVALID
+func NewRpcError(code int32, message string) *RpcError {
+	return &RpcError{Code: code, Message: message}
+}
+
+// TransportError is sent to client instead of any message, like real server does on problems of transport
+// level (e.g. -429 on flood). Handler could return it to emulate such problems, client doesn't get response
+// of request in this case.
+type TransportError struct {
+	Code int32
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("transport error %d", e.Code)
+}
+
+const (
+	// codes of bad_msg_notification
+	// https://core.telegram.org/mtproto/service_messages_about_messages#notice-of-ignored-error-message
+	badMsgIDTooLow     = 16
+	badMsgIDTooHigh    = 17
+	badMsgIDNotAligned = 18 // msg_id of client must be divisible by 4
+	badMsgTooOld       = 20 // server doesn't remember so old messages, so it can't check duplicates
+	badMsgSeqNoTooLow  = 32
+	badMsgSeqNoTooHigh = 33
+	badMsgSeqNoNotEven = 34 // message isn't content related, but seqno is odd
+	badMsgSeqNoNotOdd  = 35 // message is content related, but seqno is even
+	badMsgServerSalt   = 48
+
+	// transport error, which is sent instead of message, when auth key is unknown
+	transportErrAuthKeyNotFound = -404
+)
@@ -0,0 +1,24 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package server
+
+import (
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+)
+
+// HandlerFunc handles single rpc request. Returned object is sending to client as rpc_result. If error is
+// *RpcError, it's sending as is, any other error is hidden from client behind 500 INTERNAL error.
+//
+// Requests are handled concurrently, so handler must be safe to call from different goroutines.
+type HandlerFunc func(r *Request) (tl.Object, error)
+
+// Request is a decoded rpc call from client.
+type Request struct {
+	// Session is a session of client, which sent request. Use it to push messages back to this client.
+	Session *Session
+	MsgID   int64
+	Object  tl.Object
+}
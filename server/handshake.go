@@ -0,0 +1,250 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xelaj/go-dry"
+
+	ige "github.com/xelaj/mtproto/internal/aes_ige"
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/internal/math"
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
+)
+
+// handshake is a state of auth key creation, server side of it.
+// https://core.telegram.org/mtproto/auth_key
+type handshake struct {
+	nonce       *tl.Int128
+	serverNonce *tl.Int128
+	p, q        *big.Int
+
+	// filled after req_DH_params
+	newNonce *tl.Int256
+	a        *big.Int
+}
+
+const (
+	pqPrimeBits  = 31   // p*q must fit into 63 bits
+	dhSecretBits = 2048 // size of a and b of Diffie-Hellman
+	authKeyBits  = 2048
+)
+
+func (c *conn) handleHandshake(obj tl.Object) (tl.Object, error) {
+	switch o := obj.(type) {
+	case *objects.ReqPQParams:
+		return c.reqPQ(o.Nonce)
+
+	case *objects.ReqPQMultiParams:
+		return c.reqPQ(o.Nonce)
+
+	case *objects.ReqDHParamsParams:
+		res, err := c.reqDHParams(o)
+		return res, errors.Wrap(err, "handshake: req_DH_params")
+
+	case *objects.SetClientDHParamsParams:
+		res, err := c.setClientDHParams(o)
+		return res, errors.Wrap(err, "handshake: set_client_DH_params")
+
+	default:
+		return nil, fmt.Errorf("unexpected unencrypted message %T", obj)
+	}
+}
+
+func (c *conn) reqPQ(nonce *tl.Int128) (*objects.ResPQ, error) {
+	if nonce == nil {
+		return nil, errors.New("handshake: nonce is nil")
+	}
+
+	p, q, err := generatePQ()
+	if err != nil {
+		return nil, errors.Wrap(err, "handshake: generating pq")
+	}
+
+	c.handshake = &handshake{
+		nonce:       nonce,
+		serverNonce: tl.RandomInt128(),
+		p:           p,
+		q:           q,
+	}
+
+	return &objects.ResPQ{
+		Nonce:        nonce,
+		ServerNonce:  c.handshake.serverNonce,
+		Pq:           big.NewInt(0).Mul(p, q).Bytes(),
+		Fingerprints: []int64{c.s.fingerprint},
+	}, nil
+}
+
+func (c *conn) reqDHParams(req *objects.ReqDHParamsParams) (*objects.ServerDHParamsOk, error) {
+	h := c.handshake
+	if err := h.checkNonces(req.Nonce, req.ServerNonce); err != nil {
+		return nil, err
+	}
+	if big.NewInt(0).SetBytes(req.P).Cmp(h.p) != 0 || big.NewInt(0).SetBytes(req.Q).Cmp(h.q) != 0 {
+		return nil, errors.New("wrong p and q")
+	}
+	if req.PublicKeyFingerprint != c.s.fingerprint {
+		return nil, fmt.Errorf("unknown key fingerprint %x", uint64(req.PublicKeyFingerprint))
+	}
+
+	// hashAndMsg = SHA1(data) + data + (any random bytes); len = 255
+	hashAndMsg := math.DoRSAdecrypt(req.EncryptedData, c.s.privateKey)
+	if hashAndMsg == nil {
+		return nil, errors.New("invalid encrypted data")
+	}
+
+	obj, err := tl.DecodeUnknownObject(hashAndMsg[20:])
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding p_q_inner_data")
+	}
+	inner, ok := obj.(*objects.PQInnerData)
+	if !ok {
+		return nil, fmt.Errorf("expected p_q_inner_data, got %T", obj)
+	}
+
+	// decoder reads only object itself, so hash is checked over re-encoded object
+	encoded, err := tl.Marshal(inner)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding p_q_inner_data")
+	}
+	if !bytes.Equal(hashAndMsg[:20], dry.Sha1Byte(encoded)) {
+		return nil, errors.New("hash of p_q_inner_data mismatched")
+	}
+	if err := h.checkNonces(inner.Nonce, inner.ServerNonce); err != nil {
+		return nil, err
+	}
+	if inner.NewNonce == nil {
+		return nil, errors.New("new_nonce is nil")
+	}
+
+	h.newNonce = inner.NewNonce
+	h.a, err = rand.Int(rand.Reader, big.NewInt(0).Lsh(big.NewInt(1), dhSecretBits))
+	if err != nil {
+		return nil, errors.Wrap(err, "generating a")
+	}
+	gA := big.NewInt(0).Exp(big.NewInt(int64(c.s.g)), h.a, c.s.dhPrime)
+
+	answer, err := tl.Marshal(&objects.ServerDHInnerData{
+		Nonce:       h.nonce,
+		ServerNonce: h.serverNonce,
+		G:           c.s.g,
+		DhPrime:     c.s.dhPrime.Bytes(),
+		GA:          gA.Bytes(),
+		ServerTime:  int32(time.Now().Unix()),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding server_DH_inner_data")
+	}
+
+	return &objects.ServerDHParamsOk{
+		Nonce:           h.nonce,
+		ServerNonce:     h.serverNonce,
+		EncryptedAnswer: ige.EncryptMessageWithTempKeys(answer, h.newNonce.Int, h.serverNonce.Int),
+	}, nil
+}
+
+func (c *conn) setClientDHParams(req *objects.SetClientDHParamsParams) (*objects.DHGenOk, error) {
+	h := c.handshake
+	if err := h.checkNonces(req.Nonce, req.ServerNonce); err != nil {
+		return nil, err
+	}
+	if h.newNonce == nil {
+		return nil, errors.New("req_DH_params wasn't called")
+	}
+
+	decrypted, err := ige.DecryptMessageWithTempKeys(req.EncryptedData, h.newNonce.Int, h.serverNonce.Int)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypting client_DH_inner_data")
+	}
+
+	obj, err := tl.DecodeUnknownObject(decrypted)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding client_DH_inner_data")
+	}
+	inner, ok := obj.(*objects.ClientDHInnerData)
+	if !ok {
+		return nil, fmt.Errorf("expected client_DH_inner_data, got %T", obj)
+	}
+	if err := h.checkNonces(inner.Nonce, inner.ServerNonce); err != nil {
+		return nil, err
+	}
+
+	// 1 < g_b < dh_prime - 1
+	gB := big.NewInt(0).SetBytes(inner.GB)
+	if gB.Cmp(big.NewInt(1)) <= 0 || gB.Cmp(big.NewInt(0).Sub(c.s.dhPrime, big.NewInt(1))) >= 0 {
+		return nil, errors.New("g_b is out of range")
+	}
+
+	authKey := dry.BigIntBytes(big.NewInt(0).Exp(gB, h.a, c.s.dhPrime), authKeyBits)
+
+	newNonce := dry.BigIntBytes(h.newNonce.Int, tl.Int256Len*8)       //nolint:gomnd bits in byte
+	serverNonce := dry.BigIntBytes(h.serverNonce.Int, tl.Int128Len*8) //nolint:gomnd bits in byte
+	salt := make([]byte, tl.LongLen)
+	copy(salt, newNonce[:tl.LongLen])
+	math.Xor(salt, serverNonce[:tl.LongLen])
+
+	key, err := c.s.addAuthKey(authKey, int64(binary.LittleEndian.Uint64(salt)))
+	if err != nil {
+		return nil, err
+	}
+	c.lastKey = key
+	c.handshake = nil
+
+	// new_nonce_hash1 = substr(SHA1(new_nonce + 0x01 + auth_key_aux_hash), 4, 16)
+	t := make([]byte, 0, len(newNonce)+1+tl.LongLen)
+	t = append(t, newNonce...)
+	t = append(t, 1)
+	t = append(t, dry.Sha1Byte(authKey)[:tl.LongLen]...)
+
+	return &objects.DHGenOk{
+		Nonce:         inner.Nonce,
+		ServerNonce:   inner.ServerNonce,
+		NewNonceHash1: &tl.Int128{Int: big.NewInt(0).SetBytes(dry.Sha1Byte(t)[4:20])},
+	}, nil
+}
+
+func (h *handshake) checkNonces(nonce, serverNonce *tl.Int128) error {
+	if h == nil {
+		return errors.New("req_pq wasn't called")
+	}
+	if nonce == nil || nonce.Cmp(h.nonce.Int) != 0 {
+		return errors.New("wrong nonce")
+	}
+	if serverNonce == nil || serverNonce.Cmp(h.serverNonce.Int) != 0 {
+		return errors.New("wrong server_nonce")
+	}
+
+	return nil
+}
+
+// generatePQ generates two different primes, so p < q
+func generatePQ() (p, q *big.Int, err error) {
+	for {
+		p, err = rand.Prime(rand.Reader, pqPrimeBits)
+		if err != nil {
+			return nil, nil, err
+		}
+		q, err = rand.Prime(rand.Reader, pqPrimeBits)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch p.Cmp(q) {
+		case -1:
+			return p, q, nil
+		case 1:
+			return q, p, nil
+		}
+	}
+}
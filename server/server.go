@@ -0,0 +1,338 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+// Package server implements server side of MTProto: it accepts connections, creates auth keys with clients,
+// decrypts requests and dispatches them to handlers, registered by CRC of request object.
+//
+// Server is not a Telegram server and knows nothing about Telegram API: it only handles service messages of
+// MTProto itself (handshake, pings, salts, sessions, etc.). Everything else is up to your handlers.
+package server
+
+import (
+	"crypto/rsa"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xelaj/errs"
+
+	"github.com/xelaj/mtproto/internal/keys"
+	"github.com/xelaj/mtproto/internal/utils"
+)
+
+type Server struct {
+	privateKey  *rsa.PrivateKey
+	fingerprint int64
+	dhPrime     *big.Int
+	g           int32
+
+	saltLifetime time.Duration
+	storage      AuthKeyStorage
+
+	handlersMutex sync.RWMutex
+	handlers      map[uint32]HandlerFunc
+
+	// auth keys, which are used at least once since server start
+	keysMutex sync.Mutex
+	keys      map[int64]*authKey
+
+	msgIDMutex sync.Mutex
+	lastMsgID  int64
+
+	connsMutex sync.Mutex
+	listeners  map[net.Listener]null
+	conns      map[*conn]null
+	closed     bool
+	wg         sync.WaitGroup
+
+	// if set, all errors, which can't be returned to caller, are writing to this channel
+	Warnings chan error
+}
+
+type Config struct {
+	// PrivateKey is a key, which client uses to encrypt first part of handshake. Public part of it must be
+	// known by clients. Required.
+	PrivateKey *rsa.PrivateKey
+
+	// DHPrime and G are Diffie-Hellman parameters. If DHPrime is nil, the same 2048-bit prime as Telegram
+	// servers use is taken. If G is zero, 3 is used.
+	DHPrime *big.Int
+	G       int32
+
+	// AuthKeys stores created auth keys. If nil, keys are stored in memory, so they are lost after restart.
+	AuthKeys AuthKeyStorage
+
+	// SaltLifetime is a time, while single server salt is valid. If zero, salts are valid for an hour.
+	SaltLifetime time.Duration
+}
+
+const (
+	defaultG            = 3
+	defaultSaltLifetime = time.Hour
+)
+
+// telegramDHPrime is a prime, which is used by telegram servers. Clients usually check, that they get exactly
+// this one, so it's the best default choice.
+const telegramDHPrime = "c71caeb9c6b1c9048e6c522f70f13f73980d40238e3e21c14934d037563d930f48198a0aa7c14058229493d2" +
+	"2530f4dbfa336f6e0ac925139543aed44cce7c3720fd51f69458705ac68cd4fe6b6b13abdc9746512969328454f18faf8c595f6424" +
+	"77fe96bb2a941d5bcd1d4ac8cc49880708fa9b378e3c4f3a9060bee67cf9a4a4a695811051907e162753b56b0f6b410dba74d8a84b" +
+	"2a14b3144e0ef1284754fd17ed950d5965b4b9dd46582db1178d169c6bc465b0d6ff9ca3928fef5b9ae4e418fc15e83ebea0f87fa9" +
+	"ff5eed70050ded2849f47bf959d956850ce929851f0d8115f635b105ee2e4e15d04b2454bf6f4fadf034b10403119cd8e3b92fcc5b"
+
+func New(c Config) (*Server, error) {
+	if c.PrivateKey == nil {
+		return nil, errors.New("PrivateKey is required")
+	}
+	if c.DHPrime == nil {
+		c.DHPrime, _ = big.NewInt(0).SetString(telegramDHPrime, 16)
+	}
+	if c.G == 0 {
+		c.G = defaultG
+	}
+	if c.AuthKeys == nil {
+		c.AuthKeys = NewMemoryStorage()
+	}
+	if c.SaltLifetime == 0 {
+		c.SaltLifetime = defaultSaltLifetime
+	}
+
+	return &Server{
+		privateKey:   c.PrivateKey,
+		fingerprint:  int64(binary.LittleEndian.Uint64(keys.RSAFingerprint(&c.PrivateKey.PublicKey))),
+		dhPrime:      c.DHPrime,
+		g:            c.G,
+		saltLifetime: c.SaltLifetime,
+		storage:      c.AuthKeys,
+		handlers:     make(map[uint32]HandlerFunc),
+		keys:         make(map[int64]*authKey),
+		listeners:    make(map[net.Listener]null),
+		conns:        make(map[*conn]null),
+	}, nil
+}
+
+// Handle registers handler for requests with specific CRC code. Object with this code must be registered in
+// tl package, otherwise server can't decode it. Previous handler for this code is replaced.
+func (s *Server) Handle(crc uint32, h HandlerFunc) {
+	s.handlersMutex.Lock()
+	defer s.handlersMutex.Unlock()
+
+	s.handlers[crc] = h
+}
+
+func (s *Server) handler(crc uint32) HandlerFunc {
+	s.handlersMutex.RLock()
+	defer s.handlersMutex.RUnlock()
+
+	return s.handlers[crc]
+}
+
+// ListenAndServe listens tcp address and serves all incoming connections. See Serve for details.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "listening")
+	}
+
+	return s.Serve(l)
+}
+
+// Serve accepts connections from listener and serves each of them in separate goroutine. Serve always
+// returns non-nil error, after Close it's ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+
+	for {
+		raw, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return errors.Wrap(err, "accepting connection")
+		}
+
+		c := newConn(s, raw)
+		if !s.trackConn(c, true) {
+			raw.Close()
+			return ErrServerClosed
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.trackConn(c, false)
+
+			c.serve()
+		}()
+	}
+}
+
+// Close stops all listeners, closes all connections and waits until all of them will be finished.
+func (s *Server) Close() error {
+	s.connsMutex.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.raw.Close()
+	}
+	s.connsMutex.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// Sessions returns all sessions, which are known by server at this moment.
+func (s *Server) Sessions() []*Session {
+	s.keysMutex.Lock()
+	defer s.keysMutex.Unlock()
+
+	res := make([]*Session, 0)
+	for _, k := range s.keys {
+		res = append(res, k.getSessions()...)
+	}
+
+	return res
+}
+
+// ResetSalts drops salts of all auth keys, so next messages of clients are answered by bad_server_salt with
+// new salt. Real server does it, when salts are expired, so it's useful to test salt handling of client.
+func (s *Server) ResetSalts() {
+	s.keysMutex.Lock()
+	defer s.keysMutex.Unlock()
+
+	for _, k := range s.keys {
+		k.resetSalts()
+	}
+}
+
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.closed {
+		return false
+	}
+
+	s.listeners[l] = null{}
+	return true
+}
+
+func (s *Server) trackConn(c *conn, add bool) bool {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+
+	if !add {
+		delete(s.conns, c)
+		return true
+	}
+	if s.closed {
+		return false
+	}
+
+	s.conns[c] = null{}
+	return true
+}
+
+func (s *Server) isClosed() bool {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+
+	return s.closed
+}
+
+// getAuthKey returns auth key by its id. If key wasn't used since server start, it's loading from storage.
+func (s *Server) getAuthKey(id int64) (*authKey, error) {
+	s.keysMutex.Lock()
+	defer s.keysMutex.Unlock()
+
+	if k, ok := s.keys[id]; ok {
+		return k, nil
+	}
+
+	key, err := s.storage.Load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	k := newAuthKey(s, key)
+	s.keys[id] = k
+	return k, nil
+}
+
+// addAuthKey saves new auth key, created by handshake.
+func (s *Server) addAuthKey(key []byte, salt int64) (*authKey, error) {
+	k := newAuthKey(s, key)
+	k.addSalt(salt, time.Now())
+
+	s.keysMutex.Lock()
+	defer s.keysMutex.Unlock()
+
+	if _, ok := s.keys[k.id]; ok {
+		return nil, errors.New("auth key with same id already exists")
+	}
+
+	if err := s.storage.Store(k.id, key); err != nil {
+		return nil, errors.Wrap(err, "storing auth key")
+	}
+
+	s.keys[k.id] = k
+	return k, nil
+}
+
+func (s *Server) deleteAuthKey(id int64) error {
+	s.keysMutex.Lock()
+	defer s.keysMutex.Unlock()
+
+	delete(s.keys, id)
+
+	err := s.storage.Delete(id)
+	if err != nil && !errs.IsNotFound(err) {
+		return errors.Wrap(err, "deleting auth key")
+	}
+
+	return nil
+}
+
+// newMsgID generates msg_id for message from server. Server msg_ids are always growing, responses are equal
+// 1 modulo 4, messages which are initiated by server are equal 3 modulo 4.
+func (s *Server) newMsgID(response bool) int64 {
+	s.msgIDMutex.Lock()
+	defer s.msgIDMutex.Unlock()
+
+	id := utils.GenerateMessageId()
+	if id <= s.lastMsgID {
+		id = s.lastMsgID&^3 + 4 //nolint:gomnd lower two bits are type of message
+	}
+	if response {
+		id |= 1
+	} else {
+		id |= 3
+	}
+
+	s.lastMsgID = id
+	return id
+}
+
+func (s *Server) warnError(err error) {
+	if s.Warnings != nil && err != nil {
+		s.Warnings <- err
+	}
+}
+
+// idOfKey returns auth_key_id of auth key as it's written in messages.
+func idOfKey(key []byte) int64 {
+	return int64(binary.LittleEndian.Uint64(utils.AuthKeyHash(key)))
+}
@@ -0,0 +1,404 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package server_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto"
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/internal/keys"
+	"github.com/xelaj/mtproto/internal/math"
+	"github.com/xelaj/mtproto/internal/mtproto/messages"
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
+	"github.com/xelaj/mtproto/internal/transport"
+	"github.com/xelaj/mtproto/internal/utils"
+	"github.com/xelaj/mtproto/mode"
+	"github.com/xelaj/mtproto/server"
+	"github.com/xelaj/mtproto/session"
+)
+
+type echoParams struct {
+	Text string
+}
+
+func (*echoParams) CRC() uint32 {
+	return 0x3c7a1f01 //nolint:gomnd not magic
+}
+
+type echoResult struct {
+	Text string
+}
+
+func (*echoResult) CRC() uint32 {
+	return 0x3c7a1f02 //nolint:gomnd not magic
+}
+
+type failParams struct{}
+
+func (*failParams) CRC() uint32 {
+	return 0x3c7a1f03 //nolint:gomnd not magic
+}
+
+func init() {
+	tl.RegisterObjects(&echoParams{}, &echoResult{}, &failParams{})
+}
+
+func startServer(t *testing.T) (*server.Server, *rsa.PublicKey, string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	s, err := server.New(server.Config{PrivateKey: key})
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		err := s.Serve(l)
+		if !errors.Is(err, server.ErrServerClosed) {
+			t.Error(err)
+		}
+	}()
+	t.Cleanup(func() { s.Close() })
+
+	return s, &key.PublicKey, l.Addr().String()
+}
+
+func connectClient(t *testing.T, addr string, key *rsa.PublicKey) *mtproto.MTProto {
+	t.Helper()
+
+	m, err := mtproto.NewMTProto(mtproto.Config{
+		ServerHost:     addr,
+		PublicKey:      key,
+		SessionStorage: session.NewInMemory(nil),
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.CreateConnection())
+
+	return m
+}
+
+// rawClient sends messages of single session without any handling of service messages, so test could see
+// everything, what server sends.
+type rawClient struct {
+	key       []byte
+	sessionID int64
+	salt      int64
+	seqNo     int32 // it's not changed automatically
+}
+
+func (c *rawClient) GetSessionID() int64  { return c.sessionID }
+func (c *rawClient) GetSeqNo() int32      { return c.seqNo }
+func (c *rawClient) GetServerSalt() int64 { return c.salt }
+func (c *rawClient) GetAuthKey() []byte   { return c.key }
+
+func (c *rawClient) ReserveMessage(bool) (msgID int64, seqNo int32) {
+	return utils.GenerateMessageId(), c.seqNo
+}
+
+func dialRaw(t *testing.T, addr string, c *rawClient) transport.Transport {
+	t.Helper()
+
+	tr, err := transport.NewTransport(c, transport.TCPConnConfig{
+		Host:    addr,
+		Timeout: 5 * time.Second,
+	}, mode.Intermediate)
+	require.NoError(t, err)
+	t.Cleanup(func() { tr.Close() })
+
+	return tr
+}
+
+func TestServer(t *testing.T) {
+	s, key, addr := startServer(t)
+
+	s.Handle((&echoParams{}).CRC(), func(r *server.Request) (tl.Object, error) {
+		return &echoResult{Text: r.Object.(*echoParams).Text}, nil
+	})
+	s.Handle((&failParams{}).CRC(), func(r *server.Request) (tl.Object, error) {
+		return nil, server.NewRpcError(420, "FLOOD_WAIT_5")
+	})
+
+	m := connectClient(t, addr, key)
+	defer m.Disconnect()
+
+	res, err := m.MakeRequest(&echoParams{Text: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, &echoResult{Text: "hello"}, res)
+
+	_, err = m.MakeRequest(&failParams{})
+	var rpcErr *mtproto.ErrResponseCode
+	require.True(t, errors.As(err, &rpcErr), "got %v", err)
+	assert.Equal(t, 420, rpcErr.Code)
+	assert.Equal(t, "FLOOD_WAIT_X", rpcErr.Message)
+	assert.Equal(t, 5, rpcErr.AdditionalInfo)
+
+	// no handler for this method
+	_, err = m.MakeRequest(&echoResult{})
+	require.True(t, errors.As(err, &rpcErr), "got %v", err)
+	assert.Equal(t, 400, rpcErr.Code)
+
+	require.NoError(t, m.DestroySession(m.GetSessionID()+1))
+
+	sessions := s.Sessions()
+	require.Len(t, sessions, 1)
+	assert.Equal(t, m.GetSessionID(), sessions[0].ID())
+}
+
+func TestServer_DestroyAuthKey(t *testing.T) {
+	s, key, addr := startServer(t)
+
+	m := connectClient(t, addr, key)
+	defer m.Disconnect()
+
+	// any encrypted request, so server knows which key is used by connection
+	require.NoError(t, m.DestroySession(m.GetSessionID()+1))
+	require.Len(t, s.Sessions(), 1)
+
+	require.NoError(t, m.DestroyAuthKey())
+	assert.Empty(t, s.Sessions())
+}
+
+func TestServer_Close(t *testing.T) {
+	s, key, addr := startServer(t)
+
+	m := connectClient(t, addr, key)
+	defer m.Disconnect()
+
+	done := make(chan struct{})
+	go func() {
+		s.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server wasn't closed")
+	}
+}
+
+func TestServer_NewSessionCreatedAfterBadSalt(t *testing.T) {
+	s, key, addr := startServer(t)
+
+	s.Handle((&echoParams{}).CRC(), func(r *server.Request) (tl.Object, error) {
+		return &echoResult{Text: r.Object.(*echoParams).Text}, nil
+	})
+
+	// generating auth key and salt, known by server
+	m := connectClient(t, addr, key)
+	_, err := m.MakeRequest(&echoParams{Text: "hello"})
+	require.NoError(t, err)
+	require.NoError(t, m.Disconnect())
+
+	c := &rawClient{
+		key:       m.GetAuthKey(),
+		sessionID: utils.GenerateSessionID(),
+		salt:      m.GetServerSalt() + 1,
+	}
+	tr := dialRaw(t, addr, c)
+
+	request, err := tl.Marshal(&echoParams{Text: "hello"})
+	require.NoError(t, err)
+
+	read := func() tl.Object {
+		msg, err := tr.ReadMsg()
+		require.NoError(t, err)
+		obj, err := tl.DecodeUnknownObject(msg.GetMsg())
+		require.NoError(t, err)
+		return obj
+	}
+
+	// first message of session is rejected, so session isn't announced yet
+	require.NoError(t, tr.WriteMsg(&messages.Encrypted{Msg: request, MsgID: utils.GenerateMessageId()}, true))
+	badSalt, ok := read().(*objects.BadServerSalt)
+	require.True(t, ok, "expected bad_server_salt")
+	c.salt = badSalt.NewSalt
+
+	msgID := utils.GenerateMessageId()
+	require.NoError(t, tr.WriteMsg(&messages.Encrypted{Msg: request, MsgID: msgID}, true))
+	created, ok := read().(*objects.NewSessionCreated)
+	require.True(t, ok, "expected new_session_created")
+	assert.Equal(t, msgID, created.FirstMsgID)
+	assert.Equal(t, badSalt.NewSalt, created.ServerSalt)
+
+	for {
+		if res, ok := read().(*objects.RpcResult); ok {
+			assert.Equal(t, msgID, res.ReqMsgID)
+			break
+		}
+	}
+}
+
+func TestServer_ShortClientDHParams(t *testing.T) {
+	s, key, addr := startServer(t)
+
+	s.Handle((&echoParams{}).CRC(), func(r *server.Request) (tl.Object, error) {
+		return &echoResult{Text: r.Object.(*echoParams).Text}, nil
+	})
+
+	tr := dialRaw(t, addr, &rawClient{})
+
+	send := func(obj tl.Object) {
+		data, err := tl.Marshal(obj)
+		require.NoError(t, err)
+		require.NoError(t, tr.WriteMsg(&messages.Unencrypted{Msg: data, MsgID: utils.GenerateMessageId()}, false))
+	}
+	read := func() (tl.Object, error) {
+		msg, err := tr.ReadMsg()
+		if err != nil {
+			return nil, err
+		}
+		return tl.DecodeUnknownObject(msg.GetMsg())
+	}
+
+	nonce := tl.RandomInt128()
+	send(&objects.ReqPQMultiParams{Nonce: nonce})
+	obj, err := read()
+	require.NoError(t, err)
+	resPQ, ok := obj.(*objects.ResPQ)
+	require.True(t, ok, "expected resPQ")
+
+	p, q := math.SplitPQ(big.NewInt(0).SetBytes(resPQ.Pq))
+	inner, err := tl.Marshal(&objects.PQInnerData{
+		Pq:          resPQ.Pq,
+		P:           p.Bytes(),
+		Q:           q.Bytes(),
+		Nonce:       nonce,
+		ServerNonce: resPQ.ServerNonce,
+		NewNonce:    tl.RandomInt256(),
+	})
+	require.NoError(t, err)
+	hashAndMsg := make([]byte, 255)
+	copy(hashAndMsg, append(utils.Sha1Byte(inner), inner...))
+
+	send(&objects.ReqDHParamsParams{
+		Nonce:                nonce,
+		ServerNonce:          resPQ.ServerNonce,
+		P:                    p.Bytes(),
+		Q:                    q.Bytes(),
+		PublicKeyFingerprint: int64(binary.LittleEndian.Uint64(keys.RSAFingerprint(key))),
+		EncryptedData:        math.DoRSAencrypt(hashAndMsg, key),
+	})
+	obj, err = read()
+	require.NoError(t, err)
+	_, ok = obj.(*objects.ServerDHParamsOk)
+	require.True(t, ok, "expected server_DH_params_ok")
+
+	// single aes block is smaller than sha1 of encrypted data
+	send(&objects.SetClientDHParamsParams{
+		Nonce:         nonce,
+		ServerNonce:   resPQ.ServerNonce,
+		EncryptedData: make([]byte, 16),
+	})
+	_, err = read()
+	assert.Error(t, err, "connection must be closed")
+
+	// server is still alive
+	m := connectClient(t, addr, key)
+	defer m.Disconnect()
+	res, err := m.MakeRequest(&echoParams{Text: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, &echoResult{Text: "hello"}, res)
+}
+
+func TestServer_BadMsg(t *testing.T) {
+	s, key, addr := startServer(t)
+
+	s.Handle((&echoParams{}).CRC(), func(r *server.Request) (tl.Object, error) {
+		return &echoResult{Text: r.Object.(*echoParams).Text}, nil
+	})
+
+	m := connectClient(t, addr, key)
+	_, err := m.MakeRequest(&echoParams{Text: "hello"})
+	require.NoError(t, err)
+	require.NoError(t, m.Disconnect())
+
+	c := &rawClient{
+		key:       m.GetAuthKey(),
+		sessionID: utils.GenerateSessionID(),
+		salt:      m.GetServerSalt(),
+	}
+	tr := dialRaw(t, addr, c)
+
+	request, err := tl.Marshal(&echoParams{Text: "hello"})
+	require.NoError(t, err)
+	ack, err := tl.Marshal(&objects.MsgsAck{MsgIDs: []int64{1}})
+	require.NoError(t, err)
+
+	// skipping new_session_created and other service messages
+	read := func() tl.Object {
+		for {
+			msg, err := tr.ReadMsg()
+			require.NoError(t, err)
+			obj, err := tl.DecodeUnknownObject(msg.GetMsg())
+			require.NoError(t, err)
+			switch obj.(type) {
+			case *objects.RpcResult, *objects.BadMsgNotification:
+				return obj
+			}
+		}
+	}
+
+	// accepted message with seqno 3, all next ones are checked against it
+	firstID := utils.GenerateMessageId()
+	c.seqNo = 2
+	require.NoError(t, tr.WriteMsg(&messages.Encrypted{Msg: request, MsgID: firstID}, true))
+	_, ok := read().(*objects.RpcResult)
+	require.True(t, ok, "expected rpc_result")
+
+	for _, tt := range []struct {
+		name     string
+		msg      []byte
+		msgID    int64
+		seqNo    int32
+		odd      bool
+		wantCode int32
+	}{
+		{"not aligned msg_id", request, utils.GenerateMessageId() | 1, 4, true, 18},
+		{"seqno too low", request, utils.GenerateMessageId(), 0, true, 32},
+		{"seqno too high", request, firstID - 4, 4, true, 33},
+		{"odd seqno of ack", ack, utils.GenerateMessageId(), 4, true, 34},
+		{"even seqno of request", request, utils.GenerateMessageId(), 4, false, 35},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c.seqNo = tt.seqNo
+			require.NoError(t, tr.WriteMsg(&messages.Encrypted{Msg: tt.msg, MsgID: tt.msgID}, tt.odd))
+
+			bad, ok := read().(*objects.BadMsgNotification)
+			require.True(t, ok, "expected bad_msg_notification")
+			assert.Equal(t, tt.msgID, bad.BadMsgID)
+			assert.Equal(t, tt.wantCode, bad.Code)
+		})
+	}
+
+	// server remembers limited count of messages, so it can't say, whether older ones are duplicates
+	c.seqNo = 4
+	nextID := utils.GenerateMessageId()
+	for i := 0; i < 1024; i++ {
+		nextID += 4
+		require.NoError(t, tr.WriteMsg(&messages.Encrypted{Msg: ack, MsgID: nextID}, false))
+	}
+	tooOldID := firstID + 4
+	require.NoError(t, tr.WriteMsg(&messages.Encrypted{Msg: request, MsgID: tooOldID}, true))
+	bad, ok := read().(*objects.BadMsgNotification)
+	require.True(t, ok, "expected bad_msg_notification")
+	assert.Equal(t, tooOldID, bad.BadMsgID)
+	assert.Equal(t, int32(20), bad.Code)
+}
@@ -0,0 +1,313 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package server
+
+import (
+	"encoding/binary"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xelaj/go-dry"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/internal/mtproto/messages"
+	"github.com/xelaj/mtproto/internal/mtproto/objects"
+)
+
+// authKey is a runtime state of single auth key: its salts and sessions.
+type authKey struct {
+	s   *Server
+	id  int64
+	key []byte
+
+	mutex    sync.Mutex
+	salts    []*objects.FutureSalt // sorted by valid_since
+	sessions map[int64]*Session
+}
+
+func newAuthKey(s *Server, key []byte) *authKey {
+	return &authKey{
+		s:        s,
+		id:       idOfKey(key),
+		key:      key,
+		sessions: make(map[int64]*Session),
+	}
+}
+
+// addSalt adds salt, which is valid since now. It's used only for salt, generated by handshake.
+func (k *authKey) addSalt(salt int64, now time.Time) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.salts = append(k.salts, &objects.FutureSalt{
+		ValidSince: int32(now.Unix()),
+		ValidUntil: int32(now.Add(k.s.saltLifetime).Unix()),
+		Salt:       salt,
+	})
+}
+
+// futureSalts returns num salts, first of them is valid right now. Expired salts are removed, new ones are
+// generated if necessary.
+func (k *authKey) futureSalts(now time.Time, num int) []*objects.FutureSalt {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	unix := int32(now.Unix())
+	for len(k.salts) > 0 && k.salts[0].ValidUntil <= unix {
+		k.salts = k.salts[1:]
+	}
+
+	for len(k.salts) < num {
+		since := unix
+		if len(k.salts) > 0 {
+			since = k.salts[len(k.salts)-1].ValidUntil
+		}
+
+		k.salts = append(k.salts, &objects.FutureSalt{
+			ValidSince: since,
+			ValidUntil: since + int32(k.s.saltLifetime/time.Second),
+			Salt:       int64(binary.LittleEndian.Uint64(dry.RandomBytes(tl.LongLen))),
+		})
+	}
+
+	res := make([]*objects.FutureSalt, num)
+	copy(res, k.salts)
+	return res
+}
+
+// resetSalts drops all salts, new ones are generated on next use.
+func (k *authKey) resetSalts() {
+	k.mutex.Lock()
+	k.salts = nil
+	k.mutex.Unlock()
+}
+
+func (k *authKey) currentSalt(now time.Time) int64 {
+	return k.futureSalts(now, 1)[0].Salt
+}
+
+// isValidSalt returns true, if salt is valid right now. Since salts are overlapped a bit, client could use
+// any of them.
+func (k *authKey) isValidSalt(salt int64, now time.Time) bool {
+	for _, s := range k.futureSalts(now, 1) {
+		if s.Salt == salt {
+			return true
+		}
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	for _, s := range k.salts {
+		if s.Salt == salt && s.ValidSince <= int32(now.Unix()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getSession returns session with specific id, creating it, if it doesn't exist yet.
+func (k *authKey) getSession(id int64) *Session {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if sess, ok := k.sessions[id]; ok {
+		return sess
+	}
+
+	sess := &Session{
+		id:       id,
+		key:      k,
+		uniqueID: int64(binary.LittleEndian.Uint64(dry.RandomBytes(tl.LongLen))),
+	}
+	k.sessions[id] = sess
+	return sess
+}
+
+func (k *authKey) destroySession(id int64) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if _, ok := k.sessions[id]; !ok {
+		return false
+	}
+
+	delete(k.sessions, id)
+	return true
+}
+
+func (k *authKey) getSessions() []*Session {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	res := make([]*Session, 0, len(k.sessions))
+	for _, sess := range k.sessions {
+		res = append(res, sess)
+	}
+
+	return res
+}
+
+// Session is a client session. Single auth key could have a lot of sessions (e.g. each app instance creates
+// new one), but each session is bound to only one auth key. Session is not bound to connection: client can
+// reconnect and continue same session, so server sends messages to the last connection, which was used by
+// client.
+type Session struct {
+	id       int64
+	key      *authKey
+	uniqueID int64
+
+	mutex     sync.Mutex
+	conn      *conn
+	seqNo     int32         // count of content related messages, sent by server
+	received  []receivedMsg // recently received messages, sorted by msg_id
+	announced bool          // new_session_created was sent
+}
+
+// ID returns session_id, generated by client
+func (s *Session) ID() int64 {
+	return s.id
+}
+
+// AuthKeyID returns id of auth key, which created this session
+func (s *Session) AuthKeyID() int64 {
+	return s.key.id
+}
+
+// Push sends message to client, which is not an answer to any request (e.g. updates). Returns error, if
+// client is not connected.
+func (s *Session) Push(obj tl.Object) error {
+	return s.send(obj, true, false)
+}
+
+func (s *Session) bindConn(c *conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conn = c
+}
+
+func (s *Session) unbindConn(c *conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == c {
+		s.conn = nil
+	}
+}
+
+// announce returns true only on first call. Session is announced to client (by new_session_created) on
+// first message, which passed msg_id and salt checks, not on first received one.
+func (s *Session) announce() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.announced {
+		return false
+	}
+	s.announced = true
+	return true
+}
+
+// receivedMsg is msg_id and seqno of message, received from client.
+type receivedMsg struct {
+	id    int64
+	seqNo int32
+}
+
+// maxReceivedMsgs limits count of remembered msg_ids of single session. If client sends more messages within
+// msgIDMaxPast, the oldest of them are forgotten, and messages older than remembered ones are rejected, cause
+// server can't check, whether they are duplicates.
+const maxReceivedMsgs = 1024
+
+// receive remembers msg_id of message. It returns true as duplicate, if message with this msg_id was already
+// received, or code of bad_msg_notification, if message can't be accepted. Client could send messages not in
+// order, but seqno must grow together with msg_id: content related messages take unique odd seqno, others
+// take even one, which is equal to seqno of next content related message without 1.
+func (s *Session) receive(msgID int64, seqNo int32, now time.Time) (code int32, duplicate bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// messages older than this are rejected before this check, so no need to remember them
+	oldest := now.Add(-msgIDMaxPast).Unix() << 32 //nolint:gomnd unix time is in high bits of msg_id
+	skip := sort.Search(len(s.received), func(i int) bool { return s.received[i].id >= oldest })
+	s.received = s.received[skip:]
+
+	i := sort.Search(len(s.received), func(i int) bool { return s.received[i].id >= msgID })
+	if i < len(s.received) && s.received[i].id == msgID {
+		return 0, true
+	}
+	if i == 0 && len(s.received) >= maxReceivedMsgs {
+		return badMsgTooOld, false
+	}
+
+	// remembered messages are already ordered by seqno, so only neighbors must be checked
+	odd := seqNo&1 == 1
+	if i > 0 {
+		if prev := s.received[i-1].seqNo; prev > seqNo || (prev == seqNo && odd) {
+			return badMsgSeqNoTooLow, false
+		}
+	}
+	if i < len(s.received) {
+		if next := s.received[i].seqNo; next < seqNo || (next == seqNo && odd) {
+			return badMsgSeqNoTooHigh, false
+		}
+	}
+
+	if len(s.received) >= maxReceivedMsgs {
+		s.received = s.received[1:]
+		i--
+	}
+	s.received = append(s.received, receivedMsg{})
+	copy(s.received[i+1:], s.received[i:])
+	s.received[i] = receivedMsg{id: msgID, seqNo: seqNo}
+
+	return 0, false
+}
+
+// nextSeqNo must be called under mutex
+func (s *Session) nextSeqNo(contentRelated bool) int32 {
+	if !contentRelated {
+		return s.seqNo * 2 //nolint:gomnd it's how seqno works
+	}
+
+	s.seqNo++
+	return s.seqNo*2 - 1 //nolint:gomnd it's how seqno works
+}
+
+// send encrypts object and writes it to current connection of session.
+func (s *Session) send(obj tl.Object, contentRelated, response bool) error {
+	data, err := tl.Marshal(obj)
+	if err != nil {
+		return errors.Wrap(err, "encoding message")
+	}
+
+	// msg_id and seqno must grow in the same order as messages are written, so whole sending is locked
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		return errors.New("client is not connected")
+	}
+
+	msg := &messages.Encrypted{
+		Msg:       data,
+		MsgID:     s.key.s.newMsgID(response),
+		Salt:      s.key.currentSalt(time.Now()),
+		SessionID: s.id,
+		SeqNo:     s.nextSeqNo(contentRelated),
+	}
+
+	serialized, err := msg.SerializeAsServer(s.key.key)
+	if err != nil {
+		return errors.Wrap(err, "serializing message")
+	}
+
+	return s.conn.writeFrame(serialized)
+}
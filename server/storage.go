@@ -0,0 +1,61 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package server
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/xelaj/errs"
+)
+
+// AuthKeyStorage stores auth keys, created by server. Keys are identified by auth_key_id (lower 64 bits of
+// SHA1 of key).
+type AuthKeyStorage interface {
+	// Load returns errs.NotFound error, if key doesn't exist
+	Load(id int64) ([]byte, error)
+	Store(id int64, key []byte) error
+	Delete(id int64) error
+}
+
+type memoryStorage struct {
+	mutex sync.RWMutex
+	keys  map[int64][]byte
+}
+
+var _ AuthKeyStorage = (*memoryStorage)(nil)
+
+// NewMemoryStorage returns storage, which keeps keys only in memory.
+func NewMemoryStorage() AuthKeyStorage {
+	return &memoryStorage{keys: make(map[int64][]byte)}
+}
+
+func (m *memoryStorage) Load(id int64) ([]byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	key, ok := m.keys[id]
+	if !ok {
+		return nil, errs.NotFound("authKeyID", strconv.FormatInt(id, 10))
+	}
+	return key, nil
+}
+
+func (m *memoryStorage) Store(id int64, key []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.keys[id] = key
+	return nil
+}
+
+func (m *memoryStorage) Delete(id int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.keys, id)
+	return nil
+}
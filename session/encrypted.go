@@ -0,0 +1,318 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package session
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// EncryptionConfig is a key of encrypted session storage. Exactly one of fields must be set.
+type EncryptionConfig struct {
+	// Key is a key of application (e.g. from system keychain), it must be 32 bytes long.
+	Key []byte
+	// Passphrase is a secret of user, key is derived from it by argon2id.
+	Passphrase string
+}
+
+// ErrWrongSessionKey is returned, when stored session can't be decrypted: key is wrong or data is corrupted.
+var ErrWrongSessionKey = errors.New("can't decrypt session: wrong key or corrupted data")
+
+// encryptedLoader encrypts auth keys of session before storing them, so anyone, who reads storage, can't
+// use them without key. Other fields are not secret, so they are stored as is: auth key hash, salts, dc,
+// etc. can't be used for authorization.
+//
+// Encrypted key is:
+//
+//	magic   [4]byte // "xsk1"
+//	kdf     byte    // kdfAppKey or kdfArgon2id
+//	params  []byte  // only for kdfArgon2id: time (uint32), memory in KiB (uint32), threads (uint8), salt
+//	nonce   [24]byte
+//	payload []byte  // XChaCha20-Poly1305 of key, header and auth key hash are additional data
+type encryptedLoader struct {
+	loader SessionLoader
+	config EncryptionConfig
+
+	mutex sync.Mutex
+	// header of stored keys, it's generated once, so key is derived only once too
+	header []byte
+	// derived keys by their headers, cause deriving is slow by design
+	keys map[string][]byte
+}
+
+var (
+	_ SessionLoader  = (*encryptedLoader)(nil)
+	_ SessionLocker  = (*encryptedLoader)(nil)
+	_ SessionDeleter = (*encryptedLoader)(nil)
+)
+
+const (
+	kdfAppKey   byte = 0
+	kdfArgon2id byte = 1
+
+	// recommended parameters of RFC 9106, second option
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2SaltLen = 16
+
+	// params are read from stored header before it's authenticated, so they are limited: corrupted header
+	// must not hang or crash process on loading
+	argon2MaxTime   = 16
+	argon2MaxMemory = 1024 * 1024 // 1 GiB
+
+	argon2ParamsLen = 4 + 4 + 1 //nolint:gomnd time, memory and threads
+)
+
+var encryptedKeyMagic = []byte("xsk1")
+
+// NewEncrypted wraps storage, so auth keys are encrypted at rest. Plaintext sessions (e.g. stored by
+// NewFromFile before) are loaded as is and immediately stored back encrypted.
+func NewEncrypted(loader SessionLoader, c EncryptionConfig) (SessionLoader, error) {
+	if loader == nil {
+		return nil, errors.New("loader is nil")
+	}
+
+	header := append([]byte{}, encryptedKeyMagic...)
+	switch {
+	case c.Key != nil && c.Passphrase != "":
+		return nil, errors.New("both key and passphrase are set")
+	case c.Key != nil:
+		if len(c.Key) != chacha20poly1305.KeySize {
+			return nil, fmt.Errorf("key must be %v bytes long, got %v", chacha20poly1305.KeySize, len(c.Key))
+		}
+		header = append(header, kdfAppKey)
+	case c.Passphrase != "":
+		params := make([]byte, argon2ParamsLen+argon2SaltLen)
+		binary.LittleEndian.PutUint32(params, argon2Time)
+		binary.LittleEndian.PutUint32(params[4:], argon2Memory)
+		params[8] = argon2Threads
+		if _, err := rand.Read(params[argon2ParamsLen:]); err != nil {
+			return nil, errors.Wrap(err, "generating salt")
+		}
+		header = append(append(header, kdfArgon2id), params...)
+	default:
+		return nil, errors.New("key or passphrase is required")
+	}
+
+	return &encryptedLoader{
+		loader: loader,
+		config: c,
+		header: header,
+		keys:   make(map[string][]byte),
+	}, nil
+}
+
+func (l *encryptedLoader) Load() (*Session, error) {
+	stored, err := l.loader.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	s := copySession(stored)
+	key, plaintext, err := l.decrypt(s.Key, s.Hash)
+	if err != nil {
+		return nil, err
+	}
+	s.Key = key
+
+	for dc, key := range s.DCKeys {
+		decrypted := *key
+		var isPlaintext bool
+		decrypted.Key, isPlaintext, err = l.decrypt(key.Key, key.Hash)
+		if err != nil {
+			return nil, errors.Wrapf(err, "key of dc %v", dc)
+		}
+		plaintext = plaintext || isPlaintext
+		s.DCKeys[dc] = &decrypted
+	}
+
+	if plaintext {
+		if err := l.Store(s); err != nil {
+			return nil, errors.Wrap(err, "encrypting plaintext session")
+		}
+	}
+
+	return s, nil
+}
+
+func (l *encryptedLoader) Store(s *Session) error {
+	encrypted := copySession(s)
+	var err error
+
+	encrypted.Key, err = l.encrypt(s.Key, s.Hash)
+	if err != nil {
+		return err
+	}
+	for dc, key := range s.DCKeys {
+		k := *key
+		k.Key, err = l.encrypt(key.Key, key.Hash)
+		if err != nil {
+			return errors.Wrapf(err, "key of dc %v", dc)
+		}
+		encrypted.DCKeys[dc] = &k
+	}
+
+	return l.loader.Store(encrypted)
+}
+
+// Delete removes session from underlying loader, if it supports deleting.
+func (l *encryptedLoader) Delete() error {
+	if deleter, ok := l.loader.(SessionDeleter); ok {
+		return deleter.Delete()
+	}
+	return ErrDeleteNotSupported
+}
+
+// Lock locks underlying loader, if it's lockable.
+func (l *encryptedLoader) Lock() error {
+	if locker, ok := l.loader.(SessionLocker); ok {
+		return locker.Lock()
+	}
+	return nil
+}
+
+func (l *encryptedLoader) Unlock() error {
+	if locker, ok := l.loader.(SessionLocker); ok {
+		return locker.Unlock()
+	}
+	return nil
+}
+
+func (l *encryptedLoader) encrypt(key, hash []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return key, nil
+	}
+
+	aead, err := l.aead(l.header)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]byte, len(l.header)+aead.NonceSize(), len(l.header)+aead.NonceSize()+len(key)+aead.Overhead())
+	copy(res, l.header)
+	nonce := res[len(l.header):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "generating nonce")
+	}
+
+	return aead.Seal(res, nonce, key, additionalData(l.header, hash)), nil
+}
+
+// decrypt returns auth key. If stored key isn't encrypted, it's returned as is and plaintext is true.
+func (l *encryptedLoader) decrypt(data, hash []byte) (key []byte, plaintext bool, err error) {
+	if len(data) == 0 {
+		return data, false, nil
+	}
+	if !bytes.HasPrefix(data, encryptedKeyMagic) {
+		return data, true, nil
+	}
+
+	headerLen := len(encryptedKeyMagic) + 1
+	if len(data) < headerLen {
+		return nil, false, ErrWrongSessionKey
+	}
+	switch data[len(encryptedKeyMagic)] {
+	case kdfAppKey:
+	case kdfArgon2id:
+		headerLen += argon2ParamsLen + argon2SaltLen
+	default:
+		return nil, false, fmt.Errorf("unknown key derivation function %v", data[len(encryptedKeyMagic)])
+	}
+	if len(data) < headerLen+chacha20poly1305.NonceSizeX {
+		return nil, false, ErrWrongSessionKey
+	}
+
+	header := data[:headerLen]
+	aead, err := l.aead(header)
+	if err != nil {
+		return nil, false, err
+	}
+
+	nonce := data[headerLen : headerLen+aead.NonceSize()]
+	key, err = aead.Open(nil, nonce, data[headerLen+aead.NonceSize():], additionalData(header, hash))
+	if err != nil {
+		return nil, false, ErrWrongSessionKey
+	}
+
+	return key, false, nil
+}
+
+func (l *encryptedLoader) aead(header []byte) (cipher.AEAD, error) {
+	key, err := l.deriveKey(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return chacha20poly1305.NewX(key)
+}
+
+func (l *encryptedLoader) deriveKey(header []byte) ([]byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if key, ok := l.keys[string(header)]; ok {
+		return key, nil
+	}
+
+	var key []byte
+	switch kdf := header[len(encryptedKeyMagic)]; kdf {
+	case kdfAppKey:
+		if l.config.Key == nil {
+			return nil, errors.New("session is encrypted by application key, but passphrase is set")
+		}
+		key = l.config.Key
+
+	case kdfArgon2id:
+		if l.config.Passphrase == "" {
+			return nil, errors.New("session is encrypted by passphrase, but application key is set")
+		}
+		params := header[len(encryptedKeyMagic)+1:]
+		time, memory, threads := binary.LittleEndian.Uint32(params), binary.LittleEndian.Uint32(params[4:]), params[8]
+		// argon2 panics with zero params
+		if time == 0 || threads == 0 || time > argon2MaxTime || memory > argon2MaxMemory {
+			return nil, ErrWrongSessionKey
+		}
+		key = argon2.IDKey([]byte(l.config.Passphrase), params[argon2ParamsLen:], time, memory, threads,
+			chacha20poly1305.KeySize)
+
+	default:
+		return nil, fmt.Errorf("unknown key derivation function %v", kdf)
+	}
+
+	l.keys[string(header)] = key
+	return key, nil
+}
+
+// additionalData binds encrypted key to its hash, so keys can't be swapped in storage.
+func additionalData(header, hash []byte) []byte {
+	return append(append([]byte{}, header...), hash...)
+}
+
+// copySession makes copy of session, which could be changed without changing original one. Keys themselves
+// are not copied, they are replaced entirely.
+func copySession(s *Session) *Session {
+	res := *s
+	if s.DCKeys != nil {
+		res.DCKeys = make(map[int]*AuthKey, len(s.DCKeys))
+		for dc, key := range s.DCKeys {
+			k := *key
+			res.DCKeys[dc] = &k
+		}
+	}
+	if s.FutureSalts != nil {
+		res.FutureSalts = append([]FutureSalt(nil), s.FutureSalts...)
+	}
+	return &res
+}
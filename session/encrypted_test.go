@@ -0,0 +1,188 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package session_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/session"
+)
+
+func testSession() *session.Session {
+	return &session.Session{
+		Key:      bytes.Repeat([]byte("secret auth key!"), 16),
+		Hash:     []byte("key hash"),
+		Salt:     1234,
+		Hostname: "1337.228.1488.0",
+		DC:       2,
+		DCKeys: map[int]*session.AuthKey{
+			4: {Key: bytes.Repeat([]byte("other secret key"), 16), Hash: []byte("dc4 hash"), Salt: 1},
+		},
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config session.EncryptionConfig
+		wrong  session.EncryptionConfig
+	}{
+		{
+			name:   "application key",
+			config: session.EncryptionConfig{Key: bytes.Repeat([]byte{1}, 32)},
+			wrong:  session.EncryptionConfig{Key: bytes.Repeat([]byte{2}, 32)},
+		},
+		{
+			name:   "passphrase",
+			config: session.EncryptionConfig{Passphrase: "correct horse battery staple"},
+			wrong:  session.EncryptionConfig{Passphrase: "incorrect horse"},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			storePath := filepath.Join(os.TempDir(), "session.json")
+			defer os.Remove(storePath)
+
+			storage, err := session.NewEncrypted(session.NewFromFile(storePath), tt.config)
+			require.NoError(t, err)
+
+			sess := testSession()
+			require.NoError(t, storage.Store(sess))
+			assert.Equal(t, testSession(), sess, "stored session must not be changed")
+
+			data, err := ioutil.ReadFile(storePath)
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), base64.StdEncoding.EncodeToString(sess.Key))
+			assert.NotContains(t, string(data), base64.StdEncoding.EncodeToString(sess.DCKeys[4].Key))
+
+			// new instance must decrypt session, which is stored by other one
+			storage, err = session.NewEncrypted(session.NewFromFile(storePath), tt.config)
+			require.NoError(t, err)
+			got, err := storage.Load()
+			require.NoError(t, err)
+			assert.Equal(t, sess, got)
+
+			storage, err = session.NewEncrypted(session.NewFromFile(storePath), tt.wrong)
+			require.NoError(t, err)
+			_, err = storage.Load()
+			assert.True(t, errors.Is(err, session.ErrWrongSessionKey), "got %v", err)
+		})
+	}
+}
+
+func TestEncrypted_MigratePlaintext(t *testing.T) {
+	storePath := filepath.Join(os.TempDir(), "session.json")
+	defer os.Remove(storePath)
+
+	sess := testSession()
+	require.NoError(t, session.NewFromFile(storePath).Store(sess))
+
+	config := session.EncryptionConfig{Key: bytes.Repeat([]byte{1}, 32)}
+	storage, err := session.NewEncrypted(session.NewFromFile(storePath), config)
+	require.NoError(t, err)
+
+	got, err := storage.Load()
+	require.NoError(t, err)
+	assert.Equal(t, sess, got)
+
+	data, err := ioutil.ReadFile(storePath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), base64.StdEncoding.EncodeToString(sess.Key), "file must be encrypted")
+
+	plain, err := session.NewFromFile(storePath).Load()
+	require.NoError(t, err)
+	assert.NotEqual(t, sess.Key, plain.Key)
+}
+
+func TestEncrypted_Swapped(t *testing.T) {
+	storePath := filepath.Join(os.TempDir(), "session.json")
+	defer os.Remove(storePath)
+
+	config := session.EncryptionConfig{Key: bytes.Repeat([]byte{1}, 32)}
+	storage, err := session.NewEncrypted(session.NewFromFile(storePath), config)
+	require.NoError(t, err)
+	require.NoError(t, storage.Store(testSession()))
+
+	// keys are bound to their hashes, so they can't be swapped between dcs
+	plain := session.NewFromFile(storePath)
+	stored, err := plain.Load()
+	require.NoError(t, err)
+	stored.Key, stored.DCKeys[4].Key = stored.DCKeys[4].Key, stored.Key
+	require.NoError(t, plain.Store(stored))
+
+	_, err = storage.Load()
+	assert.True(t, errors.Is(err, session.ErrWrongSessionKey), "got %v", err)
+}
+
+func TestNewEncrypted_InvalidConfig(t *testing.T) {
+	storage := session.NewFromFile(filepath.Join(os.TempDir(), "session.json"))
+
+	for _, c := range []session.EncryptionConfig{
+		{},
+		{Key: []byte("short")},
+		{Key: bytes.Repeat([]byte{1}, 32), Passphrase: "both"},
+	} {
+		_, err := session.NewEncrypted(storage, c)
+		assert.Error(t, err)
+	}
+}
+
+func TestEncrypted_HugeArgon2Params(t *testing.T) {
+	for name, params := range map[string]struct {
+		time, memory uint32
+	}{
+		"time":   {time: 1 << 31, memory: 64 * 1024},
+		"memory": {time: 1, memory: 1 << 31}, // 2 TiB
+	} {
+		t.Run(name, func(t *testing.T) {
+			// magic, kdf, time, memory, threads, salt, nonce and some payload
+			key := append([]byte("xsk1"), 1)
+			key = append(key, make([]byte, 4+4)...)
+			binary.LittleEndian.PutUint32(key[5:], params.time)
+			binary.LittleEndian.PutUint32(key[9:], params.memory)
+			key = append(key, 4)
+			key = append(key, make([]byte, 16+24+48)...)
+
+			config := session.EncryptionConfig{Passphrase: "secret"}
+			storage, err := session.NewEncrypted(session.NewInMemory(&session.Session{Key: key}), config)
+			require.NoError(t, err)
+
+			_, err = storage.Load()
+			assert.True(t, errors.Is(err, session.ErrWrongSessionKey), "got %v", err)
+		})
+	}
+}
+
+// legacyLoader implements only methods, which SessionLoader had before deleting was added.
+type legacyLoader struct {
+	stored *session.Session
+}
+
+func (l *legacyLoader) Load() (*session.Session, error) { return l.stored, nil }
+
+func (l *legacyLoader) Store(s *session.Session) error {
+	l.stored = s
+	return nil
+}
+
+func TestEncrypted_DeleteNotSupported(t *testing.T) {
+	config := session.EncryptionConfig{Key: bytes.Repeat([]byte{1}, 32)}
+	storage, err := session.NewEncrypted(&legacyLoader{}, config)
+	require.NoError(t, err)
+
+	err = storage.(session.SessionDeleter).Delete()
+	assert.True(t, errors.Is(err, session.ErrDeleteNotSupported), "got %v", err)
+}
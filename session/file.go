@@ -0,0 +1,353 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package session
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/xelaj/errs"
+	"github.com/xelaj/go-dry"
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+)
+
+type genericFileSessionLoader struct {
+	path       string
+	lastEdited time.Time
+	cached     *Session
+	// lock is an opened lock file, while session is locked
+	lock *os.File
+}
+
+var (
+	_ SessionLoader  = (*genericFileSessionLoader)(nil)
+	_ SessionLocker  = (*genericFileSessionLoader)(nil)
+	_ SessionDeleter = (*genericFileSessionLoader)(nil)
+)
+
+func NewFromFile(path string) SessionLoader {
+	return &genericFileSessionLoader{path: path}
+}
+
+func (l *genericFileSessionLoader) Load() (*Session, error) {
+	info, err := os.Stat(l.path)
+	switch {
+	case err == nil:
+	case errors.Is(err, syscall.ENOENT):
+		return nil, errs.NotFound("file", l.path)
+	default:
+		return nil, err
+	}
+
+	if info.ModTime().Equal(l.lastEdited) && l.cached != nil {
+		return l.cached, nil
+	}
+
+	data, err := ioutil.ReadFile(l.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading file")
+	}
+
+	s, err := unmarshalSession(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing file")
+	}
+
+	l.cached = s
+	l.lastEdited = info.ModTime()
+
+	return s, nil
+}
+
+func (l *genericFileSessionLoader) Store(s *Session) error {
+	dir, _ := filepath.Split(l.path)
+	if !dry.FileExists(dir) {
+		return fmt.Errorf("%v: directory not found", dir)
+	}
+	if !dry.FileIsDir(dir) {
+		return fmt.Errorf("%v: not a directory", dir)
+	}
+
+	return writeFileAtomic(l.path, marshalSession(s))
+}
+
+// writeFileAtomic writes data to temporary file in same directory and then renames it to path, so file is
+// never seen partially written, even if process crashes in the middle.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "creating temporary file")
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck file doesn't exist after rename
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "writing temporary file")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "syncing temporary file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "closing temporary file")
+	}
+
+	return errors.Wrap(os.Rename(f.Name(), path), "replacing file")
+}
+
+func (l *genericFileSessionLoader) Delete() error {
+	l.cached = nil
+	l.lastEdited = time.Time{}
+
+	err := os.Remove(l.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err, "removing file")
+	}
+
+	return nil
+}
+
+// Lock locks file near to session file (session file itself can't be locked: it's replaced on each store).
+// If lock is already held by other process (or other loader of same file), it returns ErrSessionLocked.
+func (l *genericFileSessionLoader) Lock() error {
+	if l.lock != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(l.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "opening lock file")
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return errors.Wrap(err, l.path)
+	}
+
+	l.lock = f
+	return nil
+}
+
+// Unlock releases lock. Lock file isn't removed: other process could already wait for it, so removing would
+// let third one to lock new file with same name.
+func (l *genericFileSessionLoader) Unlock() error {
+	if l.lock == nil {
+		return nil
+	}
+
+	f := l.lock
+	l.lock = nil
+	if err := unlockFile(f); err != nil {
+		f.Close()
+		return errors.Wrap(err, "unlocking file")
+	}
+	return f.Close()
+}
+
+// marshalSession encodes session to json of current format version. Same format is used by all loaders,
+// which store raw bytes, so session could be moved between them.
+func marshalSession(s *Session) []byte {
+	t := new(tokenStorageFormat)
+	t.writeSession(s)
+	data, _ := json.Marshal(t)
+
+	return data
+}
+
+// unmarshalSession decodes session of any supported format version.
+func unmarshalSession(data []byte) (*Session, error) {
+	t := new(tokenStorageFormat)
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	if err := t.migrate(); err != nil {
+		return nil, err
+	}
+
+	return t.readSession()
+}
+
+// tokenStorageFormatVersion is a current version of session file. Files of older versions are migrated on
+// load, files of newer versions are rejected: they could contain data, which we can't keep on next store.
+const tokenStorageFormatVersion = 1
+
+// tokenStorageFormat is a session file. First version had no 'version' field at all (so it's zero), and
+// stored only key, hash, salt and hostname, these fields are kept as is.
+type tokenStorageFormat struct {
+	Version  int    `json:"version"`
+	Key      string `json:"key"`
+	Hash     string `json:"hash"`
+	Salt     string `json:"salt"`
+	Hostname string `json:"hostname"`
+
+	DC          int                       `json:"dc,omitempty"`
+	DCKeys      map[string]*authKeyFormat `json:"dc_keys,omitempty"`
+	TimeOffset  int64                     `json:"time_offset,omitempty"` // in milliseconds
+	FutureSalts []*futureSaltFormat       `json:"future_salts,omitempty"`
+	UserID      int64                     `json:"user_id,omitempty"`
+	Bot         bool                      `json:"bot,omitempty"`
+	Layer       int                       `json:"layer,omitempty"`
+}
+
+type authKeyFormat struct {
+	Key  string `json:"key"`
+	Hash string `json:"hash"`
+	Salt string `json:"salt"`
+}
+
+type futureSaltFormat struct {
+	ValidSince int64  `json:"valid_since"` // unix time
+	ValidUntil int64  `json:"valid_until"` // unix time
+	Salt       string `json:"salt"`
+}
+
+// tokenStorageMigrations converts file of version i to version i+1.
+var tokenStorageMigrations = []func(t *tokenStorageFormat) error{
+	// 0 -> 1: new fields are optional, and datacenter of legacy session is unknown, so it's kept zero
+	func(t *tokenStorageFormat) error { return nil },
+}
+
+func (t *tokenStorageFormat) migrate() error {
+	if t.Version > tokenStorageFormatVersion {
+		return fmt.Errorf("session file version %v is newer than supported %v", t.Version, tokenStorageFormatVersion)
+	}
+	if t.Version < 0 {
+		return fmt.Errorf("invalid session file version %v", t.Version)
+	}
+
+	for ; t.Version < tokenStorageFormatVersion; t.Version++ {
+		if err := tokenStorageMigrations[t.Version](t); err != nil {
+			return errors.Wrapf(err, "migrating from version %v", t.Version)
+		}
+	}
+
+	return nil
+}
+
+func (t *tokenStorageFormat) writeSession(s *Session) {
+	t.Version = tokenStorageFormatVersion
+	t.Key = base64.StdEncoding.EncodeToString(s.Key)
+	t.Hash = base64.StdEncoding.EncodeToString(s.Hash)
+	t.Salt = encodeInt64ToBase64(s.Salt)
+	t.Hostname = s.Hostname
+
+	t.DC = s.DC
+	if len(s.DCKeys) > 0 {
+		t.DCKeys = make(map[string]*authKeyFormat, len(s.DCKeys))
+		for dc, key := range s.DCKeys {
+			t.DCKeys[strconv.Itoa(dc)] = &authKeyFormat{
+				Key:  base64.StdEncoding.EncodeToString(key.Key),
+				Hash: base64.StdEncoding.EncodeToString(key.Hash),
+				Salt: encodeInt64ToBase64(key.Salt),
+			}
+		}
+	}
+	t.TimeOffset = s.TimeOffset.Milliseconds()
+	for _, salt := range s.FutureSalts {
+		t.FutureSalts = append(t.FutureSalts, &futureSaltFormat{
+			ValidSince: salt.ValidSince.Unix(),
+			ValidUntil: salt.ValidUntil.Unix(),
+			Salt:       encodeInt64ToBase64(salt.Salt),
+		})
+	}
+	t.UserID = s.UserID
+	t.Bot = s.Bot
+	t.Layer = s.Layer
+}
+
+func (t *tokenStorageFormat) readSession() (*Session, error) {
+	s := new(Session)
+	var err error
+
+	s.Key, err = base64.StdEncoding.DecodeString(t.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid binary data of 'key'")
+	}
+	s.Hash, err = base64.StdEncoding.DecodeString(t.Hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid binary data of 'hash'")
+	}
+	s.Salt, err = decodeInt64ToBase64(t.Salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid binary data of 'salt'")
+	}
+	s.Hostname = t.Hostname
+
+	s.DC = t.DC
+	if len(t.DCKeys) > 0 {
+		s.DCKeys = make(map[int]*AuthKey, len(t.DCKeys))
+		for dc, key := range t.DCKeys {
+			id, err := strconv.Atoi(dc)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid dc id %q", dc)
+			}
+			if s.DCKeys[id], err = key.read(); err != nil {
+				return nil, errors.Wrapf(err, "key of dc %v", id)
+			}
+		}
+	}
+	s.TimeOffset = time.Duration(t.TimeOffset) * time.Millisecond
+	for i, salt := range t.FutureSalts {
+		value, err := decodeInt64ToBase64(salt.Salt)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid binary data of future salt %v", i)
+		}
+		s.FutureSalts = append(s.FutureSalts, FutureSalt{
+			ValidSince: time.Unix(salt.ValidSince, 0),
+			ValidUntil: time.Unix(salt.ValidUntil, 0),
+			Salt:       value,
+		})
+	}
+	s.UserID = t.UserID
+	s.Bot = t.Bot
+	s.Layer = t.Layer
+
+	return s, nil
+}
+
+func (k *authKeyFormat) read() (*AuthKey, error) {
+	res := new(AuthKey)
+	var err error
+
+	res.Key, err = base64.StdEncoding.DecodeString(k.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid binary data of 'key'")
+	}
+	res.Hash, err = base64.StdEncoding.DecodeString(k.Hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid binary data of 'hash'")
+	}
+	res.Salt, err = decodeInt64ToBase64(k.Salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid binary data of 'salt'")
+	}
+	return res, nil
+}
+
+func encodeInt64ToBase64(i int64) string {
+	buf := make([]byte, tl.LongLen)
+	binary.LittleEndian.PutUint64(buf, uint64(i))
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+func decodeInt64ToBase64(i string) (int64, error) {
+	buf, err := base64.StdEncoding.DecodeString(i)
+	if err != nil {
+		return 0, err
+	}
+	if len(buf) != tl.LongLen {
+		return 0, fmt.Errorf("expected %v bytes, got %v", tl.LongLen, len(buf))
+	}
+	return int64(binary.LittleEndian.Uint64(buf)), nil
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package session_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xelaj/mtproto/session"
+)
+
+func TestMTProto_SaveSession(t *testing.T) {
+	storePath := filepath.Join(os.TempDir(), "session.json")
+	defer os.Remove(storePath)
+
+	os.Remove(storePath)
+
+	storage := session.NewFromFile(storePath)
+	err := storage.Store(&session.Session{
+		Key:      []byte("some auth key"),
+		Hash:     []byte("oooooh that's definitely a key hash!"),
+		Salt:     0,
+		Hostname: "1337.228.1488.0",
+	})
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(storePath)
+	check(err)
+
+	assert.Equal(t, `{"version":1,"key":"c29tZSBhdXRoIGtleQ==",`+
+		`"hash":"b29vb29oIHRoYXQncyBkZWZpbml0ZWx5IGEga2V5IGhhc2gh","salt":"AAAAAAAAAAA=",`+
+		`"hostname":"1337.228.1488.0"}`, string(data))
+}
+
+func TestMTProto_SessionRoundTrip(t *testing.T) {
+	storePath := filepath.Join(os.TempDir(), "session.json")
+	defer os.Remove(storePath)
+
+	// time is stored with seconds precision
+	now := time.Unix(time.Now().Unix(), 0)
+	sess := &session.Session{
+		Key:      []byte("some auth key"),
+		Hash:     []byte("some hash"),
+		Salt:     1234,
+		Hostname: "1337.228.1488.0",
+		DC:       4,
+		DCKeys: map[int]*session.AuthKey{
+			2: {Key: []byte("dc 2 key"), Hash: []byte("dc 2 hash"), Salt: -1},
+		},
+		TimeOffset: -3 * time.Second,
+		FutureSalts: []session.FutureSalt{
+			{ValidSince: now, ValidUntil: now.Add(time.Hour), Salt: 1},
+			{ValidSince: now.Add(time.Hour), ValidUntil: now.Add(2 * time.Hour), Salt: 2},
+		},
+		UserID: 1337,
+		Bot:    true,
+		Layer:  121,
+	}
+
+	storage := session.NewFromFile(storePath)
+	require.NoError(t, storage.Store(sess))
+
+	got, err := session.NewFromFile(storePath).Load()
+	require.NoError(t, err)
+	assert.Equal(t, sess, got)
+
+	salt, ok := got.CurrentSalt(now.Add(90 * time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), salt)
+	_, ok = got.CurrentSalt(now.Add(3 * time.Hour))
+	assert.False(t, ok, "all salts are expired")
+}
+
+func TestMTProto_LoadSessionOfNewerVersion(t *testing.T) {
+	storePath := filepath.Join(os.TempDir(), "session.json")
+	require.NoError(t, ioutil.WriteFile(storePath, []byte(`{"version":100,"key":""}`), 0600))
+	defer os.Remove(storePath)
+
+	_, err := session.NewFromFile(storePath).Load()
+	assert.Error(t, err)
+}
+
+func TestMTProto_LoadSessionTruncatedSalt(t *testing.T) {
+	storePath := filepath.Join(os.TempDir(), "session.json")
+	defer os.Remove(storePath)
+
+	for _, tt := range []struct {
+		name string
+		data string
+	}{
+		{"salt", `{"key":"","salt":"AAAA"}`},
+		{"dc salt", `{"key":"","salt":"AAAAAAAAAAA=","dc_keys":{"4":{"key":"","salt":"AAAA"}}}`},
+		{"future salt", `{"key":"","salt":"AAAAAAAAAAA=","future_salts":[{"salt":"AAAA"}]}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, ioutil.WriteFile(storePath, []byte(tt.data), 0600))
+
+			_, err := session.NewFromFile(storePath).Load()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMTProto_LoadSession(t *testing.T) {
+	storePath := filepath.Join(os.TempDir(), "session.json")
+	tmpData := `{"key":"c29tZSBhdXRoIGtleQ==","hash":"b29vb29oIHRoYXQncyBkZWZpbml0ZWx5IGEga2V5IGhhc2gh"` +
+		`,"salt":"AAAAAAAAAAA=","hostname":"1337.228.1488.0"}`
+	ioutil.WriteFile(storePath, []byte(tmpData), 0666)
+	defer os.Remove(storePath)
+
+	storage := session.NewFromFile(storePath)
+
+	sess, err := storage.Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, &session.Session{
+		Key:      []byte("some auth key"),
+		Hash:     []byte("oooooh that's definitely a key hash!"),
+		Salt:     0,
+		Hostname: "1337.228.1488.0",
+	}, sess)
+}
+
+func TestMTProto_DeleteSession(t *testing.T) {
+	storePath := filepath.Join(os.TempDir(), "session.json")
+	defer os.Remove(storePath)
+
+	storage := session.NewFromFile(storePath)
+	require.NoError(t, storage.Store(&session.Session{Key: []byte("some auth key")}))
+
+	_, err := storage.Load()
+	require.NoError(t, err)
+
+	require.NoError(t, storage.(session.SessionDeleter).Delete())
+	assert.NoFileExists(t, storePath)
+
+	_, err = storage.Load()
+	assert.Error(t, err)
+
+	// deleting again is not an error: there is just nothing to delete
+	assert.NoError(t, storage.(session.SessionDeleter).Delete())
+}
+
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestFile_Lock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	storePath := filepath.Join(dir, "session.json")
+
+	first := session.NewFromFile(storePath).(session.SessionLocker)
+	second := session.NewFromFile(storePath).(session.SessionLocker)
+
+	require.NoError(t, first.Lock())
+	require.NoError(t, first.Lock(), "locking twice by same loader is not an error")
+
+	err = second.Lock()
+	assert.True(t, errors.Is(err, session.ErrSessionLocked), "got %v", err)
+
+	require.NoError(t, first.Unlock())
+	require.NoError(t, second.Lock())
+	require.NoError(t, second.Unlock())
+	assert.NoError(t, second.Unlock(), "unlocking twice is not an error")
+}
+
+func TestFile_StoreIsAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	storePath := filepath.Join(dir, "session.json")
+
+	storage := session.NewFromFile(storePath)
+	require.NoError(t, storage.Store(&session.Session{Key: []byte("first key")}))
+	require.NoError(t, storage.Store(&session.Session{Key: []byte("second key")}))
+
+	info, err := os.Stat(storePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// temporary files are renamed, nothing else remains in directory
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "session.json", files[0].Name())
+
+	got, err := session.NewFromFile(storePath).Load()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("second key"), got.Key)
+}
@@ -0,0 +1,86 @@
+package session
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SessionLoader is the interface which allows you to access sessions from different storages (like
+// filesystem, database, s3 storage, etc.)
+type SessionLoader interface {
+	Load() (*Session, error)
+	Store(*Session) error
+}
+
+// SessionDeleter is implemented by loaders, which can remove stored session. It's not a part of SessionLoader,
+// so loaders, which were written before, are still valid.
+type SessionDeleter interface {
+	// Delete removes stored session. If there is no session, it must not return error.
+	Delete() error
+}
+
+// SessionLocker is implemented by loaders, which storage could be shared between processes (like session
+// file). Client holds lock while it's connected: telegram revokes auth key, if it's used by two connections
+// at once.
+type SessionLocker interface {
+	// Lock fails immediately with ErrSessionLocked, if session is locked by someone else. Locking twice by
+	// same loader is not an error.
+	Lock() error
+	Unlock() error
+}
+
+// ErrSessionLocked means that session is already used by other client, probably in other process.
+var ErrSessionLocked = errors.New("session is used by another process")
+
+// ErrDeleteNotSupported means that loader doesn't implement SessionDeleter, so stored session can't be removed.
+var ErrDeleteNotSupported = errors.New("session loader doesn't support deleting")
+
+// Sesion is a basic data of specific session. Typically, session stores default hostname of mtproto server
+// (cause all accounts ties to specific server after sign in), session key, server hash and salt. 
+type Session struct {
+	Key      []byte
+	Hash     []byte
+	Salt     int64
+	Hostname string
+
+	// DC is an id of datacenter, which Key, Salt and Hostname belong to. Zero means that datacenter is unknown
+	// (e.g. session was stored by previous version of package).
+	DC int
+	// DCKeys are auth keys of other datacenters, which were used by client, indexed by dc id. Every
+	// datacenter has its own auth key, so they are kept to not generate new ones after each migration.
+	DCKeys map[int]*AuthKey
+	// TimeOffset is a difference between server and local clocks, client corrects msg_id with it.
+	TimeOffset time.Duration
+	// FutureSalts are salts of current datacenter, which server gave in advance.
+	FutureSalts []FutureSalt
+	// UserID is an id of authorized account, zero if session isn't authorized yet.
+	UserID int64
+	Bot    bool
+	// Layer is a version of api, which session was initialized with.
+	Layer int
+}
+
+// AuthKey is an auth key of single datacenter.
+type AuthKey struct {
+	Key  []byte
+	Hash []byte
+	Salt int64
+}
+
+// FutureSalt is a server salt, which is valid only in specific time range.
+type FutureSalt struct {
+	ValidSince time.Time
+	ValidUntil time.Time
+	Salt       int64
+}
+
+// CurrentSalt returns future salt, which is valid at specific time. If there is no such salt, ok is false.
+func (s *Session) CurrentSalt(now time.Time) (salt int64, ok bool) {
+	for _, fs := range s.FutureSalts {
+		if !now.Before(fs.ValidSince) && now.Before(fs.ValidUntil) {
+			return fs.Salt, true
+		}
+	}
+	return 0, false
+}
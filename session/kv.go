@@ -0,0 +1,62 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package session
+
+import (
+	"github.com/pkg/errors"
+	"github.com/xelaj/errs"
+)
+
+// KV is a generic key-value storage (redis, bolt, sql table, etc.). It allows to keep sessions of many
+// accounts in single database, each one under its own key.
+type KV interface {
+	// Get returns value of key. If there is no such key, it must return nil value without error.
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	// Delete removes key. If there is no such key, it must not return error.
+	Delete(key string) error
+}
+
+type kvLoader struct {
+	kv  KV
+	key string
+}
+
+var (
+	_ SessionLoader  = (*kvLoader)(nil)
+	_ SessionDeleter = (*kvLoader)(nil)
+)
+
+// NewFromKV returns loader, which stores session in kv under specific key. Session is stored in same format
+// as session file, so it could be copied from file as is.
+func NewFromKV(kv KV, key string) SessionLoader {
+	return &kvLoader{kv: kv, key: key}
+}
+
+func (l *kvLoader) Load() (*Session, error) {
+	data, err := l.kv.Get(l.key)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting session")
+	}
+	if len(data) == 0 {
+		return nil, errs.NotFound("key", l.key)
+	}
+
+	s, err := unmarshalSession(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing session")
+	}
+
+	return s, nil
+}
+
+func (l *kvLoader) Store(s *Session) error {
+	return errors.Wrap(l.kv.Set(l.key, marshalSession(s)), "setting session")
+}
+
+func (l *kvLoader) Delete() error {
+	return errors.Wrap(l.kv.Delete(l.key), "deleting session")
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package session_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xelaj/errs"
+
+	"github.com/xelaj/mtproto/session"
+)
+
+// mapKV is a simplest KV, real ones are databases.
+type mapKV map[string][]byte
+
+func (m mapKV) Get(key string) ([]byte, error) { return m[key], nil }
+func (m mapKV) Set(key string, value []byte) error {
+	m[key] = value
+	return nil
+}
+func (m mapKV) Delete(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestKV(t *testing.T) {
+	kv := mapKV{}
+	first := session.NewFromKV(kv, "account:1")
+	second := session.NewFromKV(kv, "account:2")
+
+	_, err := first.Load()
+	assert.True(t, errs.IsNotFound(err), "got %v", err)
+
+	require.NoError(t, first.Store(&session.Session{Key: []byte("first key"), DC: 2}))
+	require.NoError(t, second.Store(&session.Session{Key: []byte("second key"), DC: 4}))
+
+	got, err := first.Load()
+	require.NoError(t, err)
+	assert.Equal(t, &session.Session{Key: []byte("first key"), Hash: []byte{}, DC: 2}, got)
+	got, err = second.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("second key"), got.Key)
+
+	require.NoError(t, first.(session.SessionDeleter).Delete())
+	_, err = first.Load()
+	assert.True(t, errs.IsNotFound(err), "got %v", err)
+	assert.Contains(t, kv, "account:2")
+	assert.NoError(t, first.(session.SessionDeleter).Delete())
+}
+
+func TestKV_SameFormatAsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "session")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	storePath := filepath.Join(dir, "session.json")
+
+	sess := &session.Session{Key: []byte("some auth key"), Hash: []byte("some hash"), Salt: 1, DC: 2}
+	require.NoError(t, session.NewFromFile(storePath).Store(sess))
+	data, err := ioutil.ReadFile(storePath)
+	require.NoError(t, err)
+
+	got, err := session.NewFromKV(mapKV{"key": data}, "key").Load()
+	require.NoError(t, err)
+	assert.Equal(t, sess, got)
+}
+
+type brokenKV struct{ mapKV }
+
+func (brokenKV) Get(string) ([]byte, error) { return nil, errors.New("connection refused") }
+
+func TestKV_Error(t *testing.T) {
+	_, err := session.NewFromKV(brokenKV{}, "key").Load()
+	require.Error(t, err)
+	assert.False(t, errs.IsNotFound(err), "storage error must not look like missing session")
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package session
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// lockFile always fails: there is no way to lock file on this platform, and session file, which isn't
+// protected from other processes, could burn auth key. Other storages (e.g. NewFromKV) work as usual.
+func lockFile(*os.File) error {
+	return fmt.Errorf("locking session file is not supported on %v", runtime.GOOS)
+}
+
+func unlockFile(*os.File) error { return nil }
@@ -0,0 +1,59 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package session
+
+import (
+	"sync"
+
+	"github.com/xelaj/errs"
+)
+
+type memoryLoader struct {
+	mutex   sync.Mutex
+	session *Session
+}
+
+var (
+	_ SessionLoader  = (*memoryLoader)(nil)
+	_ SessionDeleter = (*memoryLoader)(nil)
+)
+
+// NewInMemory returns loader, which keeps session only in memory, so it's lost when process exits. s is an
+// initial session (e.g. converted by sessionconv package), nil means that there is no session yet.
+func NewInMemory(s *Session) SessionLoader {
+	l := new(memoryLoader)
+	if s != nil {
+		l.session = copySession(s)
+	}
+	return l
+}
+
+func (l *memoryLoader) Load() (*Session, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.session == nil {
+		return nil, errs.NotFound("session", "memory")
+	}
+
+	return copySession(l.session), nil
+}
+
+func (l *memoryLoader) Store(s *Session) error {
+	l.mutex.Lock()
+	l.session = copySession(s)
+	l.mutex.Unlock()
+
+	return nil
+}
+
+func (l *memoryLoader) Delete() error {
+	l.mutex.Lock()
+	l.session = nil
+	l.mutex.Unlock()
+
+	return nil
+}
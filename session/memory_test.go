@@ -0,0 +1,51 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package session_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xelaj/errs"
+
+	"github.com/xelaj/mtproto/session"
+)
+
+func TestInMemory(t *testing.T) {
+	storage := session.NewInMemory(nil)
+	_, err := storage.Load()
+	assert.True(t, errs.IsNotFound(err), "got %v", err)
+
+	sess := &session.Session{
+		Key:    []byte("some auth key"),
+		DC:     2,
+		DCKeys: map[int]*session.AuthKey{4: {Key: []byte("dc 4 key"), Salt: 1}},
+	}
+	require.NoError(t, storage.Store(sess))
+
+	// stored session must not be changed through pointers, which loader or caller still hold
+	sess.DCKeys[4].Salt = 2
+	got, err := storage.Load()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), got.DCKeys[4].Salt)
+	got.DCKeys[5] = &session.AuthKey{}
+	got, err = storage.Load()
+	require.NoError(t, err)
+	assert.Len(t, got.DCKeys, 1)
+
+	require.NoError(t, storage.(session.SessionDeleter).Delete())
+	_, err = storage.Load()
+	assert.True(t, errs.IsNotFound(err), "got %v", err)
+}
+
+func TestInMemory_Initial(t *testing.T) {
+	sess := &session.Session{Key: []byte("some auth key"), Hostname: "1337.228.1488.0"}
+
+	got, err := session.NewInMemory(sess).Load()
+	require.NoError(t, err)
+	assert.Equal(t, sess, got)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package sessionconv
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/internal/utils"
+	"github.com/xelaj/mtproto/session"
+)
+
+// compactPrefix is a prefix of own string format, digit is a version of format
+const compactPrefix = "xelaj1:"
+
+const (
+	compactFlagBot = 1 << iota
+)
+
+// compactHeaderSize is a size of fixed fields: flags, dc (uint16), salt, user id and length of hostname
+const compactHeaderSize = 1 + 2 + 8 + 8 + 1
+
+// Encode exports session as compact string, which could be copied and pasted anywhere (e.g. to env
+// variable). String contains auth key, so it must be kept in secret like password.
+//
+// Format is 'xelaj1:' and url-safe base64 (without padding) of flags (byte), dc (uint16), salt (int64), user
+// id (int64), length of hostname (byte), hostname and auth key, all numbers are little endian.
+func Encode(s *session.Session) (string, error) {
+	if len(s.Key) == 0 {
+		return "", errors.New("auth key is empty")
+	}
+	if len(s.Hostname) > math.MaxUint8 {
+		return "", fmt.Errorf("hostname is too long: %v", len(s.Hostname))
+	}
+	if s.DC < 0 || s.DC > math.MaxUint16 {
+		return "", fmt.Errorf("invalid dc %v", s.DC)
+	}
+
+	data := make([]byte, compactHeaderSize, compactHeaderSize+len(s.Hostname)+len(s.Key))
+	if s.Bot {
+		data[0] |= compactFlagBot
+	}
+	binary.LittleEndian.PutUint16(data[1:], uint16(s.DC))
+	binary.LittleEndian.PutUint64(data[3:], uint64(s.Salt))
+	binary.LittleEndian.PutUint64(data[11:], uint64(s.UserID))
+	data[19] = byte(len(s.Hostname))
+	data = append(data, s.Hostname...)
+	data = append(data, s.Key...)
+
+	return compactPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Decode imports session from string, which is made by Encode.
+func Decode(str string) (*session.Session, error) {
+	if !strings.HasPrefix(str, compactPrefix) {
+		return nil, errors.New("unknown format of session string")
+	}
+	data, err := decodeBase64(strings.TrimPrefix(str, compactPrefix))
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding base64")
+	}
+	if len(data) < compactHeaderSize {
+		return nil, errors.New("session string is too small")
+	}
+
+	hostnameLen := int(data[19])
+	if len(data) <= compactHeaderSize+hostnameLen {
+		return nil, errors.New("session string is too small")
+	}
+	key := data[compactHeaderSize+hostnameLen:]
+
+	return &session.Session{
+		Key:      key,
+		Hash:     utils.AuthKeyHash(key),
+		Salt:     int64(binary.LittleEndian.Uint64(data[3:])),
+		Hostname: string(data[compactHeaderSize : compactHeaderSize+hostnameLen]),
+		DC:       int(binary.LittleEndian.Uint16(data[1:])),
+		UserID:   int64(binary.LittleEndian.Uint64(data[11:])),
+		Bot:      data[0]&compactFlagBot != 0,
+	}, nil
+}
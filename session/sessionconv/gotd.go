@@ -0,0 +1,80 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package sessionconv
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/session"
+)
+
+// gotdVersion is a version of gotd session file, which is supported
+const gotdVersion = 1
+
+// gotdFile is a gotd session file (session.FileStorage). Config is a cached config of server, it's not
+// needed to restore session, so it's not parsed.
+//
+// https://github.com/gotd/td/blob/main/session/session.go
+type gotdFile struct {
+	Version int
+	Data    struct {
+		Config    json.RawMessage
+		DC        int
+		Addr      string
+		AuthKey   []byte
+		AuthKeyID []byte
+		Salt      int64
+	}
+}
+
+// FromGotdFile imports gotd json session file.
+func FromGotdFile(data []byte) (*session.Session, error) {
+	file := new(gotdFile)
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, errors.Wrap(err, "parsing file")
+	}
+	if file.Version != gotdVersion {
+		return nil, fmt.Errorf("unsupported version of gotd session: %v", file.Version)
+	}
+
+	host, port, err := splitHostPort(file.Data.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSession(file.Data.DC, host, port, file.Data.AuthKey)
+	if err != nil {
+		return nil, err
+	}
+	s.Salt = file.Data.Salt
+
+	return s, nil
+}
+
+// ToGotdFile exports session as gotd json session file.
+func ToGotdFile(s *session.Session) ([]byte, error) {
+	if err := checkKey(s); err != nil {
+		return nil, err
+	}
+	dc, _, err := sessionDC(s)
+	if err != nil {
+		return nil, err
+	}
+
+	file := new(gotdFile)
+	file.Version = gotdVersion
+	// gotd requests config by itself, if it's empty
+	file.Data.Config = json.RawMessage("{}")
+	file.Data.DC = dc
+	file.Data.Addr = s.Hostname
+	file.Data.AuthKey = s.Key
+	file.Data.AuthKeyID = s.Hash
+	file.Data.Salt = s.Salt
+
+	return json.Marshal(file)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package sessionconv
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/session"
+)
+
+// gramJSVersion is a first char of GramJS string session, same as Telethon one
+const gramJSVersion = "1"
+
+// FromGramJSString imports GramJS StringSession: version char and base64 of dc id (byte), length of address
+// (uint16), address, port (uint16) and auth key, all numbers are big endian.
+//
+// https://github.com/gram-js/gramjs/blob/master/gramjs/sessions/StringSession.ts
+func FromGramJSString(str string) (*session.Session, error) {
+	if len(str) == 0 || str[:1] != gramJSVersion {
+		return nil, errors.New("unknown version of gramjs session")
+	}
+	data, err := decodeBase64(str[1:])
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding base64")
+	}
+
+	if len(data) < 3 { //nolint:gomnd dc and length of address
+		return nil, errors.New("gramjs session is too small")
+	}
+	addrLen := int(binary.BigEndian.Uint16(data[1:]))
+	if len(data) != 3+addrLen+2+authKeySize { //nolint:gomnd dc, length of address and port
+		return nil, fmt.Errorf("invalid size of gramjs session: %v", len(data))
+	}
+	host := string(data[3 : 3+addrLen])
+	// telethon session could have same size, but its 'address' isn't an ip
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("invalid address %q", host)
+	}
+	port := binary.BigEndian.Uint16(data[3+addrLen:])
+
+	return newSession(int(data[0]), host, int(port), data[3+addrLen+2:])
+}
+
+// ToGramJSString exports session as GramJS StringSession.
+func ToGramJSString(s *session.Session) (string, error) {
+	if err := checkKey(s); err != nil {
+		return "", err
+	}
+	dc, _, err := sessionDC(s)
+	if err != nil {
+		return "", err
+	}
+	host, port, err := splitHostPort(s.Hostname)
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, 0, 3+len(host)+2+authKeySize)                 //nolint:gomnd dc, length of address and port
+	data = append(data, byte(dc), byte(len(host)>>8), byte(len(host))) //nolint:gomnd big endian
+	data = append(data, host...)
+	data = append(data, byte(port>>8), byte(port)) //nolint:gomnd big endian
+	data = append(data, s.Key...)
+
+	return gramJSVersion + base64.StdEncoding.EncodeToString(data), nil
+}
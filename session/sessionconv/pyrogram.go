@@ -0,0 +1,141 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package sessionconv
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/session"
+)
+
+// sizes of decoded Pyrogram string sessions
+const (
+	// dc id, test mode, auth key, user id (int32), is bot
+	pyrogramLegacySize = 1 + 1 + authKeySize + 4 + 1
+	// same as legacy, but user id is int64
+	pyrogramLegacy64Size = 1 + 1 + authKeySize + 8 + 1
+	// dc id, api id (int32), test mode, auth key, user id (int64), is bot
+	pyrogramSize = 1 + 4 + 1 + authKeySize + 8 + 1
+)
+
+// FromPyrogramString imports Pyrogram session string. All versions are supported: 1.x ones without api id
+// and 2.x ones with it. Since string contains only dc id, address of dc is taken from default list.
+//
+// https://github.com/pyrogram/pyrogram/blob/master/pyrogram/storage/storage.py
+func FromPyrogramString(str string) (*session.Session, error) {
+	data, err := decodeBase64(str)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding base64")
+	}
+
+	var (
+		testMode bool
+		key      []byte
+		userID   int64
+		bot      bool
+	)
+	switch len(data) {
+	case pyrogramLegacySize:
+		testMode = data[1] != 0
+		key = data[2 : 2+authKeySize]
+		userID = int64(int32(binary.BigEndian.Uint32(data[2+authKeySize:])))
+		bot = data[2+authKeySize+4] != 0
+	case pyrogramLegacy64Size:
+		testMode = data[1] != 0
+		key = data[2 : 2+authKeySize]
+		userID = int64(binary.BigEndian.Uint64(data[2+authKeySize:]))
+		bot = data[2+authKeySize+8] != 0
+	case pyrogramSize:
+		testMode = data[5] != 0
+		key = data[6 : 6+authKeySize]
+		userID = int64(binary.BigEndian.Uint64(data[6+authKeySize:]))
+		bot = data[6+authKeySize+8] != 0
+	default:
+		return nil, fmt.Errorf("invalid size of pyrogram session: %v", len(data))
+	}
+
+	dc := int(data[0])
+	host, err := dcAddress(dc, testMode)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSession(dc, host, defaultPort, key)
+	if err != nil {
+		return nil, err
+	}
+	s.UserID = userID
+	s.Bot = bot
+
+	return s, nil
+}
+
+// ToPyrogramString exports session as Pyrogram 2.x session string. Pyrogram requires api id of application,
+// which authorized session.
+func ToPyrogramString(s *session.Session, apiID int) (string, error) {
+	if err := checkKey(s); err != nil {
+		return "", err
+	}
+	dc, testMode, err := sessionDC(s)
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]byte, pyrogramSize)
+	data[0] = byte(dc)
+	binary.BigEndian.PutUint32(data[1:], uint32(apiID))
+	if testMode {
+		data[5] = 1
+	}
+	copy(data[6:], s.Key)
+	binary.BigEndian.PutUint64(data[6+authKeySize:], uint64(s.UserID))
+	if s.Bot {
+		data[6+authKeySize+8] = 1
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// FromPyrogramFile imports Pyrogram SQLite session file (*.session).
+func FromPyrogramFile(data []byte) (*session.Session, error) {
+	db, err := openSQLite(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// sessions(dc_id INTEGER PRIMARY KEY, api_id INTEGER, test_mode INTEGER, auth_key BLOB, date INTEGER NOT
+	// NULL, user_id INTEGER, is_bot INTEGER), api_id is only in 2.x
+	rows, err := db.readTable("sessions")
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("file doesn't contain session")
+	}
+	row := rows[0]
+
+	dc, _ := row["dc_id"].(int64)
+	testMode, _ := row["test_mode"].(int64)
+	key, _ := row["auth_key"].([]byte)
+	userID, _ := row["user_id"].(int64)
+	bot, _ := row["is_bot"].(int64)
+
+	host, err := dcAddress(int(dc), testMode != 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSession(int(dc), host, defaultPort, key)
+	if err != nil {
+		return nil, err
+	}
+	s.UserID = userID
+	s.Bot = bot != 0
+
+	return s, nil
+}
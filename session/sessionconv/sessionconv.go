@@ -0,0 +1,160 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+// Package sessionconv converts sessions of other mtproto libraries, so authorized account could be moved
+// between them without new sign in. Supported formats are:
+//
+//   - string sessions of Telethon, Pyrogram and GramJS (import and export)
+//   - sqlite session files of Telethon and Pyrogram (import only)
+//   - json session files of gotd (import and export)
+//   - own compact string (import and export), see Encode
+//
+// Other libraries don't store server salt, so imported sessions have zero salt: server reports right one on
+// first request, and client resends it automatically.
+package sessionconv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/internal/utils"
+	"github.com/xelaj/mtproto/session"
+)
+
+const (
+	authKeySize = 256
+	defaultPort = 443
+)
+
+// addresses of datacenters for formats, which store only dc id
+var (
+	productionDCs = map[int]string{
+		1: "149.154.175.58",
+		2: "149.154.167.50",
+		3: "149.154.175.100",
+		4: "149.154.167.91",
+		5: "91.108.56.151",
+	}
+	testDCs = map[int]string{
+		1: "149.154.175.10",
+		2: "149.154.167.40",
+		3: "149.154.175.117",
+	}
+)
+
+// FromString imports string session of any supported format: own one, Telethon, GramJS or Pyrogram.
+func FromString(str string) (*session.Session, error) {
+	str = strings.TrimSpace(str)
+	switch {
+	case strings.HasPrefix(str, compactPrefix):
+		return Decode(str)
+	case strings.HasPrefix(str, telethonVersion):
+		// Telethon and GramJS have same version, but GramJS stores length of address
+		if s, err := FromGramJSString(str); err == nil {
+			return s, nil
+		}
+		return FromTelethonString(str)
+	default:
+		return FromPyrogramString(str)
+	}
+}
+
+func newSession(dc int, host string, port int, key []byte) (*session.Session, error) {
+	if len(key) != authKeySize {
+		return nil, fmt.Errorf("auth key must be %v bytes long, got %v", authKeySize, len(key))
+	}
+
+	return &session.Session{
+		Key:      key,
+		Hash:     utils.AuthKeyHash(key),
+		Hostname: net.JoinHostPort(host, strconv.Itoa(port)),
+		DC:       dc,
+	}, nil
+}
+
+// dcAddress returns address of datacenter for formats, which store only dc id
+func dcAddress(dc int, test bool) (string, error) {
+	dcs := productionDCs
+	if test {
+		dcs = testDCs
+	}
+
+	addr, ok := dcs[dc]
+	if !ok {
+		return "", fmt.Errorf("unknown dc %v", dc)
+	}
+	return addr, nil
+}
+
+// sessionAddress returns ip and port of session server.
+func sessionAddress(s *session.Session) (net.IP, int, error) {
+	host, port, err := splitHostPort(s.Hostname)
+	if err != nil {
+		return nil, 0, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0, fmt.Errorf("hostname %q is not an ip address", s.Hostname)
+	}
+
+	return ip, port, nil
+}
+
+func splitHostPort(addr string) (host string, port int, err error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "invalid address %q", addr)
+	}
+	port, err = strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "invalid port of %q", addr)
+	}
+	return host, port, nil
+}
+
+// sessionDC returns dc of session. Legacy sessions don't store dc, so it's found by address of server.
+func sessionDC(s *session.Session) (dc int, test bool, err error) {
+	host, _, err := net.SplitHostPort(s.Hostname)
+	if err != nil {
+		host = s.Hostname
+	}
+	for id, addr := range testDCs {
+		if addr == host {
+			return id, true, nil
+		}
+	}
+	if s.DC != 0 {
+		return s.DC, false, nil
+	}
+	for id, addr := range productionDCs {
+		if addr == host {
+			return id, false, nil
+		}
+	}
+
+	return 0, false, fmt.Errorf("dc of %q is unknown", s.Hostname)
+}
+
+func checkKey(s *session.Session) error {
+	if len(s.Key) != authKeySize {
+		return fmt.Errorf("auth key must be %v bytes long, got %v", authKeySize, len(s.Key))
+	}
+	return nil
+}
+
+// decodeBase64 decodes both url-safe and standard alphabets, with or without padding: python and js
+// libraries use different ones.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if strings.ContainsAny(s, "+/") {
+		return base64.RawStdEncoding.DecodeString(s)
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package sessionconv_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/internal/utils"
+	"github.com/xelaj/mtproto/session"
+	"github.com/xelaj/mtproto/session/sessionconv"
+)
+
+// fixtures are made by original python and js code, key of all sessions is bytes from 0 to 255
+func testKey() []byte {
+	key := make([]byte, 256)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+func reversedKey() []byte {
+	key := testKey()
+	for i, j := 0, len(key)-1; i < j; i, j = i+1, j-1 {
+		key[i], key[j] = key[j], key[i]
+	}
+	return key
+}
+
+func testSession(dc int, hostname string) *session.Session {
+	return &session.Session{
+		Key:      testKey(),
+		Hash:     utils.AuthKeyHash(testKey()),
+		Hostname: hostname,
+		DC:       dc,
+	}
+}
+
+func readStrings(t *testing.T) map[string]string {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "strings.json"))
+	require.NoError(t, err)
+	res := make(map[string]string)
+	require.NoError(t, json.Unmarshal(data, &res))
+	return res
+}
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	return data
+}
+
+func TestFromString(t *testing.T) {
+	strings := readStrings(t)
+
+	pyrogram := testSession(4, "149.154.167.91:443")
+	pyrogram.UserID = 777000
+	pyrogram.Bot = true
+	pyrogramLegacy := testSession(2, "149.154.167.40:443")
+	pyrogramLegacy.UserID = 777000
+	pyrogramLegacy64 := testSession(2, "149.154.167.50:443")
+	pyrogramLegacy64.UserID = 5000000000
+
+	for _, tt := range []struct {
+		name     string
+		parse    func(string) (*session.Session, error)
+		expected *session.Session
+	}{
+		{"telethon", sessionconv.FromTelethonString, testSession(2, "149.154.167.51:443")},
+		{"telethon_ipv6", sessionconv.FromTelethonString, testSession(4, "[2001:67c:4e8:f002::a]:443")},
+		{"gramjs", sessionconv.FromGramJSString, testSession(2, "149.154.167.51:443")},
+		{"pyrogram", sessionconv.FromPyrogramString, pyrogram},
+		{"pyrogram_legacy", sessionconv.FromPyrogramString, pyrogramLegacy},
+		{"pyrogram_legacy64", sessionconv.FromPyrogramString, pyrogramLegacy64},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.parse(strings[tt.name])
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, s)
+
+			s, err = sessionconv.FromString(strings[tt.name])
+			require.NoError(t, err, "format must be detected")
+			assert.Equal(t, tt.expected, s)
+		})
+	}
+}
+
+func TestToString(t *testing.T) {
+	strings := readStrings(t)
+
+	telethon, err := sessionconv.ToTelethonString(testSession(2, "149.154.167.51:443"))
+	require.NoError(t, err)
+	assert.Equal(t, strings["telethon"], telethon)
+
+	telethon, err = sessionconv.ToTelethonString(testSession(4, "[2001:67c:4e8:f002::a]:443"))
+	require.NoError(t, err)
+	assert.Equal(t, strings["telethon_ipv6"], telethon)
+
+	gramjs, err := sessionconv.ToGramJSString(testSession(2, "149.154.167.51:443"))
+	require.NoError(t, err)
+	assert.Equal(t, strings["gramjs"], gramjs)
+
+	s := testSession(4, "149.154.167.91:443")
+	s.UserID = 777000
+	s.Bot = true
+	pyrogram, err := sessionconv.ToPyrogramString(s, 12345)
+	require.NoError(t, err)
+	assert.Equal(t, strings["pyrogram"], pyrogram)
+
+	// legacy session doesn't know its dc, but it's found by address
+	s.DC = 0
+	pyrogram, err = sessionconv.ToPyrogramString(s, 12345)
+	require.NoError(t, err)
+	assert.Equal(t, strings["pyrogram"], pyrogram)
+}
+
+func TestCompact(t *testing.T) {
+	s := testSession(2, "149.154.167.50:443")
+	s.Salt = -1234567890
+	s.UserID = 777000
+	s.Bot = true
+
+	str, err := sessionconv.Encode(s)
+	require.NoError(t, err)
+	assert.NotContains(t, str, "=", "padding is not needed")
+
+	got, err := sessionconv.Decode(str)
+	require.NoError(t, err)
+	assert.Equal(t, s, got)
+
+	got, err = sessionconv.FromString(" " + str + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, s, got)
+
+	_, err = sessionconv.Decode(str[:20])
+	assert.Error(t, err)
+}
+
+func TestFromTelethonFile(t *testing.T) {
+	s, err := sessionconv.FromTelethonFile(readFile(t, "telethon.session"))
+	require.NoError(t, err)
+
+	expected := testSession(2, "149.154.167.51:443")
+	expected.DCKeys = map[int]*session.AuthKey{
+		4: {Key: reversedKey(), Hash: utils.AuthKeyHash(reversedKey())},
+	}
+	assert.Equal(t, expected, s)
+}
+
+func TestFromPyrogramFile(t *testing.T) {
+	s, err := sessionconv.FromPyrogramFile(readFile(t, "pyrogram.session"))
+	require.NoError(t, err)
+
+	expected := testSession(4, "149.154.167.91:443")
+	expected.UserID = 777000
+	expected.Bot = true
+	assert.Equal(t, expected, s)
+}
+
+func TestGotdFile(t *testing.T) {
+	s := testSession(2, "149.154.167.50:443")
+	s.Salt = 1234
+
+	data, err := sessionconv.ToGotdFile(s)
+	require.NoError(t, err)
+
+	got, err := sessionconv.FromGotdFile(data)
+	require.NoError(t, err)
+	assert.Equal(t, s, got)
+
+	// file, which is stored by gotd itself
+	got, err = sessionconv.FromGotdFile([]byte(`{"Version":1,"Data":{"Config":{"BlockedMode":false,"ThisDC":2},` +
+		`"DC":2,"Addr":"149.154.167.50:443","AuthKey":"` + encodeStd(testKey()) + `","AuthKeyID":"` +
+		encodeStd(s.Hash) + `","Salt":1234}}`))
+	require.NoError(t, err)
+	assert.Equal(t, s, got)
+}
+
+func TestInvalid(t *testing.T) {
+	for _, str := range []string{"", "1", "1AAAA", "AAAA", "xelaj1:", "xelaj1:!!!"} {
+		_, err := sessionconv.FromString(str)
+		assert.Error(t, err, "%q", str)
+	}
+
+	_, err := sessionconv.FromTelethonFile([]byte("definitely not a sqlite file, but long enough to have header" +
+		string(bytes.Repeat([]byte{0}, 100))))
+	assert.Error(t, err)
+	_, err = sessionconv.FromTelethonFile(readFile(t, "pyrogram.session"))
+	assert.Error(t, err, "pyrogram file doesn't have address of dc")
+}
+
+func encodeStd(b []byte) string {
+	data, _ := json.Marshal(b)
+	return string(data[1 : len(data)-1])
+}
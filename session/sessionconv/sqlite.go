@@ -0,0 +1,444 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package sessionconv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sqliteDB is a minimal read-only reader of sqlite database file, which is enough to read session files of
+// python libraries without cgo. Only rowid tables of utf-8 databases are supported. Database in WAL mode is
+// read as is, so it must be checkpointed before (it's done by sqlite on close).
+//
+// https://www.sqlite.org/fileformat2.html
+type sqliteDB struct {
+	data     []byte
+	pageSize int
+	// usable size of page, some bytes at the end could be reserved by extensions
+	usable int
+}
+
+const (
+	sqliteHeaderSize = 100
+	sqliteMagic      = "SQLite format 3\x00"
+
+	sqlitePageInteriorTable = 0x05
+	sqlitePageLeafTable     = 0x0d
+
+	// real databases are never that deep, so deeper tree means corrupted (probably cycled) file
+	sqliteMaxDepth = 64
+)
+
+func openSQLite(data []byte) (*sqliteDB, error) {
+	if len(data) < sqliteHeaderSize || string(data[:len(sqliteMagic)]) != sqliteMagic {
+		return nil, errors.New("not a sqlite database")
+	}
+
+	pageSize := int(binary.BigEndian.Uint16(data[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %v", pageSize)
+	}
+
+	// zero means that database is empty and encoding is not set yet
+	if encoding := binary.BigEndian.Uint32(data[56:]); encoding > 1 {
+		return nil, fmt.Errorf("only utf-8 databases are supported, got encoding %v", encoding)
+	}
+
+	return &sqliteDB{
+		data:     data,
+		pageSize: pageSize,
+		usable:   pageSize - int(data[20]),
+	}, nil
+}
+
+// readTable returns all rows of table by names of columns. Values are int64, float64, string, []byte or nil.
+func (db *sqliteDB) readTable(name string) ([]map[string]interface{}, error) {
+	var root int64
+	var sql string
+	err := db.scanTable(1, func(_ int64, payload []byte) error {
+		// sqlite_master is: type, name, tbl_name, rootpage, sql
+		rec, err := parseRecord(payload)
+		if err != nil {
+			return errors.Wrap(err, "reading schema")
+		}
+		if len(rec) < 5 || rec[0] != "table" {
+			return nil
+		}
+		if tableName, ok := rec[1].(string); !ok || !strings.EqualFold(tableName, name) {
+			return nil
+		}
+
+		var ok bool
+		if root, ok = rec[3].(int64); !ok {
+			return errors.New("invalid root page of table")
+		}
+		if sql, ok = rec[4].(string); !ok {
+			return errors.New("invalid schema of table")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if root == 0 {
+		return nil, fmt.Errorf("table %v not found", name)
+	}
+
+	columns, rowidColumn, err := parseColumns(sql)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing schema of %v", name)
+	}
+
+	var rows []map[string]interface{}
+	err = db.scanTable(int(root), func(rowid int64, payload []byte) error {
+		rec, err := parseRecord(payload)
+		if err != nil {
+			return errors.Wrapf(err, "reading row %v", rowid)
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			var value interface{}
+			// columns, which were added after row was inserted, are missing in record
+			if i < len(rec) {
+				value = rec[i]
+			}
+			// integer primary key is an alias of rowid, it's not stored in record
+			if i == rowidColumn && value == nil {
+				value = rowid
+			}
+			// sqlite stores floats without fractional part as integers
+			if v, ok := value.(int64); ok && column.real {
+				value = float64(v)
+			}
+			row[column.name] = value
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func (db *sqliteDB) page(n int) ([]byte, error) {
+	if n < 1 || n > len(db.data)/db.pageSize {
+		return nil, fmt.Errorf("page %v is out of file", n)
+	}
+	return db.data[(n-1)*db.pageSize : n*db.pageSize], nil
+}
+
+// scanTable calls f for every row of table b-tree in order of rowid.
+func (db *sqliteDB) scanTable(root int, f func(rowid int64, payload []byte) error) error {
+	return db.scanPage(root, f, 0)
+}
+
+func (db *sqliteDB) scanPage(n int, f func(rowid int64, payload []byte) error, depth int) error {
+	if depth > sqliteMaxDepth {
+		return errors.New("b-tree is too deep")
+	}
+
+	page, err := db.page(n)
+	if err != nil {
+		return err
+	}
+	// first page contains file header
+	header := 0
+	if n == 1 {
+		header = sqliteHeaderSize
+	}
+	if len(page) < header+12 {
+		return fmt.Errorf("page %v is too small", n)
+	}
+
+	cells := int(binary.BigEndian.Uint16(page[header+3:]))
+	cellOffset := func(ptrs, i int) (int, error) {
+		pos := ptrs + i*2
+		if pos+2 > db.usable {
+			return 0, fmt.Errorf("page %v: too many cells", n)
+		}
+		offset := int(binary.BigEndian.Uint16(page[pos:]))
+		if offset >= db.usable {
+			return 0, fmt.Errorf("page %v: cell %v is out of page", n, i)
+		}
+		return offset, nil
+	}
+
+	switch page[header] {
+	case sqlitePageLeafTable:
+		for i := 0; i < cells; i++ {
+			offset, err := cellOffset(header+8, i)
+			if err != nil {
+				return err
+			}
+
+			size, sizeLen := readVarint(page[offset:db.usable])
+			rowid, rowidLen := readVarint(page[offset+sizeLen : db.usable])
+			if sizeLen == 0 || rowidLen == 0 {
+				return fmt.Errorf("page %v: cell %v is broken", n, i)
+			}
+
+			payload, err := db.payload(page, offset+sizeLen+rowidLen, size)
+			if err != nil {
+				return errors.Wrapf(err, "page %v: cell %v", n, i)
+			}
+			if err := f(rowid, payload); err != nil {
+				return err
+			}
+		}
+
+	case sqlitePageInteriorTable:
+		for i := 0; i < cells; i++ {
+			offset, err := cellOffset(header+12, i)
+			if err != nil {
+				return err
+			}
+			if offset+4 > db.usable {
+				return fmt.Errorf("page %v: cell %v is broken", n, i)
+			}
+
+			if err := db.scanPage(int(binary.BigEndian.Uint32(page[offset:])), f, depth+1); err != nil {
+				return err
+			}
+		}
+		return db.scanPage(int(binary.BigEndian.Uint32(page[header+8:])), f, depth+1)
+
+	default:
+		return fmt.Errorf("page %v: unexpected type %#x", n, page[header])
+	}
+
+	return nil
+}
+
+// payload reads payload of cell, which could be continued in overflow pages.
+func (db *sqliteDB) payload(page []byte, offset int, size int64) ([]byte, error) {
+	if size < 0 || size > int64(len(db.data)) {
+		return nil, fmt.Errorf("invalid payload size %v", size)
+	}
+
+	// https://www.sqlite.org/fileformat2.html#b_tree_pages
+	u := int64(db.usable)
+	maxLocal := u - 35                        //nolint:gomnd from spec
+	minLocal := (u-12)*32/255 - 23            //nolint:gomnd from spec
+	local := minLocal + (size-minLocal)%(u-4) //nolint:gomnd from spec
+	if size <= maxLocal {
+		local = size
+	} else if local > maxLocal {
+		local = minLocal
+	}
+
+	if int64(offset)+local > u {
+		return nil, errors.New("payload is out of page")
+	}
+	res := make([]byte, 0, size)
+	res = append(res, page[offset:offset+int(local)]...)
+	if local == size {
+		return res, nil
+	}
+
+	if int64(offset)+local+4 > u {
+		return nil, errors.New("overflow page number is out of page")
+	}
+	next := int(binary.BigEndian.Uint32(page[offset+int(local):]))
+	for pages := 0; int64(len(res)) < size; pages++ {
+		if pages > len(db.data)/db.pageSize {
+			return nil, errors.New("overflow pages are cycled")
+		}
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading overflow page")
+		}
+
+		next = int(binary.BigEndian.Uint32(overflow))
+		chunk := overflow[4:db.usable]
+		if rest := size - int64(len(res)); rest < int64(len(chunk)) {
+			chunk = chunk[:rest]
+		}
+		res = append(res, chunk...)
+	}
+
+	return res, nil
+}
+
+// readVarint reads sqlite varint. If data is too small, n is zero.
+func readVarint(data []byte) (v int64, n int) {
+	var res uint64
+	for i := 0; i < 9 && i < len(data); i++ {
+		if i == 8 { //nolint:gomnd last byte uses all bits
+			return int64(res<<8 | uint64(data[i])), 9
+		}
+		res = res<<7 | uint64(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			return int64(res), i + 1
+		}
+	}
+	return 0, 0
+}
+
+// parseRecord parses row of table.
+//
+// https://www.sqlite.org/fileformat2.html#record_format
+func parseRecord(payload []byte) ([]interface{}, error) {
+	headerSize, n := readVarint(payload)
+	if n == 0 || headerSize < int64(n) || headerSize > int64(len(payload)) {
+		return nil, errors.New("invalid record header")
+	}
+
+	var types []int64
+	for pos := n; pos < int(headerSize); {
+		t, n := readVarint(payload[pos:headerSize])
+		if n == 0 {
+			return nil, errors.New("invalid record header")
+		}
+		types = append(types, t)
+		pos += n
+	}
+
+	body := payload[headerSize:]
+	res := make([]interface{}, len(types))
+	for i, t := range types {
+		var size int64
+		switch {
+		case t >= 1 && t <= 6: //nolint:gomnd integers
+			size = []int64{0, 1, 2, 3, 4, 6, 8}[t]
+		case t == 7: //nolint:gomnd float
+			size = 8
+		case t >= 12: //nolint:gomnd blob or text
+			size = (t - 12) / 2 //nolint:gomnd from spec
+		case t == 10 || t == 11: //nolint:gomnd reserved
+			return nil, fmt.Errorf("column %v: reserved serial type %v", i, t)
+		}
+		if size > int64(len(body)) {
+			return nil, fmt.Errorf("column %v is out of record", i)
+		}
+		value := body[:size]
+		body = body[size:]
+
+		switch {
+		case t == 0:
+			res[i] = nil
+		case t <= 6: //nolint:gomnd integers
+			var v int64
+			for _, b := range value {
+				v = v<<8 | int64(b)
+			}
+			// sign extension
+			shift := 64 - 8*uint(len(value)) //nolint:gomnd bits
+			res[i] = v << shift >> shift
+		case t == 7: //nolint:gomnd float
+			res[i] = math.Float64frombits(binary.BigEndian.Uint64(value))
+		case t == 8 || t == 9: //nolint:gomnd constants 0 and 1
+			res[i] = t - 8 //nolint:gomnd
+		case t%2 == 0:
+			res[i] = append([]byte{}, value...)
+		default:
+			res[i] = string(value)
+		}
+	}
+
+	return res, nil
+}
+
+type sqliteColumn struct {
+	name string
+	// column has REAL affinity
+	real bool
+}
+
+// parseColumns returns columns from 'CREATE TABLE' statement. If table has 'INTEGER PRIMARY KEY' column, its
+// index is returned as rowidColumn, otherwise it's -1.
+func parseColumns(sql string) (columns []sqliteColumn, rowidColumn int, err error) {
+	start, end := strings.Index(sql, "("), strings.LastIndex(sql, ")")
+	if start < 0 || end < start {
+		return nil, 0, errors.New("columns not found")
+	}
+
+	rowidColumn = -1
+	for _, def := range splitTopLevel(sql[start+1 : end]) {
+		fields := strings.Fields(def)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+			// table constraint, not a column
+			continue
+		}
+
+		upper := strings.ToUpper(strings.Join(fields[1:], " "))
+		if strings.HasPrefix(upper, "INTEGER PRIMARY KEY") && !strings.Contains(upper, "DESC") {
+			rowidColumn = len(columns)
+		}
+		columns = append(columns, sqliteColumn{
+			name: strings.Trim(fields[0], "\"`[]'"),
+			real: hasRealAffinity(upper),
+		})
+	}
+
+	return columns, rowidColumn, nil
+}
+
+// splitTopLevel splits column definitions by commas, which are not inside brackets or quotes.
+func splitTopLevel(s string) []string {
+	var res []string
+	depth, last := 0, 0
+	var quote rune
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			res = append(res, s[last:i])
+			last = i + 1
+		}
+	}
+
+	return append(res, s[last:])
+}
+
+// hasRealAffinity checks type of column by affinity rules.
+//
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity
+func hasRealAffinity(definition string) bool {
+	// type could have few words, it's finished by first constraint
+	var words []string
+loop:
+	for _, word := range strings.Fields(definition) {
+		switch word {
+		case "CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK", "DEFAULT", "COLLATE", "REFERENCES",
+			"GENERATED", "AS":
+			break loop
+		}
+		words = append(words, word)
+	}
+
+	typ := strings.Join(words, " ")
+	if strings.Contains(typ, "INT") || strings.Contains(typ, "CHAR") || strings.Contains(typ, "CLOB") ||
+		strings.Contains(typ, "TEXT") || strings.Contains(typ, "BLOB") {
+		return false
+	}
+	return strings.Contains(typ, "REAL") || strings.Contains(typ, "FLOA") || strings.Contains(typ, "DOUB")
+}
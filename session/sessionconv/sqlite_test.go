@@ -0,0 +1,93 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package sessionconv
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// overflow.sqlite has small pages, so table has few levels of b-tree, and first row doesn't fit into page.
+func TestSQLite_ReadTable(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "overflow.sqlite"))
+	require.NoError(t, err)
+
+	db, err := openSQLite(data)
+	require.NoError(t, err)
+	rows, err := db.readTable("data")
+	require.NoError(t, err)
+	require.Len(t, rows, 199)
+
+	big := make([]byte, 3000)
+	for i := range big {
+		big[i] = byte(i % 251)
+	}
+	assert.Equal(t, map[string]interface{}{
+		"id":    int64(1),
+		"value": big,
+		"num":   1.5,
+		"neg":   int64(-2),
+		"text":  "short",
+		"added": int64(5),
+	}, rows[0])
+
+	for i, row := range rows[1:] {
+		id := i + 2
+		assert.Equal(t, map[string]interface{}{
+			"id":    int64(id),
+			"value": bytes.Repeat([]byte{byte(id)}, id%50),
+			"num":   float64(id) / 4,
+			"neg":   int64(-id) * 100000000000,
+			"text":  fmt.Sprintf("row %v", id),
+			"added": int64(5),
+		}, row)
+	}
+
+	_, err = db.readTable("unknown")
+	assert.Error(t, err)
+}
+
+func TestSQLite_Corrupted(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "overflow.sqlite"))
+	require.NoError(t, err)
+
+	// reader must never panic, whatever is in file
+	for i := 100; i < len(data); i += 7 {
+		broken := append([]byte{}, data...)
+		broken[i] ^= 0xff
+
+		db, err := openSQLite(broken)
+		if err == nil {
+			_, _ = db.readTable("data")
+		}
+	}
+
+	_, err = openSQLite(data[:50])
+	assert.Error(t, err)
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, rowid, err := parseColumns(`CREATE TABLE "t" (a INTEGER PRIMARY KEY, "b" TEXT DEFAULT 'x,y', ` +
+		`c NUMERIC(10, 2), PRIMARY KEY (a), CONSTRAINT u UNIQUE (b, c))`)
+	require.NoError(t, err)
+	assert.Equal(t, []sqliteColumn{{name: "a"}, {name: "b"}, {name: "c"}}, columns)
+	assert.Equal(t, 0, rowid)
+
+	columns, _, err = parseColumns(`CREATE TABLE t (a REAL, b DOUBLE PRECISION, c FLOATING POINT, d)`)
+	require.NoError(t, err)
+	assert.Equal(t, []sqliteColumn{{"a", true}, {"b", true}, {"c", false}, {"d", false}}, columns,
+		"'FLOATING POINT' is integer, cause it contains 'INT'")
+
+	_, rowid, err = parseColumns(`CREATE TABLE t (a TEXT PRIMARY KEY, b INTEGER)`)
+	require.NoError(t, err)
+	assert.Equal(t, -1, rowid, "only integer primary key is rowid")
+}
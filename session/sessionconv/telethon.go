@@ -0,0 +1,122 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package sessionconv
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/session"
+)
+
+// telethonVersion is a first char of Telethon string session
+const telethonVersion = "1"
+
+// FromTelethonString imports Telethon StringSession: version char and base64 of dc id (byte), ip (4 or 16
+// bytes), port (uint16) and auth key, all numbers are big endian.
+//
+// https://github.com/LonamiWebs/Telethon/blob/v1/telethon/sessions/string.py
+func FromTelethonString(str string) (*session.Session, error) {
+	if len(str) == 0 || str[:1] != telethonVersion {
+		return nil, errors.New("unknown version of telethon session")
+	}
+	data, err := decodeBase64(str[1:])
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding base64")
+	}
+
+	var ipLen int
+	switch len(data) {
+	case 1 + net.IPv4len + 2 + authKeySize: //nolint:gomnd dc and port
+		ipLen = net.IPv4len
+	case 1 + net.IPv6len + 2 + authKeySize: //nolint:gomnd dc and port
+		ipLen = net.IPv6len
+	default:
+		return nil, fmt.Errorf("invalid size of telethon session: %v", len(data))
+	}
+
+	ip := net.IP(data[1 : 1+ipLen])
+	port := binary.BigEndian.Uint16(data[1+ipLen:])
+	return newSession(int(data[0]), ip.String(), int(port), data[1+ipLen+2:])
+}
+
+// ToTelethonString exports session as Telethon StringSession. Hostname of session must be an ip address.
+func ToTelethonString(s *session.Session) (string, error) {
+	if err := checkKey(s); err != nil {
+		return "", err
+	}
+	dc, _, err := sessionDC(s)
+	if err != nil {
+		return "", err
+	}
+	ip, port, err := sessionAddress(s)
+	if err != nil {
+		return "", err
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	data := make([]byte, 0, 1+len(ip)+2+authKeySize) //nolint:gomnd dc and port
+	data = append(data, byte(dc))
+	data = append(data, ip...)
+	data = append(data, byte(port>>8), byte(port)) //nolint:gomnd big endian
+	data = append(data, s.Key...)
+
+	return telethonVersion + base64.URLEncoding.EncodeToString(data), nil
+}
+
+// FromTelethonFile imports Telethon SQLite session file (*.session). File could contain keys of few
+// datacenters, first one is used as main, others are imported as DCKeys.
+func FromTelethonFile(data []byte) (*session.Session, error) {
+	db, err := openSQLite(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// sessions(dc_id integer primary key, server_address text, port integer, auth_key blob, takeout_id integer)
+	rows, err := db.readTable("sessions")
+	if err != nil {
+		return nil, err
+	}
+
+	var res *session.Session
+	for _, row := range rows {
+		dc, _ := row["dc_id"].(int64)
+		host, _ := row["server_address"].(string)
+		port, _ := row["port"].(int64)
+		key, _ := row["auth_key"].([]byte)
+		if len(key) == 0 {
+			// telethon could store dc without key
+			continue
+		}
+		if host == "" || port == 0 {
+			return nil, fmt.Errorf("address of dc %v is empty", dc)
+		}
+
+		s, err := newSession(int(dc), host, int(port), key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "session of dc %v", dc)
+		}
+		if res == nil {
+			res = s
+			continue
+		}
+		if res.DCKeys == nil {
+			res.DCKeys = make(map[int]*session.AuthKey)
+		}
+		res.DCKeys[s.DC] = &session.AuthKey{Key: s.Key, Hash: s.Hash}
+	}
+	if res == nil {
+		return nil, errors.New("file doesn't contain auth key")
+	}
+
+	return res, nil
+}
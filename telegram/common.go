@@ -16,17 +16,29 @@ import (
 	dry "github.com/xelaj/go-dry"
 
 	"github.com/xelaj/mtproto"
+	"github.com/xelaj/mtproto/internal/encoding/tl"
 	"github.com/xelaj/mtproto/internal/keys"
+	"github.com/xelaj/mtproto/session"
 )
 
 type Client struct {
 	*mtproto.MTProto
 	config       *ClientConfig
 	serverConfig *Config
+
+	// if not zero, all requests are wrapped in invokeWithTakeout. See StartTakeout
+	takeoutID int64
 }
 
 type ClientConfig struct {
-	SessionFile     string
+	SessionFile string
+	// SessionStorage keeps session anywhere you want (e.g. in database, see session.NewFromKV). If it's set,
+	// SessionFile is ignored.
+	SessionStorage session.SessionLoader
+	// SessionPassphrase encrypts auth keys in SessionFile or SessionStorage, if it's set. Existing plaintext
+	// session is encrypted on first load.
+	SessionPassphrase string
+
 	ServerHost      string
 	PublicKeysFile  string
 	DeviceModel     string
@@ -35,6 +47,18 @@ type ClientConfig struct {
 	AppID           int
 	AppHash         string
 	InitWarnChannel bool
+
+	// ProxySecret and DC are required to connect through MTProxy, see mtproto.Config for details
+	ProxySecret string
+	DC          int
+	// Proxy is an url of SOCKS5 or HTTP CONNECT proxy, see mtproto.Config for details
+	Proxy string
+	// Dialer makes connections to server, see mtproto.Config for details
+	Dialer mtproto.Dialer
+	// DCDirectory is a list of addresses of datacenters, see mtproto.Config for details
+	DCDirectory *mtproto.DCDirectory
+	// QuickAck asks server to confirm receiving of requests, see mtproto.Config for details
+	QuickAck bool
 }
 
 const (
@@ -48,7 +72,7 @@ func NewClient(c ClientConfig) (*Client, error) { //nolint: gocritic arg is not
 		return nil, errs.NotFound("file", c.PublicKeysFile)
 	}
 
-	if !dry.PathIsWritable(c.SessionFile) {
+	if c.SessionStorage == nil && !dry.PathIsWritable(c.SessionFile) {
 		return nil, errs.Permission(c.SessionFile).Scope("write")
 	}
 
@@ -69,10 +93,27 @@ func NewClient(c ClientConfig) (*Client, error) { //nolint: gocritic arg is not
 		return nil, errors.Wrap(err, "reading public keys")
 	}
 
+	storage := c.SessionStorage
+	if storage == nil {
+		storage = session.NewFromFile(c.SessionFile)
+	}
+	if c.SessionPassphrase != "" {
+		storage, err = session.NewEncrypted(storage, session.EncryptionConfig{Passphrase: c.SessionPassphrase})
+		if err != nil {
+			return nil, errors.Wrap(err, "setup session encryption")
+		}
+	}
+
 	m, err := mtproto.NewMTProto(mtproto.Config{
-		AuthKeyFile: c.SessionFile,
-		ServerHost:  c.ServerHost,
-		PublicKey:   publicKeys[0],
+		SessionStorage: storage,
+		ServerHost:     c.ServerHost,
+		PublicKey:      publicKeys[0],
+		ProxySecret:    c.ProxySecret,
+		DC:             c.DC,
+		Proxy:          c.Proxy,
+		Dialer:         c.Dialer,
+		DCDirectory:    c.DCDirectory,
+		QuickAck:       c.QuickAck,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "setup common MTProto client")
@@ -84,6 +125,7 @@ func NewClient(c ClientConfig) (*Client, error) { //nolint: gocritic arg is not
 
 	err = m.CreateConnection()
 	if err != nil {
+		m.Disconnect() //nolint:errcheck releasing session, connection error is more important
 		return nil, errors.Wrap(err, "creating connection")
 	}
 
@@ -101,30 +143,112 @@ func NewClient(c ClientConfig) (*Client, error) { //nolint: gocritic arg is not
 		AppVersion:     c.AppVersion,
 		SystemLangCode: "en", // can't be edited, cause docs says that a single possible parameter
 		LangCode:       "en",
+		Proxy:          mtproxyInfo(&c),
 		Query:          &HelpGetConfigParams{},
 	})
 
 	if err != nil {
+		m.Disconnect() //nolint:errcheck releasing session, request error is more important
 		return nil, errors.Wrap(err, "getting server configs")
 	}
 
 	config, ok := resp.(*Config)
 	if !ok {
+		m.Disconnect() //nolint:errcheck releasing session, response error is more important
 		return nil, errors.New("got wrong response: " + reflect.TypeOf(resp).String())
 	}
 
 	client.serverConfig = config
+	if err := client.SetLayer(ApiVersion); err != nil {
+		m.Disconnect() //nolint:errcheck releasing session, saving error is more important
+		return nil, errors.Wrap(err, "saving session")
+	}
+
+	client.DCs().Set(convertDCOptions(config.DcOptions))
+	return client, nil
+}
 
-	dcList := make(map[int]string)
-	for _, dc := range config.DcOptions {
-		if dc.Cdn {
-			continue
+func convertDCOptions(options []*DcOption) []mtproto.DCOption {
+	res := make([]mtproto.DCOption, len(options))
+	for i, dc := range options {
+		res[i] = mtproto.DCOption{
+			ID:        int(dc.ID),
+			Addr:      net.JoinHostPort(dc.IpAddress, strconv.Itoa(int(dc.Port))),
+			IPv6:      dc.Ipv6,
+			MediaOnly: dc.MediaOnly,
+			TCPOOnly:  dc.TcpoOnly,
+			CDN:       dc.Cdn,
+			Static:    dc.Static,
+			Secret:    dc.Secret,
 		}
+	}
 
-		dcList[int(dc.ID)] = net.JoinHostPort(dc.IpAddress, strconv.Itoa(int(dc.Port)))
+	return res
+}
+
+// mtproxyInfo returns address of MTProxy, which is reported to server in initConnection. SOCKS5 and HTTP
+// proxies are not reported, server knows only about MTProxies.
+func mtproxyInfo(c *ClientConfig) *InputClientProxy {
+	if c.ProxySecret == "" {
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(c.ServerHost)
+	if err != nil {
+		return nil
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return nil
+	}
+
+	return &InputClientProxy{Address: host, Port: int32(p)}
+}
+
+// MakeRequest sends request to the server. It shadows MTProto.MakeRequest, cause client could wrap all
+// requests by itself (e.g. in takeout session) and remembers authorized user in session.
+func (c *Client) MakeRequest(msg tl.Object) (any, error) {
+	resp, err := c.MTProto.MakeRequest(c.wrapRequest(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	if auth, ok := resp.(*AuthAuthorizationObj); ok {
+		if user, ok := auth.User.(*UserObj); ok {
+			if err := c.SetUser(int64(user.ID), user.Bot); err != nil {
+				return nil, errors.Wrap(err, "saving session")
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+func (c *Client) MakeRequestWithHintToDecoder(msg tl.Object, expectedTypes ...reflect.Type) (any, error) {
+	return c.MTProto.MakeRequestWithHintToDecoder(c.wrapRequest(msg), expectedTypes...)
+}
+
+func (c *Client) MakeRequestAsync(msg tl.Object, expectedTypes ...reflect.Type) (*mtproto.PendingRequest, error) {
+	return c.MTProto.MakeRequestAsync(c.wrapRequest(msg), expectedTypes...)
+}
+
+func (c *Client) MakeRequestAfter(
+	after []*mtproto.PendingRequest, wrap func(msgIDs []int64) tl.Object, expectedTypes ...reflect.Type,
+) (*mtproto.PendingRequest, error) {
+	return c.MTProto.MakeRequestAfter(after, func(msgIDs []int64) tl.Object {
+		return c.wrapRequest(wrap(msgIDs))
+	}, expectedTypes...)
+}
+
+func (c *Client) wrapRequest(msg tl.Object) tl.Object {
+	if c.takeoutID == 0 {
+		return msg
+	}
+
+	return &InvokeWithTakeoutParams{
+		TakeoutID: c.takeoutID,
+		Query:     msg,
 	}
-	client.SetDCList(dcList)
-	return client, nil
 }
 
 func (m *Client) IsSessionRegistred() (bool, error) {
@@ -143,6 +267,24 @@ func (m *Client) IsSessionRegistred() (bool, error) {
 	}
 }
 
+// Logout signs out current user and wipes all traces of session: auth key is destroyed on server side and
+// stored session is removed. Client is disconnected after that, so it can't be used anymore.
+func (c *Client) Logout() error {
+	if _, err := c.AuthLogOut(); err != nil {
+		return errors.Wrap(err, "logging out")
+	}
+
+	if err := c.DestroyAuthKey(); err != nil {
+		return errors.Wrap(err, "destroying auth key")
+	}
+
+	if err := c.DeleteStoredSession(); err != nil {
+		return errors.Wrap(err, "deleting stored session")
+	}
+
+	return c.Disconnect()
+}
+
 /*
 func (c *Client) handleSpecialRequests() func(any) bool {
 	return func(i any) bool {
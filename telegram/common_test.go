@@ -0,0 +1,64 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package telegram_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xelaj/errs"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/session"
+	"github.com/xelaj/mtproto/telegram"
+	"github.com/xelaj/mtproto/telegram/telegramtest"
+)
+
+func TestClient_Logout(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	loggedOut := make(chan struct{}, 1)
+	s.RespondFunc(&telegram.AuthLogOutParams{}, func(tl.Object) (interface{}, error) {
+		loggedOut <- struct{}{}
+		return true, nil
+	})
+
+	storage := session.NewInMemory(nil)
+	client, err := s.Client(telegram.ClientConfig{SessionStorage: storage})
+	require.NoError(t, err)
+	_, err = storage.Load()
+	require.NoError(t, err)
+
+	require.NoError(t, client.Logout())
+	select {
+	case <-loggedOut:
+	default:
+		t.Fatal("auth.logOut wasn't sent")
+	}
+	assert.Nil(t, client.GetAuthKey(), "auth key must be destroyed")
+	_, err = storage.Load()
+	assert.True(t, errs.IsNotFound(err), "got %v", err)
+}
+
+func TestClient_LogoutFailed(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.RespondError(&telegram.AuthLogOutParams{}, 420, "FLOOD_WAIT_5")
+
+	storage := session.NewInMemory(nil)
+	client, err := s.Client(telegram.ClientConfig{SessionStorage: storage})
+	require.NoError(t, err)
+
+	assert.Error(t, client.Logout())
+	assert.NotNil(t, client.GetAuthKey(), "key must be kept, if user isn't logged out")
+	_, err = storage.Load()
+	assert.NoError(t, err)
+}
@@ -5,6 +5,24 @@
 
 package telegram
 
+import (
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+)
+
 const (
 	ApiVersion = 121
 )
+
+func init() {
+	// special methods are written by hand, so they are not in generated init, but they still must be
+	// decodable (e.g. by fake server in telegramtest)
+	tl.RegisterObjects(
+		&InvokeAfterMsgParams{},
+		&InvokeAfterMsgsParams{},
+		&InitConnectionParams{},
+		&InvokeWithLayerParams{},
+		&InvokeWithoutUpdatesParams{},
+		&InvokeWithMessagesRangeParams{},
+		&InvokeWithTakeoutParams{},
+	)
+}
@@ -7,6 +7,9 @@ package telegram
 
 // "особенные" методы, поскольку являются обертками над другими запросами. генерировать нельзя,т.к.
 // генератор не понимает что такое !X (и не должен понимать 100%)
+//
+// Wrappers return any, cause type of response is defined by wrapped query, and it could be bool or vector,
+// which are not tl.Object.
 
 import (
 	"github.com/pkg/errors"
@@ -14,8 +17,50 @@ import (
 	"github.com/xelaj/mtproto/internal/encoding/tl"
 )
 
-//invokeAfterMsg#cb9f372d {X:Type} msg_id:long query:!X = X;
-//invokeAfterMsgs#3dc4b4f0 {X:Type} msg_ids:Vector<long> query:!X = X;
+type InvokeAfterMsgParams struct {
+	MsgID int64
+	Query tl.Object
+}
+
+func (*InvokeAfterMsgParams) CRC() uint32 {
+	return 0xcb9f372d //nolint:gomnd not magic
+}
+
+// InvokeAfterMsg invokes query only after successful completion of request with specified msg_id. See
+// Sequence, if you need to order few requests.
+func (c *Client) InvokeAfterMsg(msgID int64, query tl.Object) (any, error) {
+	data, err := c.MakeRequest(&InvokeAfterMsgParams{
+		MsgID: msgID,
+		Query: query,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "sending InvokeAfterMsg")
+	}
+
+	return data, nil
+}
+
+type InvokeAfterMsgsParams struct {
+	MsgIDs []int64
+	Query  tl.Object
+}
+
+func (*InvokeAfterMsgsParams) CRC() uint32 {
+	return 0x3dc4b4f0 //nolint:gomnd not magic
+}
+
+// InvokeAfterMsgs invokes query only after successful completion of all requests with specified msg_ids.
+func (c *Client) InvokeAfterMsgs(msgIDs []int64, query tl.Object) (any, error) {
+	data, err := c.MakeRequest(&InvokeAfterMsgsParams{
+		MsgIDs: msgIDs,
+		Query:  query,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "sending InvokeAfterMsgs")
+	}
+
+	return data, nil
+}
 
 type InitConnectionParams struct {
 	ApiID          int32             // Application identifier (see. App configuration)
@@ -38,13 +83,13 @@ func (*InitConnectionParams) FlagIndex() int {
 	return 0
 }
 
-func (c *Client) InitConnection(params *InitConnectionParams) (tl.Object, error) {
+func (c *Client) InitConnection(params *InitConnectionParams) (any, error) {
 	data, err := c.MakeRequest(params)
 	if err != nil {
 		return nil, errors.Wrap(err, "sending InitConnection")
 	}
 
-	return data.(tl.Object), nil
+	return data, nil
 }
 
 type InvokeWithLayerParams struct {
@@ -56,7 +101,7 @@ func (*InvokeWithLayerParams) CRC() uint32 {
 	return 0xda9b0d0d //nolint:gomnd not magic
 }
 
-func (m *Client) InvokeWithLayer(layer int, query tl.Object) (tl.Object, error) {
+func (m *Client) InvokeWithLayer(layer int, query tl.Object) (any, error) {
 	data, err := m.MakeRequest(&InvokeWithLayerParams{
 		Layer: int32(layer),
 		Query: query,
@@ -65,11 +110,51 @@ func (m *Client) InvokeWithLayer(layer int, query tl.Object) (tl.Object, error)
 		return nil, errors.Wrap(err, "sending InvokeWithLayer")
 	}
 
-	return data.(tl.Object), nil
+	return data, nil
 }
 
-//invokeWithoutUpdates#bf9459b7 {X:Type} query:!X = X;
-//invokeWithMessagesRange#365275f2 {X:Type} range:MessageRange query:!X = X;
+type InvokeWithoutUpdatesParams struct {
+	Query tl.Object
+}
+
+func (*InvokeWithoutUpdatesParams) CRC() uint32 {
+	return 0xbf9459b7 //nolint:gomnd not magic
+}
+
+// InvokeWithoutUpdates invokes query, but server will not push any updates to this session as a result of it.
+func (c *Client) InvokeWithoutUpdates(query tl.Object) (any, error) {
+	data, err := c.MakeRequest(&InvokeWithoutUpdatesParams{
+		Query: query,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "sending InvokeWithoutUpdates")
+	}
+
+	return data, nil
+}
+
+type InvokeWithMessagesRangeParams struct {
+	Range *MessageRange
+	Query tl.Object
+}
+
+func (*InvokeWithMessagesRangeParams) CRC() uint32 {
+	return 0x365275f2 //nolint:gomnd not magic
+}
+
+// InvokeWithMessagesRange invokes query with messages range, which is required for takeout sessions (e.g.
+// exporting history by messages.getSplitRanges).
+func (c *Client) InvokeWithMessagesRange(messagesRange *MessageRange, query tl.Object) (any, error) {
+	data, err := c.MakeRequest(&InvokeWithMessagesRangeParams{
+		Range: messagesRange,
+		Query: query,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "sending InvokeWithMessagesRange")
+	}
+
+	return data, nil
+}
 
 type InvokeWithTakeoutParams struct {
 	TakeoutID int64
@@ -77,17 +162,20 @@ type InvokeWithTakeoutParams struct {
 }
 
 func (*InvokeWithTakeoutParams) CRC() uint32 {
-	return 0xda9b0d0d //nolint:gomnd not magic
+	return 0xaca9fd2e //nolint:gomnd not magic
 }
 
-func (m *Client) InvokeWithTakeout(takeoutID int, query tl.Object) (tl.Object, error) {
-	data, err := m.MakeRequest(&InvokeWithTakeoutParams{
+// InvokeWithTakeout invokes query as a part of takeout session. See StartTakeout, which wraps all requests
+// automatically.
+func (m *Client) InvokeWithTakeout(takeoutID int, query tl.Object) (any, error) {
+	// calling MTProto directly, cause takeout client wraps requests by itself
+	data, err := m.MTProto.MakeRequest(&InvokeWithTakeoutParams{
 		TakeoutID: int64(takeoutID),
 		Query:     query,
 	})
 	if err != nil {
-		return nil, errors.Wrap(err, "sending InvokeWithLayer")
+		return nil, errors.Wrap(err, "sending InvokeWithTakeout")
 	}
 
-	return data.(tl.Object), nil
+	return data, nil
 }
@@ -0,0 +1,92 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package telegram_test
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/telegram"
+	"github.com/xelaj/mtproto/telegram/telegramtest"
+)
+
+func TestSpecialMethodsRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		obj  tl.Object
+		want string
+	}{
+		{
+			name: "invokeWithoutUpdates",
+			obj: &telegram.InvokeWithoutUpdatesParams{
+				Query: &telegram.HelpGetConfigParams{},
+			},
+			want: "b75994bf" + "6b18f9c4",
+		},
+		{
+			name: "invokeWithMessagesRange",
+			obj: &telegram.InvokeWithMessagesRangeParams{
+				Range: &telegram.MessageRange{MinID: 1, MaxID: 100},
+				Query: &telegram.HelpGetConfigParams{},
+			},
+			want: "f2755236" + "5302e30a" + "01000000" + "64000000" + "6b18f9c4",
+		},
+		{
+			name: "invokeWithTakeout",
+			obj: &telegram.InvokeWithTakeoutParams{
+				TakeoutID: 1,
+				Query:     &telegram.HelpGetConfigParams{},
+			},
+			want: "2efda9ac" + "0100000000000000" + "6b18f9c4",
+		},
+		{
+			name: "invokeAfterMsg",
+			obj: &telegram.InvokeAfterMsgParams{
+				MsgID: 0x0102030405060708,
+				Query: &telegram.HelpGetConfigParams{},
+			},
+			want: "2d379fcb" + "0807060504030201" + "6b18f9c4",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tl.Marshal(tt.obj)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, hex.EncodeToString(data))
+
+			got := reflect.New(reflect.TypeOf(tt.obj).Elem()).Interface()
+			require.NoError(t, tl.Decode(data, got))
+			assert.Equal(t, tt.obj, got)
+		})
+	}
+}
+
+func TestSpecialMethodsNativeResponse(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+	s.Respond(&telegram.AccountUpdateStatusParams{}, true)
+
+	client, err := s.Client(telegram.ClientConfig{})
+	require.NoError(t, err)
+
+	// response of wrapped query is bool, which is not a tl object
+	query := &telegram.AccountUpdateStatusParams{}
+	for name, invoke := range map[string]func() (interface{}, error){
+		"invokeAfterMsg":       func() (interface{}, error) { return client.InvokeAfterMsg(0, query) },
+		"invokeAfterMsgs":      func() (interface{}, error) { return client.InvokeAfterMsgs(nil, query) },
+		"invokeWithoutUpdates": func() (interface{}, error) { return client.InvokeWithoutUpdates(query) },
+		"invokeWithTakeout":    func() (interface{}, error) { return client.InvokeWithTakeout(1, query) },
+	} {
+		res, err := invoke()
+		require.NoError(t, err, name)
+		assert.Equal(t, true, res, name)
+	}
+}
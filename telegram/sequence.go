@@ -0,0 +1,73 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package telegram
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto"
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+)
+
+// Sequence sends queries, which must be processed by server strictly one after another, like "send message,
+// then pin it". Each query (except first one) is wrapped in invokeAfterMsg with msg_id of the previous query,
+// so server will process it only after successful completion of previous one. If previous query failed,
+// next one receives MSG_WAIT_FAILED error.
+//
+// Order is kept even if some queries are resent, e.g. after server salt changing.
+type Sequence struct {
+	c     *Client
+	mutex sync.Mutex
+	last  *mtproto.PendingRequest
+}
+
+func (c *Client) NewSequence() *Sequence {
+	return &Sequence{c: c}
+}
+
+// Invoke queues query after all previously invoked queries of this sequence and returns immediately. Use
+// Wait() of returned handle to get the result.
+func (s *Sequence) Invoke(query tl.Object, expectedTypes ...reflect.Type) (*mtproto.PendingRequest, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var req *mtproto.PendingRequest
+	var err error
+	if s.last == nil {
+		req, err = s.c.MakeRequestAsync(query, expectedTypes...)
+	} else {
+		req, err = s.c.MakeRequestAfter([]*mtproto.PendingRequest{s.last}, func(msgIDs []int64) tl.Object {
+			return &InvokeAfterMsgParams{
+				MsgID: msgIDs[0],
+				Query: query,
+			}
+		}, expectedTypes...)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "sending query")
+	}
+
+	s.last = req
+	return req, nil
+}
+
+// Wait waits until all queued queries will be processed. Since every failed query fails all next ones, error
+// of the last query is returned.
+func (s *Sequence) Wait() error {
+	s.mutex.Lock()
+	last := s.last
+	s.mutex.Unlock()
+
+	if last == nil {
+		return nil
+	}
+
+	_, err := last.Wait()
+	return err
+}
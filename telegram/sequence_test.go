@@ -0,0 +1,88 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package telegram_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto"
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/telegram"
+	"github.com/xelaj/mtproto/telegram/telegramtest"
+)
+
+func TestSequence(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	var (
+		mutex    sync.Mutex
+		afterIDs []int64
+	)
+	s.OnRequest(func(req tl.Object) {
+		if r, ok := req.(*telegram.InvokeAfterMsgParams); ok {
+			mutex.Lock()
+			afterIDs = append(afterIDs, r.MsgID)
+			mutex.Unlock()
+		}
+	})
+	s.Respond(&telegram.AccountUpdateStatusParams{}, true)
+	s.Respond(&telegram.HelpGetNearestDcParams{}, &telegram.NearestDc{Country: "NL", ThisDc: 2, NearestDc: 2})
+
+	client, err := s.Client(telegram.ClientConfig{})
+	require.NoError(t, err)
+
+	seq := client.NewSequence()
+	require.NoError(t, seq.Wait(), "empty sequence")
+
+	first, err := seq.Invoke(&telegram.AccountUpdateStatusParams{})
+	require.NoError(t, err)
+	second, err := seq.Invoke(&telegram.HelpGetNearestDcParams{})
+	require.NoError(t, err)
+	require.NoError(t, seq.Wait())
+
+	res, err := second.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, &telegram.NearestDc{Country: "NL", ThisDc: 2, NearestDc: 2}, res)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []int64{first.MsgID()}, afterIDs, "first query isn't wrapped, second one waits first")
+}
+
+func TestSequence_Wait(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.RespondError(&telegram.AccountUpdateStatusParams{}, 400, "USER_DEACTIVATED")
+	// real server fails all queries after failed one
+	s.RespondError(&telegram.HelpGetNearestDcParams{}, 400, "MSG_WAIT_FAILED")
+
+	client, err := s.Client(telegram.ClientConfig{})
+	require.NoError(t, err)
+
+	seq := client.NewSequence()
+	first, err := seq.Invoke(&telegram.AccountUpdateStatusParams{})
+	require.NoError(t, err)
+	_, err = seq.Invoke(&telegram.HelpGetNearestDcParams{})
+	require.NoError(t, err)
+
+	var rpcErr *mtproto.ErrResponseCode
+	err = seq.Wait()
+	require.True(t, errors.As(err, &rpcErr), "got %v", err)
+	assert.Equal(t, "MSG_WAIT_FAILED", rpcErr.Message, "error of last query must be returned")
+
+	_, err = first.Wait()
+	require.True(t, errors.As(err, &rpcErr), "got %v", err)
+	assert.Equal(t, "USER_DEACTIVATED", rpcErr.Message)
+}
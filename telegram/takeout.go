@@ -0,0 +1,73 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package telegram
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto"
+)
+
+// Takeout is a session for exporting account data. It works exactly like Client, but every request of
+// takeout is wrapped in invokeWithTakeout automatically. Don't forget to call Finish(), when export is done.
+//
+// https://core.telegram.org/api/takeout
+type Takeout struct {
+	*Client
+}
+
+// StartTakeout initializes takeout session with chosen scopes. Telegram could require to wait before starting
+// export (user must confirm it in other client), in this case server responds TAKEOUT_INIT_DELAY_X error.
+// If required delay is less or equal maxInitDelay, StartTakeout waits and tries again, otherwise error is
+// returned as is.
+func (c *Client) StartTakeout(scopes *AccountInitTakeoutSessionParams, maxInitDelay time.Duration) (*Takeout, error) {
+	if scopes == nil {
+		scopes = &AccountInitTakeoutSessionParams{}
+	}
+
+	for {
+		takeout, err := c.AccountInitTakeoutSession(scopes)
+		if err == nil {
+			takeoutClient := *c
+			takeoutClient.takeoutID = takeout.ID
+			return &Takeout{Client: &takeoutClient}, nil
+		}
+
+		delay, ok := takeoutInitDelay(err)
+		if !ok || delay > maxInitDelay {
+			return nil, err
+		}
+
+		time.Sleep(delay)
+	}
+}
+
+// ID returns takeout id, which is used in invokeWithTakeout.
+func (t *Takeout) ID() int64 {
+	return t.takeoutID
+}
+
+// Finish closes takeout session. success must be false, if export was interrupted.
+func (t *Takeout) Finish(success bool) error {
+	_, err := t.AccountFinishTakeoutSession(success)
+	return errors.Wrap(err, "finishing takeout session")
+}
+
+func takeoutInitDelay(err error) (time.Duration, bool) {
+	var errCode *mtproto.ErrResponseCode
+	if !errors.As(err, &errCode) || errCode.Message != "TAKEOUT_INIT_DELAY_X" {
+		return 0, false
+	}
+
+	seconds, ok := errCode.AdditionalInfo.(int)
+	if !ok {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
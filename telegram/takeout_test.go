@@ -0,0 +1,97 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package telegram_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto"
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/telegram"
+	"github.com/xelaj/mtproto/telegram/telegramtest"
+)
+
+func TestClient_StartTakeout(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	var calls int32
+	s.RespondFunc(&telegram.AccountInitTakeoutSessionParams{}, func(tl.Object) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// user must confirm export in other client
+			return nil, telegramtest.Error(420, "TAKEOUT_INIT_DELAY_1")
+		}
+		return &telegram.AccountTakeout{ID: 1337}, nil
+	})
+
+	client, err := s.Client(telegram.ClientConfig{})
+	require.NoError(t, err)
+
+	_, err = client.StartTakeout(nil, 0)
+	var rpcErr *mtproto.ErrResponseCode
+	require.True(t, errors.As(err, &rpcErr), "delay is too long, but got %v", err)
+	assert.Equal(t, "TAKEOUT_INIT_DELAY_X", rpcErr.Message)
+	assert.Equal(t, 1, rpcErr.AdditionalInfo)
+
+	atomic.StoreInt32(&calls, 0)
+	start := time.Now()
+	takeout, err := client.StartTakeout(&telegram.AccountInitTakeoutSessionParams{Contacts: true}, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1337), takeout.ID())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Second), "client must wait before retrying")
+}
+
+func TestTakeout_Wrapping(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.Respond(&telegram.AccountInitTakeoutSessionParams{}, &telegram.AccountTakeout{ID: 1337})
+	s.Respond(&telegram.HelpGetNearestDcParams{}, &telegram.NearestDc{Country: "NL", ThisDc: 2, NearestDc: 2})
+	s.Respond(&telegram.AccountFinishTakeoutSessionParams{}, true)
+
+	var (
+		mutex    sync.Mutex
+		requests []tl.Object
+	)
+	s.OnRequest(func(req tl.Object) {
+		mutex.Lock()
+		requests = append(requests, req)
+		mutex.Unlock()
+	})
+
+	client, err := s.Client(telegram.ClientConfig{})
+	require.NoError(t, err)
+	takeout, err := client.StartTakeout(nil, 0)
+	require.NoError(t, err)
+
+	_, err = client.HelpGetNearestDc()
+	require.NoError(t, err)
+	_, err = takeout.HelpGetNearestDc()
+	require.NoError(t, err)
+	require.NoError(t, takeout.Finish(true))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []tl.Object{
+		&telegram.AccountInitTakeoutSessionParams{},
+		&telegram.HelpGetNearestDcParams{},
+		&telegram.InvokeWithTakeoutParams{TakeoutID: 1337, Query: &telegram.HelpGetNearestDcParams{}},
+		&telegram.InvokeWithTakeoutParams{
+			TakeoutID: 1337,
+			Query:     &telegram.AccountFinishTakeoutSessionParams{Success: true},
+		},
+	}, requests[len(requests)-4:], "only requests of takeout must be wrapped")
+}
@@ -0,0 +1,327 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+// Package telegramtest provides fake Telegram API server for testing code, which uses telegram.Client. Server
+// speaks real MTProto (transport, handshake and encryption), but answers only requests, which were scripted
+// by test.
+//
+//	s, err := telegramtest.NewServer()
+//	...
+//	defer s.Close()
+//
+//	s.Respond(&telegram.MessagesSendMessageParams{}, &telegram.UpdatesObj{})
+//	s.RespondError(&telegram.AuthLogOutParams{}, 420, "FLOOD_WAIT_5")
+//
+//	client, err := s.Client(telegram.ClientConfig{})
+package telegramtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/server"
+	"github.com/xelaj/mtproto/telegram"
+)
+
+// Responder answers single request. Result could be any tl object, native bool or slice (they are wrapped
+// automatically). Return error, created by Error, to answer with rpc error.
+type Responder func(req tl.Object) (any, error)
+
+// Server is a fake telegram server, which listens random port on localhost.
+type Server struct {
+	srv      *server.Server
+	listener net.Listener
+
+	// directory for public key and session files of clients
+	dir      string
+	keysFile string
+
+	mutex      sync.Mutex
+	responders map[uint32]Responder
+	onRequest  func(req tl.Object)
+	clients    []*telegram.Client
+}
+
+const (
+	rsaKeyBits = 2048
+
+	// this dc id is returned in default config, it doesn't mean anything
+	defaultDcID = 2
+)
+
+// NewServer starts new fake server. By default, it answers only help.getConfig (with config, which points to
+// server itself) and wrappers like invokeWithLayer and initConnection, all other requests must be scripted
+// via Respond, RespondFunc or RespondError.
+func NewServer() (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	if err != nil {
+		return nil, errors.Wrap(err, "generating rsa key")
+	}
+
+	dir, err := ioutil.TempDir("", "telegramtest")
+	if err != nil {
+		return nil, errors.Wrap(err, "creating temporary directory")
+	}
+
+	keysFile := filepath.Join(dir, "public_keys.pem")
+	err = ioutil.WriteFile(keysFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey),
+	}), 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "writing public key")
+	}
+
+	srv, err := server.New(server.Config{PrivateKey: key})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "creating server")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "listening")
+	}
+
+	s := &Server{
+		srv:        srv,
+		listener:   l,
+		dir:        dir,
+		keysFile:   keysFile,
+		responders: make(map[uint32]Responder),
+	}
+
+	for _, wrapper := range []tl.Object{
+		&telegram.InvokeWithLayerParams{},
+		&telegram.InitConnectionParams{},
+		&telegram.InvokeAfterMsgParams{},
+		&telegram.InvokeAfterMsgsParams{},
+		&telegram.InvokeWithoutUpdatesParams{},
+		&telegram.InvokeWithMessagesRangeParams{},
+		&telegram.InvokeWithTakeoutParams{},
+	} {
+		srv.Handle(wrapper.CRC(), s.handle)
+	}
+	s.RespondFunc(&telegram.HelpGetConfigParams{}, s.defaultConfig)
+
+	go srv.Serve(l) //nolint:errcheck always ErrServerClosed after Close
+
+	return s, nil
+}
+
+// Addr returns address, which server listens.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Respond sets constant response to requests, which have same type as method (e.g.
+// &telegram.MessagesSendMessageParams{}). Fields of method are ignored.
+func (s *Server) Respond(method tl.Object, response any) {
+	s.RespondFunc(method, func(tl.Object) (any, error) {
+		return response, nil
+	})
+}
+
+// RespondError sets rpc error as response to requests, which have same type as method.
+func (s *Server) RespondError(method tl.Object, code int32, message string) {
+	s.RespondFunc(method, func(tl.Object) (any, error) {
+		return nil, Error(code, message)
+	})
+}
+
+// RespondFunc sets function, which answers requests with same type as method. Responder is called with
+// request itself, already unwrapped from invokeWithLayer, initConnection, etc.
+func (s *Server) RespondFunc(method tl.Object, f Responder) {
+	s.mutex.Lock()
+	s.responders[method.CRC()] = f
+	s.mutex.Unlock()
+
+	s.srv.Handle(method.CRC(), s.handle)
+}
+
+// OnRequest sets function, which is called with every request before unwrapping, e.g. to check, that
+// request is wrapped in invokeAfterMsg or invokeWithTakeout with right parameters.
+func (s *Server) OnRequest(f func(req tl.Object)) {
+	s.mutex.Lock()
+	s.onRequest = f
+	s.mutex.Unlock()
+}
+
+// TransportError creates error, which is sent instead of response as transport error code, e.g.
+// TransportError(-429) emulates transport flood.
+func TransportError(code int32) error {
+	return &server.TransportError{Code: code}
+}
+
+// Error creates rpc error, e.g. Error(420, "FLOOD_WAIT_5"). Client receives it as *mtproto.ErrResponseCode.
+func Error(code int32, message string) error {
+	return server.NewRpcError(code, message)
+}
+
+// PushUpdate sends updates to all connected clients. Clients get it through handlers, added by
+// AddCustomServerRequestHandler.
+func (s *Server) PushUpdate(u telegram.Updates) error {
+	sent := false
+	for _, sess := range s.srv.Sessions() {
+		// disconnected sessions are just skipping
+		if err := sess.Push(u); err == nil {
+			sent = true
+		}
+	}
+
+	if !sent {
+		return errors.New("there is no connected clients")
+	}
+
+	return nil
+}
+
+// Client creates new client, connected to server. Only ServerHost, PublicKeysFile and SessionFile are
+// overwritten in config (SessionFile only if it and SessionStorage are empty), so other fields could be
+// set by test.
+//
+// Clients are disconnected by Close.
+func (s *Server) Client(c telegram.ClientConfig) (*telegram.Client, error) { //nolint:gocritic same as NewClient
+	s.mutex.Lock()
+	if c.SessionFile == "" && c.SessionStorage == nil {
+		c.SessionFile = filepath.Join(s.dir, "session_"+strconv.Itoa(len(s.clients))+".json")
+	}
+	s.mutex.Unlock()
+
+	c.ServerHost = s.Addr()
+	c.PublicKeysFile = s.keysFile
+
+	client, err := telegram.NewClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.clients = append(s.clients, client)
+	s.mutex.Unlock()
+
+	return client, nil
+}
+
+// Close disconnects all clients, created by server, and stops server.
+func (s *Server) Close() error {
+	s.mutex.Lock()
+	clients := s.clients
+	s.clients = nil
+	s.mutex.Unlock()
+
+	for _, c := range clients {
+		c.Disconnect() //nolint:errcheck server is closing anyway
+	}
+
+	err := s.srv.Close()
+	os.RemoveAll(s.dir)
+	return err
+}
+
+func (s *Server) handle(r *server.Request) (tl.Object, error) {
+	s.mutex.Lock()
+	onRequest := s.onRequest
+	s.mutex.Unlock()
+	if onRequest != nil {
+		onRequest(r.Object)
+	}
+
+	res, err := s.dispatch(r.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	return toObject(res)
+}
+
+// dispatch unwraps request and calls its responder
+func (s *Server) dispatch(req tl.Object) (any, error) {
+	switch r := req.(type) {
+	case *telegram.InvokeWithLayerParams:
+		return s.dispatch(r.Query)
+	case *telegram.InitConnectionParams:
+		return s.dispatch(r.Query)
+	case *telegram.InvokeAfterMsgParams:
+		return s.dispatch(r.Query)
+	case *telegram.InvokeAfterMsgsParams:
+		return s.dispatch(r.Query)
+	case *telegram.InvokeWithoutUpdatesParams:
+		return s.dispatch(r.Query)
+	case *telegram.InvokeWithMessagesRangeParams:
+		return s.dispatch(r.Query)
+	case *telegram.InvokeWithTakeoutParams:
+		return s.dispatch(r.Query)
+	}
+
+	s.mutex.Lock()
+	f, ok := s.responders[req.CRC()]
+	s.mutex.Unlock()
+	if !ok {
+		return nil, Error(400, fmt.Sprintf("INPUT_METHOD_INVALID_%d", req.CRC())) //nolint:gomnd
+	}
+
+	return f(req)
+}
+
+func (s *Server) defaultConfig(tl.Object) (any, error) {
+	host, portStr, err := net.SplitHostPort(s.Addr())
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &telegram.Config{
+		Date:    int32(now.Unix()),
+		Expires: int32(now.Add(time.Hour).Unix()),
+		ThisDc:  defaultDcID,
+		DcOptions: []*telegram.DcOption{
+			{ID: defaultDcID, IpAddress: host, Port: int32(port)},
+		},
+		MeURLPrefix:      "https://t.me/",
+		MessageLengthMax: 4096, //nolint:gomnd same as in real telegram
+	}, nil
+}
+
+// toObject converts native values to tl objects, cause only objects could be sent as response
+func toObject(v any) (tl.Object, error) {
+	switch val := v.(type) {
+	case tl.Object:
+		return val, nil
+	case bool:
+		if val {
+			return &tl.PseudoTrue{}, nil
+		}
+		return &tl.PseudoFalse{}, nil
+	case nil:
+		return nil, errors.New("response is nil")
+	}
+
+	if reflect.TypeOf(v).Kind() == reflect.Slice {
+		return tl.WrapSlice(v), nil
+	}
+
+	return nil, fmt.Errorf("response of type %T can't be encoded", v)
+}
@@ -0,0 +1,393 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package telegramtest_test
+
+import (
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xelaj/mtproto"
+	"github.com/xelaj/mtproto/internal/encoding/tl"
+	"github.com/xelaj/mtproto/internal/utils"
+	"github.com/xelaj/mtproto/session"
+	"github.com/xelaj/mtproto/telegram"
+	"github.com/xelaj/mtproto/telegram/telegramtest"
+)
+
+func TestServer(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.Respond(&telegram.MessagesSendMessageParams{}, &telegram.UpdateShortSentMessage{ID: 1337})
+	s.RespondFunc(&telegram.AccountUpdateStatusParams{}, func(req tl.Object) (interface{}, error) {
+		return req.(*telegram.AccountUpdateStatusParams).Offline, nil
+	})
+	s.RespondError(&telegram.AuthLogOutParams{}, 420, "FLOOD_WAIT_5")
+
+	client, err := s.Client(telegram.ClientConfig{AppID: 94575})
+	require.NoError(t, err)
+
+	updates, err := client.MessagesSendMessage(&telegram.MessagesSendMessageParams{
+		Peer:     &telegram.InputPeerSelf{},
+		Message:  "hello",
+		RandomID: 1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &telegram.UpdateShortSentMessage{ID: 1337}, updates)
+
+	offline, err := client.AccountUpdateStatus(true)
+	require.NoError(t, err)
+	assert.True(t, offline)
+
+	_, err = client.AuthLogOut()
+	var rpcErr *mtproto.ErrResponseCode
+	require.True(t, errors.As(err, &rpcErr), "got %v", err)
+	assert.Equal(t, "FLOOD_WAIT_X", rpcErr.Message)
+	assert.Equal(t, 5, rpcErr.AdditionalInfo)
+
+	_, err = client.HelpGetNearestDc()
+	require.True(t, errors.As(err, &rpcErr), "got %v", err)
+	assert.Equal(t, 400, rpcErr.Code)
+}
+
+func TestServer_PushUpdate(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	client, err := s.Client(telegram.ClientConfig{})
+	require.NoError(t, err)
+
+	got := make(chan interface{}, 1)
+	client.AddCustomServerRequestHandler(func(i interface{}) bool {
+		got <- i
+		return true
+	})
+
+	update := &telegram.UpdateShort{
+		Update: &telegram.UpdateUserTyping{UserID: 1, Action: &telegram.SendMessageTypingAction{}},
+		Date:   100,
+	}
+	require.NoError(t, s.PushUpdate(update))
+
+	select {
+	case u := <-got:
+		assert.Equal(t, update, u)
+	case <-time.After(5 * time.Second):
+		t.Fatal("update wasn't received")
+	}
+}
+
+func TestServer_Dialer(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	var dialed []string
+	client, err := s.Client(telegram.ClientConfig{
+		Dialer: mtproto.DialerFunc(func(ctx context.Context, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return (&mtproto.TCPDialer{}).DialContext(ctx, addr)
+		}),
+	})
+	require.NoError(t, err)
+
+	_, err = client.AccountUpdateStatus(false)
+	var rpcErr *mtproto.ErrResponseCode
+	require.True(t, errors.As(err, &rpcErr), "got %v", err)
+	assert.Equal(t, []string{s.Addr()}, dialed)
+}
+
+func TestServer_Failover(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	var dialed []string
+	client, err := s.Client(telegram.ClientConfig{
+		// address of server is "unreachable", but there is other address of same dc
+		Dialer: mtproto.DialerFunc(func(ctx context.Context, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			if addr == s.Addr() {
+				return nil, errors.New("connection refused")
+			}
+			return (&mtproto.TCPDialer{}).DialContext(ctx, s.Addr())
+		}),
+		DCDirectory: mtproto.NewDCDirectory([]mtproto.DCOption{
+			{ID: 2, Addr: "backup.invalid:443"},
+		}),
+	})
+	require.NoError(t, err)
+
+	_, err = client.AccountUpdateStatus(false)
+	var rpcErr *mtproto.ErrResponseCode
+	require.True(t, errors.As(err, &rpcErr), "got %v", err)
+	assert.Equal(t, []string{s.Addr(), "backup.invalid:443"}, dialed)
+}
+
+func TestServer_QuickAck(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	// server doesn't answer, until client gets quick ack
+	release := make(chan struct{})
+	s.RespondFunc(&telegram.AccountUpdateStatusParams{}, func(req tl.Object) (interface{}, error) {
+		<-release
+		return true, nil
+	})
+
+	client, err := s.Client(telegram.ClientConfig{QuickAck: true})
+	require.NoError(t, err)
+
+	req, err := client.MakeRequestAsync(&telegram.AccountUpdateStatusParams{Offline: true})
+	require.NoError(t, err)
+
+	select {
+	case <-req.Received():
+	case <-time.After(5 * time.Second):
+		t.Fatal("quick ack wasn't received")
+	}
+	close(release)
+
+	res, err := req.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, true, res)
+}
+
+func TestServer_AuthKeyNotFound(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "telegramtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// session with key, which server doesn't know
+	key := make([]byte, 256)
+	_, err = rand.Read(key)
+	require.NoError(t, err)
+	sessionFile := filepath.Join(dir, "session.json")
+	require.NoError(t, session.NewFromFile(sessionFile).Store(&session.Session{
+		Key:      key,
+		Hash:     utils.AuthKeyHash(key),
+		Salt:     1,
+		Hostname: s.Addr(),
+	}))
+
+	client, err := s.Client(telegram.ClientConfig{SessionFile: sessionFile})
+	require.NoError(t, err, "client must create new key")
+
+	s.Respond(&telegram.AccountUpdateStatusParams{}, true)
+	offline, err := client.AccountUpdateStatus(true)
+	require.NoError(t, err)
+	assert.True(t, offline)
+
+	stored, err := session.NewFromFile(sessionFile).Load()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, stored.Key, "new key must be stored")
+}
+
+func TestServer_TransportFlood(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	calls := 0
+	s.RespondFunc(&telegram.AccountUpdateStatusParams{}, func(req tl.Object) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, telegramtest.TransportError(-429)
+		}
+		return true, nil
+	})
+
+	client, err := s.Client(telegram.ClientConfig{InitWarnChannel: true})
+	require.NoError(t, err)
+
+	offline, err := client.AccountUpdateStatus(true)
+	require.NoError(t, err, "request must be resent after flood")
+	assert.True(t, offline)
+	assert.Equal(t, 2, calls)
+
+	select {
+	case warning := <-client.Warnings:
+		assert.True(t, errors.Is(warning, mtproto.ErrTransportFlood), "got %v", warning)
+	default:
+		t.Fatal("flood must be reported")
+	}
+}
+
+func TestServer_InvalidDC(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	calls := 0
+	s.RespondFunc(&telegram.AccountUpdateStatusParams{}, func(req tl.Object) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			return nil, telegramtest.TransportError(-444)
+		}
+		return true, nil
+	})
+
+	dir, err := ioutil.TempDir("", "telegramtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sessionFile := filepath.Join(dir, "session.json")
+
+	var dialed []string
+	client, err := s.Client(telegram.ClientConfig{
+		SessionFile: sessionFile,
+		DC:          4,
+		Dialer: mtproto.DialerFunc(func(ctx context.Context, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return (&mtproto.TCPDialer{}).DialContext(ctx, addr)
+		}),
+	})
+	require.NoError(t, err)
+	dc4Key := client.GetAuthKey()
+
+	offline, err := client.AccountUpdateStatus(true)
+	require.NoError(t, err, "request must be resent to default dc")
+	assert.True(t, offline)
+	// test server is the only dc in config of server, so address is same
+	assert.Equal(t, []string{s.Addr(), s.Addr()}, dialed, "client must reconnect to default dc")
+	assert.NotEqual(t, dc4Key, client.GetAuthKey(), "every dc has its own key")
+
+	stored, err := session.NewFromFile(sessionFile).Load()
+	require.NoError(t, err)
+	assert.Equal(t, 2, stored.DC)
+	require.Contains(t, stored.DCKeys, 4)
+	assert.Equal(t, dc4Key, stored.DCKeys[4].Key, "key of previous dc must be kept")
+}
+
+func TestServer_SessionRestore(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "telegramtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sessionFile := filepath.Join(dir, "session.json")
+
+	s.Respond(&telegram.AuthImportBotAuthorizationParams{}, &telegram.AuthAuthorizationObj{
+		// bot_info_version is always set for bots
+		User: &telegram.UserObj{ID: 1337, Bot: true, BotInfoVersion: 1},
+	})
+
+	client, err := s.Client(telegram.ClientConfig{SessionFile: sessionFile})
+	require.NoError(t, err)
+	_, err = client.AuthImportBotAuthorization(0, 1, "hash", "token")
+	require.NoError(t, err)
+	key := client.GetAuthKey()
+	require.NoError(t, client.Disconnect())
+
+	// clock of client is wrong: server must reject requests, until client syncs time
+	storage := session.NewFromFile(sessionFile)
+	stored, err := storage.Load()
+	require.NoError(t, err)
+	stored.TimeOffset = -time.Hour
+	require.NoError(t, storage.Store(stored))
+
+	client, err = s.Client(telegram.ClientConfig{SessionFile: sessionFile})
+	require.NoError(t, err)
+	assert.Equal(t, key, client.GetAuthKey(), "key must be restored")
+	id, bot := client.GetUser()
+	assert.Equal(t, int64(1337), id)
+	assert.True(t, bot)
+	assert.Equal(t, telegram.ApiVersion, client.GetLayer())
+	assert.InDelta(t, 0, client.GetTimeOffset().Seconds(), 5, "time must be synced")
+}
+
+func TestServer_EncryptedSession(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "telegramtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sessionFile := filepath.Join(dir, "session.json")
+
+	client, err := s.Client(telegram.ClientConfig{SessionFile: sessionFile, SessionPassphrase: "secret"})
+	require.NoError(t, err)
+	key := client.GetAuthKey()
+	require.NoError(t, client.Disconnect())
+
+	stored, err := session.NewFromFile(sessionFile).Load()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, stored.Key, "key must be encrypted")
+
+	client, err = s.Client(telegram.ClientConfig{SessionFile: sessionFile, SessionPassphrase: "secret"})
+	require.NoError(t, err)
+	assert.Equal(t, key, client.GetAuthKey())
+	require.NoError(t, client.Disconnect())
+
+	_, err = s.Client(telegram.ClientConfig{SessionFile: sessionFile, SessionPassphrase: "wrong"})
+	assert.True(t, errors.Is(err, session.ErrWrongSessionKey), "got %v", err)
+}
+
+func TestServer_SessionStorage(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	storage := session.NewInMemory(nil)
+	client, err := s.Client(telegram.ClientConfig{SessionStorage: storage})
+	require.NoError(t, err)
+	key := client.GetAuthKey()
+	require.NoError(t, client.Disconnect())
+
+	stored, err := storage.Load()
+	require.NoError(t, err)
+	assert.Equal(t, key, stored.Key)
+
+	client, err = s.Client(telegram.ClientConfig{SessionStorage: storage})
+	require.NoError(t, err)
+	assert.Equal(t, key, client.GetAuthKey(), "session must be restored from storage")
+}
+
+func TestServer_SessionLock(t *testing.T) {
+	s, err := telegramtest.NewServer()
+	require.NoError(t, err)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "telegramtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sessionFile := filepath.Join(dir, "session.json")
+
+	client, err := s.Client(telegram.ClientConfig{SessionFile: sessionFile})
+	require.NoError(t, err)
+
+	_, err = s.Client(telegram.ClientConfig{SessionFile: sessionFile})
+	assert.True(t, errors.Is(err, session.ErrSessionLocked), "got %v", err)
+
+	// lock is kept between connections
+	require.NoError(t, client.Reconnect())
+	_, err = s.Client(telegram.ClientConfig{SessionFile: sessionFile})
+	assert.True(t, errors.Is(err, session.ErrSessionLocked), "got %v", err)
+
+	require.NoError(t, client.Disconnect())
+	client, err = s.Client(telegram.ClientConfig{SessionFile: sessionFile})
+	require.NoError(t, err)
+	require.NoError(t, client.Disconnect())
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package mtproto
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrTransport is an error code, which server sends instead of message, when it can't handle data at
+// transport level. Unlike rpc errors, they aren't related to specific request, so client handles them by
+// itself: known codes are never returned to caller, they are only sent to Warnings.
+// https://core.telegram.org/mtproto/mtproto-transports#transport-errors
+type ErrTransport struct {
+	Code int
+}
+
+var (
+	// ErrAuthKeyNotFound means that server doesn't know auth key (e.g. it was destroyed or server forgot
+	// it). Client generates new key and resends pending requests.
+	ErrAuthKeyNotFound = &ErrTransport{Code: -404}
+	// ErrTransportFlood means that client sends too much data or opens too much connections. Client waits
+	// (longer and longer, if flood repeats) and resends pending requests.
+	ErrTransportFlood = &ErrTransport{Code: -429}
+	// ErrInvalidDC means that server doesn't know dc, which client asked to connect to (through MTProxy or
+	// websocket). Client switches to default dc.
+	ErrInvalidDC = &ErrTransport{Code: -444}
+)
+
+var transportErrorDescriptions = map[int]string{
+	ErrAuthKeyNotFound.Code: "auth key not found",
+	ErrTransportFlood.Code:  "transport flood",
+	ErrInvalidDC.Code:       "invalid dc",
+}
+
+func (e *ErrTransport) Error() string {
+	if desc, ok := transportErrorDescriptions[e.Code]; ok {
+		return fmt.Sprintf("transport error %v: %v", e.Code, desc)
+	}
+	return fmt.Sprintf("transport error %v", e.Code)
+}
+
+// Is allows to compare errors by code: errors.Is(err, ErrAuthKeyNotFound)
+func (e *ErrTransport) Is(target error) bool {
+	t, ok := target.(*ErrTransport)
+	return ok && t.Code == e.Code
+}
+
+const (
+	minFloodBackoff = time.Second
+	maxFloodBackoff = time.Minute
+)
+
+// handleTransportError applies recovery policy of transport error. Returned error means that recovery failed,
+// but client is still usable: it's only reported to Warnings.
+func (m *MTProto) handleTransportError(ctx context.Context, e *ErrTransport) error {
+	switch {
+	case errors.Is(e, ErrAuthKeyNotFound):
+		m.forgetAuthKey()
+		// new key is generated on connection
+		if err := m.Reconnect(); err != nil {
+			return errors.Wrap(err, "regenerating auth key")
+		}
+		m.resendPendingRequests()
+		return nil
+
+	case errors.Is(e, ErrTransportFlood):
+		m.floodBackoff *= 2
+		if m.floodBackoff < minFloodBackoff {
+			m.floodBackoff = minFloodBackoff
+		}
+		if m.floodBackoff > maxFloodBackoff {
+			m.floodBackoff = maxFloodBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(m.floodBackoff):
+		}
+		m.resendPendingRequests()
+		return nil
+
+	case errors.Is(e, ErrInvalidDC):
+		if m.dcID == defaultDC {
+			return errors.Wrap(e, "default dc is invalid too")
+		}
+		if err := m.switchDC(defaultDC); err != nil {
+			return errors.Wrap(err, "switching to default dc")
+		}
+		m.resendPendingRequests()
+		return nil
+
+	default:
+		return e
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2020-2021 KHS Films
+//
+// This file is a part of mtproto package.
+// See https://github.com/xelaj/mtproto/blob/master/LICENSE for details
+
+package mtproto_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xelaj/mtproto"
+)
+
+func TestErrTransport(t *testing.T) {
+	err := errors.Wrap(&mtproto.ErrTransport{Code: -404}, "reading message")
+
+	assert.True(t, errors.Is(err, mtproto.ErrAuthKeyNotFound))
+	assert.False(t, errors.Is(err, mtproto.ErrTransportFlood))
+	assert.EqualError(t, err, "reading message: transport error -404: auth key not found")
+	assert.EqualError(t, &mtproto.ErrTransport{Code: -500}, "transport error -500")
+}
@@ -8,6 +8,9 @@ package mtproto
 import (
 	"context"
 	"io"
+	"net"
+	"net/url"
+	"strings"
 
 	"github.com/xelaj/mtproto/internal/encoding/tl"
 	"github.com/xelaj/mtproto/internal/mtproto/objects"
@@ -19,13 +22,13 @@ type null = struct{}
 // это неофициальная информация, но есть подозрение, что список датацентров АБСОЛЮТНО идентичный для всех
 // приложений. Несмотря на это, любой клиент ОБЯЗАН явно указывать список датацентров, ради надежности.
 // данный список лишь эксперементальный и не является частью протокола.
-func defaultDCList() map[int]string {
-	return map[int]string{
-		1: "149.154.175.58:443",
-		2: "149.154.167.50:443",
-		3: "149.154.175.100:443",
-		4: "149.154.167.91:443",
-		5: "91.108.56.151:443",
+func defaultDCList() []DCOption {
+	return []DCOption{
+		{ID: 1, Addr: "149.154.175.58:443"},
+		{ID: 2, Addr: "149.154.167.50:443"},
+		{ID: 3, Addr: "149.154.175.100:443"},
+		{ID: 4, Addr: "149.154.167.91:443"},
+		{ID: 5, Addr: "91.108.56.151:443"},
 	}
 }
 
@@ -38,6 +41,59 @@ func MessageRequireToAck(msg tl.Object) bool {
 	}
 }
 
+// messageRequireEncryption returns false for messages, which must be sent unencrypted even if auth key is
+// already created
+func messageRequireEncryption(msg tl.Object) bool {
+	switch msg.(type) {
+	case *objects.DestroyAuthKeyParams:
+		return false
+	default:
+		return true
+	}
+}
+
+// isHTTPAddr returns true, if address is an url for http transport
+func isHTTPAddr(addr string) bool {
+	return strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://")
+}
+
+// isWebSocketAddr returns true, if address is an url for websocket transport
+func isWebSocketAddr(addr string) bool {
+	return strings.HasPrefix(addr, "ws://") || strings.HasPrefix(addr, "wss://")
+}
+
+// web endpoints of telegram have separate subdomain for each dc
+var webSocketDCNames = map[int]string{
+	1: "pluto",
+	2: "venus",
+	3: "aurora",
+	4: "vesta",
+	5: "flora",
+}
+
+const webSocketTelegramDomain = ".web.telegram.org"
+
+// webSocketDCAddr returns websocket address of specific dc. If address is not an official telegram web
+// endpoint (e.g. it's some proxy), it's returned as is, cause dc is set in obfuscated header anyway.
+func webSocketDCAddr(addr string, dc int) string {
+	u, err := url.Parse(addr)
+	if err != nil || !strings.HasSuffix(u.Hostname(), webSocketTelegramDomain) {
+		return addr
+	}
+	name, ok := webSocketDCNames[dc]
+	if !ok {
+		return addr
+	}
+
+	host := name + webSocketTelegramDomain
+	if port := u.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	u.Host = host
+
+	return u.String()
+}
+
 func CloseOnCancel(ctx context.Context, c io.Closer) {
 	go func() {
 		<-ctx.Done()